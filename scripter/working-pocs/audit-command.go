@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"scripter/entities"
+	"scripter/utilities"
+	"time"
+)
+
+// scripter audit [-file path] [-since time] [-until time] [-template name] [-outcome value] [-verify]
+func runAuditCommand(args []string) {
+	flags := flag.NewFlagSet("audit", flag.ExitOnError)
+	file := flags.String("file", auditLogger.Path, "audit log to query")
+	since := flags.String("since", "", "only records at or after this RFC 3339 time or duration ago (e.g. 24h)")
+	until := flags.String("until", "", "only records at or before this RFC 3339 time or duration ago")
+	template := flags.String("template", "", "only records of this template, by name or path")
+	outcome := flags.String("outcome", "", "only records with this outcome (accepted, rejected, succeeded, failed, timed-out, unresolved)")
+	verify := flags.Bool("verify", false, "verify the hash chain instead of listing records")
+	flags.Parse(args)
+
+	logger := utilities.AuditLogger{Path: *file}
+
+	if *verify {
+		brokenLine, err := logger.Verify()
+		if errors.Is(err, utilities.ErrAuditNotChained) {
+			fmt.Println("nothing to verify: records are written without SCRIPTER_AUDIT_HASH_CHAIN")
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if brokenLine != 0 {
+			fmt.Printf("hash chain broken at record %d\n", brokenLine)
+			os.Exit(1)
+		}
+		fmt.Println("hash chain intact")
+		return
+	}
+
+	filter := entities.AuditFilter{Template: *template, Outcome: *outcome}
+	var err error
+	if filter.Since, err = parseAuditTime(*since); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if filter.Until, err = parseAuditTime(*until); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	records, err := logger.Query(filter)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	for _, record := range records {
+		encoder.Encode(record)
+	}
+}
+
+func parseAuditTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: expected RFC 3339 or a duration", value)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"scripter/entities"
+	"scripter/utilities"
+	"time"
+)
+
+// scripter await -quay name [-process nickname] [-signal id] [-timeout 30s]
+// Blocks the originator until the signal it triggered reports it finished and
+// exits with the exit code the action finished with.
+func runAwaitCommand(args []string) {
+	flags := flag.NewFlagSet("await", flag.ExitOnError)
+	quay := flags.String("quay", "", "originator quay name the signal was triggered with")
+	process := flags.String("process", "", "originator process nickname")
+	signalId := flags.String("signal", "", "signal id to wait for, any signal on the quay when empty")
+	timeout := flags.Duration("timeout", 30*time.Second, "how long to wait for the finished acknowledgement")
+	flags.Parse(args)
+
+	if *quay == "" {
+		fmt.Fprintln(os.Stderr, "await: -quay is required")
+		os.Exit(2)
+	}
+
+	broker, err := connectBroker(true, 1)
+	if err == nil && broker == nil {
+		err = fmt.Errorf("no broker configured: set SCRIPTER_BROKER to rabbitmq or redis")
+	}
+	if err != nil {
+		log.Fatalf("Failed to connect to broker: %v", err)
+	}
+
+	handler := utilities.AcknowledgeHandler{Broker: broker}
+	acknowledgement, err := handler.WaitForAcknowledge(*quay, *process, *signalId, *timeout, func(progress entities.Acknowledgement) {
+		fmt.Printf("%s %s %s\n", progress.Time.Format(time.RFC3339), progress.SignalId, progress.Status)
+	})
+	broker.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(124)
+	}
+
+	if acknowledgement.ExitCode == nil {
+		fmt.Fprintf(os.Stderr, "signal %s did not run: %s\n", acknowledgement.SignalId, acknowledgement.Message)
+		os.Exit(1)
+	}
+	os.Exit(*acknowledgement.ExitCode)
+}
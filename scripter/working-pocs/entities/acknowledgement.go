@@ -0,0 +1,14 @@
+package entities
+
+import "time"
+
+type Acknowledgement struct {
+	SignalId    string    `json:"signal-id"`
+	Quay        string    `json:"quay"`
+	ProcessName string    `json:"process-name"`
+	Sender      string    `json:"sender"`
+	Status      string    `json:"status"`
+	ExitCode    *int      `json:"exit-code,omitempty"`
+	Message     string    `json:"message,omitempty"`
+	Time        time.Time `json:"time"`
+}
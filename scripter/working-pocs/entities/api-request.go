@@ -0,0 +1,9 @@
+package entities
+
+// ApiRequest is the call an api action makes to Signal.Api.
+type ApiRequest struct {
+	Method         string // GET, or POST when there is a body
+	Headers        map[string]string
+	Body           string
+	ExpectedStatus []int // Any 2xx when empty
+}
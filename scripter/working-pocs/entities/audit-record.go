@@ -0,0 +1,30 @@
+package entities
+
+import "time"
+
+type AuditRecord struct {
+	Time             time.Time `json:"time"`
+	Event            string    `json:"event"`
+	SignalId         string    `json:"signal-id"`
+	Sender           string    `json:"sender,omitempty"`
+	Template         string    `json:"template,omitempty"`
+	OriginatorQuay   string    `json:"originator-quay,omitempty"`
+	User             string    `json:"user,omitempty"`
+	SecurityDecision string    `json:"security-decision,omitempty"`
+	Executor         string    `json:"executor,omitempty"`
+	Subject          string    `json:"subject,omitempty"`
+	Attempt          int       `json:"attempt,omitempty"`
+	StartTime        time.Time `json:"start-time,omitzero"`
+	FinishTime       time.Time `json:"finish-time,omitzero"`
+	ExitCode         *int      `json:"exit-code,omitempty"`
+	Outcome          string    `json:"outcome,omitempty"`
+	PreviousHash     string    `json:"previous-hash,omitempty"`
+	Hash             string    `json:"hash,omitempty"`
+}
+
+type AuditFilter struct {
+	Since    time.Time
+	Until    time.Time
+	Template string // A template name or path
+	Outcome  string
+}
@@ -0,0 +1,11 @@
+package entities
+
+type BrokerMessage struct {
+	Id          string
+	Topic       string
+	Body        []byte
+	Priority    int
+	Headers     map[string]string
+	Redelivered bool
+	DeliveryTag string // Backend handle used to ack or nack this delivery
+}
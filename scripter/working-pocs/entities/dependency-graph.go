@@ -0,0 +1,22 @@
+package entities
+
+type DependencyNode struct {
+	Id           string // Resolved template path, or the raw reference when it could not be resolved
+	Name         string
+	Reference    string
+	Dependencies []string // Ids of the nodes that run once this one completed
+	Error        string
+}
+
+type DependencyGraph struct {
+	Root  string
+	Nodes map[string]*DependencyNode
+	Order []string // Topological order, the root first
+}
+
+type NodeResult struct {
+	Id       string
+	Status   string // succeeded, failed or skipped
+	ExitCode int
+	Error    string
+}
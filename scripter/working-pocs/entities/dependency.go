@@ -0,0 +1,42 @@
+package entities
+
+import (
+	"strings"
+	"time"
+)
+
+// Dependency is one entry of installation-dependencies, written in a template
+// as a name, which may carry an installer prefix and a version constraint as
+// in "pip:requests>=2.31", or as a mapping with name, binary, version and
+// installer.
+type Dependency struct {
+	Installer string // Installs it instead of the platform installer
+	Name      string
+	Binary    string // Looked up in PATH, never run, once the package is installed
+	Version   string // Constraint on the installed version, as 7.0.*, >=0.74 or >=7,<8
+}
+
+// String describes the dependency in plans and logs.
+func (dependency Dependency) String() string {
+	parts := []string{dependency.Name}
+	if dependency.Installer != "" {
+		parts[0] = dependency.Installer + ":" + dependency.Name
+	}
+	if dependency.Binary != "" {
+		parts = append(parts, "binary="+dependency.Binary)
+	}
+	if dependency.Version != "" {
+		parts = append(parts, "version="+dependency.Version)
+	}
+	return strings.Join(parts, " ")
+}
+
+// LockedDependency is the version a dependency was installed at, kept so
+// other runs and other hosts install that same version.
+type LockedDependency struct {
+	Installer  string    `json:"installer"`
+	Name       string    `json:"name"`
+	Constraint string    `json:"constraint,omitempty"` // The constraint it was picked under
+	Version    string    `json:"version"`
+	LockedAt   time.Time `json:"locked-at"`
+}
@@ -5,4 +5,5 @@ type EmitQuay struct {
 	Path         string
 	Relationship Relationship
 	Priority     int
+	When         string
 }
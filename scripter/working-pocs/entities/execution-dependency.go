@@ -0,0 +1,9 @@
+package entities
+
+// ExecutionDependency is one entry of execution-dependencies, written in a
+// template as a path or as a mapping with path, priority and when.
+type ExecutionDependency struct {
+	Path     string
+	Priority *int   // Moves it within the emit order, lower goes first
+	When     string // Condition under which it is queued, see ConditionExpression
+}
@@ -0,0 +1,26 @@
+package entities
+
+import "time"
+
+type RetryPolicy struct {
+	MaxAttempts   int           // 1 or less runs once
+	Backoff       time.Duration // Delay before the second attempt
+	BackoffFactor float64       // Multiplies the delay before every further attempt
+	RetryOn       []int         // Exit codes worth another attempt, any failure when empty
+}
+
+// ExecutionPolicy bounds one run of an action, a step or a dependency install.
+// Zero values are unset, so a policy only overrides what it sets.
+type ExecutionPolicy struct {
+	Retry   RetryPolicy
+	Timeout time.Duration // Per attempt
+}
+
+type Attempt struct {
+	Number     int       `json:"number"`
+	ExitCode   int       `json:"exit-code"`
+	Error      string    `json:"error,omitempty"`
+	TimedOut   bool      `json:"timed-out,omitempty"`
+	StartTime  time.Time `json:"start-time"`
+	FinishTime time.Time `json:"finish-time"`
+}
@@ -0,0 +1,26 @@
+package entities
+
+// InstallStep is what installing one dependency takes, worked out before
+// anything is installed.
+type InstallStep struct {
+	Dependency string   `json:"dependency"`
+	Installer  string   `json:"installer"`
+	Name       string   `json:"name"`
+	Binary     string   `json:"binary,omitempty"`     // Looked up in PATH once it is installed
+	Constraint string   `json:"constraint,omitempty"` // As the template asks
+	Locked     bool     `json:"locked,omitempty"`     // Target comes from the lock file
+	Installed  string   `json:"installed,omitempty"`  // Version installed now
+	Target     string   `json:"target,omitempty"`     // Version to install, the latest when empty
+	Action     string   `json:"action"`               // none, install, upgrade, downgrade or blocked
+	Reason     string   `json:"reason,omitempty"`
+	Command    []string `json:"command,omitempty"`
+	Privileged bool     `json:"privileged,omitempty"` // The command escalates privileges
+	Error      string   `json:"error,omitempty"`      // Why a blocked step cannot be done
+}
+
+type InstallPlan struct {
+	Signal        string        `json:"signal"`
+	TemplatePath  string        `json:"template-path"`
+	Containerized bool          `json:"containerized,omitempty"` // Dependencies are installed in the container instead
+	Steps         []InstallStep `json:"steps"`
+}
@@ -1,6 +1,10 @@
 package entities
 
 type Label struct {
-	Label    string
+	Label    string // Flat form, "key=value" for key/value labels
+	Key      string
+	Value    string
+	Sealed   bool
+	Removal  bool // Written as "-label" to drop an ancestor's label
 	Template string
 }
@@ -0,0 +1,23 @@
+package entities
+
+import "time"
+
+type StepResult struct {
+	Name         string            `json:"name"`
+	Pointer      string            `json:"pointer"`
+	TemplatePath string            `json:"template-path,omitempty"`
+	Status       string            `json:"status"` // succeeded, failed or skipped
+	ExitCode     int               `json:"exit-code"`
+	Error        string            `json:"error,omitempty"`
+	Reason       string            `json:"reason,omitempty"` // Why a step was skipped
+	Outputs      map[string]string `json:"outputs,omitempty"`
+	StartTime    time.Time         `json:"start-time,omitzero"`
+	FinishTime   time.Time         `json:"finish-time,omitzero"`
+}
+
+type PipelineResult struct {
+	Steps     []StepResult      `json:"steps"`
+	Succeeded bool              `json:"succeeded"`
+	ExitCode  int               `json:"exit-code"`
+	Outputs   map[string]string `json:"outputs,omitempty"` // The outputs received and those the steps published
+}
@@ -0,0 +1,15 @@
+package entities
+
+import "time"
+
+type ProcessResult struct {
+	Pid        int           `json:"pid"`
+	ExitCode   int           `json:"exit-code"`
+	StartTime  time.Time     `json:"start-time"`
+	FinishTime time.Time     `json:"finish-time"`
+	UserTime   time.Duration `json:"user-time"`
+	SystemTime time.Duration `json:"system-time"`
+	MaxRss     int64         `json:"max-rss,omitempty"`   // Peak resident memory in bytes, where the platform reports it
+	Detached   bool          `json:"detached,omitempty"`  // Left running on shutdown
+	Container  string        `json:"container,omitempty"` // Where the action ran, when it ran in a container
+}
@@ -0,0 +1,18 @@
+package entities
+
+import "time"
+
+type Runner struct {
+	Name             string    `json:"name"`
+	Labels           []string  `json:"labels"`
+	Os               string    `json:"os"`
+	PackageInstaller string    `json:"package-installer"`
+	Capacity         int       `json:"capacity"`
+	LastSeen         time.Time `json:"last-seen"`
+}
+
+type RunnerMatch struct {
+	Runner   Runner
+	Eligible bool
+	Reasons  []string
+}
@@ -0,0 +1,20 @@
+package entities
+
+import "time"
+
+// SignalRequest is what travels through the broker: enough to resolve the
+// target template again on the receiving side.
+type SignalRequest struct {
+	Id                 string            `json:"id"`
+	TemplatePath       string            `json:"template-path"`
+	OriginatorPath     string            `json:"originator-path"`
+	Nickname           string            `json:"nickname"`
+	RequireAcknowledge bool              `json:"require-acknowledge"`
+	ParentSignalId     string            `json:"parent-signal-id,omitempty"`
+	Relationship       Relationship      `json:"relationship"`
+	Priority           int               `json:"priority"`
+	Outputs            map[string]string `json:"outputs,omitempty"`
+	// A cascading shutdown of the originator carries over to what it emitted
+	ShutdownSignal      string        `json:"shutdown-signal,omitempty"`
+	ShutdownGracePeriod time.Duration `json:"shutdown-grace-period,omitempty"`
+}
@@ -1,7 +1,11 @@
 package entities
 
 type SignalStep struct {
-	Name    string
-	Pointer string
-	Source  string
+	Name      string
+	Pointer   string
+	Source    string
+	Priority  *int
+	OnFailure string // stop (default) or continue
+	When      string // Condition under which the step runs, see ConditionExpression
+	Policy    ExecutionPolicy
 }
@@ -1,9 +1,14 @@
 package entities
 
+import "time"
+
 type Signal struct {
+	Id                       string
 	Labels                   []string
+	LabelSet                 []Label
 	Containerize             bool
 	Sender                   string
+	SourcePath               string
 	Executor                 string
 	ExecutionMode            string
 	Type                     string
@@ -16,17 +21,26 @@ type Signal struct {
 	AuthorizationHub         string
 	CertificationHub         string
 	Api                      string
+	ApiRequest               ApiRequest
 	ExecutablePath           string
-	ShutdownSignal           string
+	ShutdownSignal           string        // cascade, single or none
+	ShutdownGracePeriod      time.Duration // Between SIGTERM and SIGKILL
 	Arguments                []string
+	WorkingDirectory         string
+	Stdin                    string
 	HostOs                   string
 	SignalOs                 string
 	ExecutorOs               string
 	PackageInstaller         string
-	InstallationDependencies []string
-	ExecutionDependencies    []string
+	InstallationDependencies []Dependency
+	ExecutionDependencies    []ExecutionDependency
+	ExecutionPolicy          ExecutionPolicy
+	InstallationPolicy       ExecutionPolicy // For each dependency install
 	Environment              string
 	EnvironmentVariables     map[string]string
 	OriginatorQuay           OriginatorQuay
+	Steps                    []SignalStep
+	StepChain                []string // Templates running this one in place, outermost first
 	EmitQuays                []EmitQuay
+	Outputs                  map[string]string // Step outputs it can reference, by steps.<name>.outputs.<key>
 }
@@ -1,5 +1,13 @@
 package versions
 
+import (
+	"fmt"
+	"scripter/entities"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
 type YamlFile_Generic_01 struct {
 	Header struct {
 		Inherits string   `yaml:"inherits"`
@@ -28,39 +36,139 @@ type YamlFile_Generic_01 struct {
 		CanOverwrite *bool  `yaml:"can-overwrite"`
 	} `yaml:"configuration"`
 	Action struct {
-		NameOrFullPath string   `yaml:"name-or-full-path"`
-		Type           string   `yaml:"type"`
-		Api            string   `yaml:"api"`
-		ShutdownSignal string   `yaml:"shutdown-signal"`
-		InitialInputs  []string `yaml:"initial-inputs"` //If a specific context is defined and used, inputs should
+		NameOrFullPath      string                 `yaml:"name-or-full-path"`
+		Type                string                 `yaml:"type"`
+		Api                 string                 `yaml:"api"`
+		ShutdownSignal      string                 `yaml:"shutdown-signal"`
+		ShutdownGracePeriod string                 `yaml:"shutdown-grace-period"`
+		WorkingDirectory    string                 `yaml:"working-directory"`
+		Stdin               string                 `yaml:"stdin"`          // File fed to the process, "-" for the stdin of scripter
+		Request             YamlRequest_Generic_01 `yaml:"request"`        // The call made by an api action
+		InitialInputs       []string               `yaml:"initial-inputs"` //If a specific context is defined and used, inputs should
 		//be defined there instead
 		EnvironmentVariables []string `yaml:"environment-variables"` //If a specific context is defined and used, inputs should
 		//be defined there instead
 		Platform struct {
-			OsFamily         string `yaml:"os-family"`
-			PackageInstaller string `yaml:"package-installer"`
+			OsFamily         string               `yaml:"os-family"`
+			PackageInstaller string               `yaml:"package-installer"`
+			Retry            YamlRetry_Generic_01 `yaml:"retry"`   // For each dependency install
+			Timeout          string               `yaml:"timeout"` // For each dependency install
 		}
-		InstallationDependencies []string `yaml:"installation-dependencies"`
-		ExecutionDependencies    []string `yaml:"execution-dependencies"`
-		CanOverwrite             *bool    `yaml:"can-overwrite"`
+		Retry                    YamlRetry_Generic_01                 `yaml:"retry"`
+		Timeout                  string                               `yaml:"timeout"`
+		InstallationDependencies YamlDependencies_Generic_01          `yaml:"installation-dependencies"`
+		ExecutionDependencies    YamlExecutionDependencies_Generic_01 `yaml:"execution-dependencies"`
+		CanOverwrite             *bool                                `yaml:"can-overwrite"`
 	} `yaml:"action"`
 	Environment struct {
 		Contexts []struct {
-			Context              string   `yaml:"context"`
-			Dependencies         []string `yaml:"dependencies"`
-			ContextInitialInputs []string `yaml:"context-initial-inputs"`
-			EnvironmentVariables []string `yaml:"environment-variables"`
+			Context              string                               `yaml:"context"`
+			Dependencies         YamlExecutionDependencies_Generic_01 `yaml:"dependencies"`
+			ContextInitialInputs []string                             `yaml:"context-initial-inputs"`
+			EnvironmentVariables []string                             `yaml:"environment-variables"`
 		} `yaml:"contexts"`
 		CanOverwrite *bool `yaml:"can-overwrite"`
 	}
 
 	Steps struct {
 		List []struct {
-			Step    string `yaml:"step"`
-			Pointer string `yaml:"pointer"`
+			Step      string               `yaml:"step"`
+			Pointer   string               `yaml:"pointer"`
+			Priority  *int                 `yaml:"priority"`
+			OnFailure string               `yaml:"on-failure"`
+			When      string               `yaml:"when"`
+			Retry     YamlRetry_Generic_01 `yaml:"retry"`
+			Timeout   string               `yaml:"timeout"`
 		} `yaml:"list"`
-		CanOverwrite *bool `yaml:"can-overwrite"`
+		OnFailure    string               `yaml:"on-failure"`
+		Retry        YamlRetry_Generic_01 `yaml:"retry"`   // Default of every step
+		Timeout      string               `yaml:"timeout"` // Default of every step
+		CanOverwrite *bool                `yaml:"can-overwrite"`
 	} `yaml:"steps"`
 
 	Parent *YamlFile_Generic_01
 }
+
+type YamlRetry_Generic_01 struct {
+	MaxAttempts   string   `yaml:"max-attempts"`
+	Backoff       string   `yaml:"backoff"`
+	BackoffFactor string   `yaml:"backoff-factor"`
+	RetryOn       []string `yaml:"retry-on"`
+}
+
+type YamlRequest_Generic_01 struct {
+	Method         string   `yaml:"method"`
+	Headers        []string `yaml:"headers"` // Like environment variables, "(Name) value"
+	Body           string   `yaml:"body"`
+	ExpectedStatus []string `yaml:"expected-status"`
+}
+
+// YamlDependencies_Generic_01 takes each dependency as a name or as a mapping
+// with name, binary, version and installer. A name is kept whole, whatever
+// installer prefix or version constraint it carries is read once the platform
+// installer is known.
+type YamlDependencies_Generic_01 []entities.Dependency
+
+func (dependencies *YamlDependencies_Generic_01) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.SequenceNode {
+		return fmt.Errorf("line %d: installation-dependencies must be a list", node.Line)
+	}
+	for _, item := range node.Content {
+		if item.Kind == yaml.ScalarNode {
+			*dependencies = append(*dependencies, entities.Dependency{Name: strings.TrimSpace(item.Value)})
+			continue
+		}
+		dependency := struct {
+			Name      string `yaml:"name"`
+			Binary    string `yaml:"binary"`
+			Version   string `yaml:"version"`
+			Installer string `yaml:"installer"`
+		}{}
+		if err := item.Decode(&dependency); err != nil {
+			return err
+		}
+		if dependency.Name == "" {
+			return fmt.Errorf("line %d: dependency without a name", item.Line)
+		}
+		*dependencies = append(*dependencies, entities.Dependency{
+			Installer: strings.TrimSpace(dependency.Installer),
+			Name:      strings.TrimSpace(dependency.Name),
+			Binary:    strings.TrimSpace(dependency.Binary),
+			Version:   strings.TrimSpace(dependency.Version),
+		})
+	}
+	return nil
+}
+
+// YamlExecutionDependencies_Generic_01 takes each execution dependency as a
+// path or as a mapping with path, priority and when.
+type YamlExecutionDependencies_Generic_01 []entities.ExecutionDependency
+
+func (dependencies *YamlExecutionDependencies_Generic_01) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.SequenceNode {
+		return fmt.Errorf("line %d: execution dependencies must be a list", node.Line)
+	}
+	for _, item := range node.Content {
+		if item.Kind == yaml.ScalarNode {
+			*dependencies = append(*dependencies, entities.ExecutionDependency{Path: item.Value})
+			continue
+		}
+		dependency := struct {
+			Path     string `yaml:"path"`
+			Priority *int   `yaml:"priority"`
+			When     string `yaml:"when"`
+		}{}
+		if err := item.Decode(&dependency); err != nil {
+			return err
+		}
+		if dependency.Path == "" {
+			return fmt.Errorf("line %d: execution dependency without a path", item.Line)
+		}
+		*dependencies = append(*dependencies, entities.ExecutionDependency{
+			Path:     dependency.Path,
+			Priority: dependency.Priority,
+			When:     strings.TrimSpace(dependency.When),
+		})
+	}
+	return nil
+}
@@ -1,12 +1,13 @@
 package entities
 
 type YamlContextProperty struct {
-	Sealed       bool
-	Default      bool
-	Name         string
-	Value        string
-	Values       []string
-	DictValues   map[string]string // Dictionary as a property
-	TemplateName string
-	Position     int
+	Sealed                bool
+	Default               bool
+	Name                  string
+	Value                 string
+	Values                []string
+	DictValues            map[string]string // Dictionary as a property
+	ExecutionDependencies []ExecutionDependency
+	TemplateName          string
+	Position              int
 }
@@ -1,12 +1,14 @@
 package entities
 
 type YamlProperty struct {
-	Sealed       bool
-	Default      bool
-	Name         string
-	BoolValue    *bool
-	Value        string
-	Values       []string
-	DictValues   map[string]string
-	TemplateName string
+	Sealed                bool
+	Default               bool
+	Name                  string
+	BoolValue             *bool
+	Value                 string
+	Values                []string
+	DictValues            map[string]string
+	Dependencies          []Dependency          // Installation dependencies as a property
+	ExecutionDependencies []ExecutionDependency // Execution dependencies as a property
+	TemplateName          string
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// scripter graph [-format dot|mermaid] <template> [originator] [nickname]
+func runGraphCommand(args []string) {
+	flags := flag.NewFlagSet("graph", flag.ExitOnError)
+	format := flags.String("format", "dot", "Output format, dot or mermaid")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: scripter graph [-format dot|mermaid] <template>")
+		os.Exit(2)
+	}
+
+	signal, err := resolveSignal(requestFromArgs(flags.Args()))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// A cycle still renders, so it can be seen where it closes
+	graph, err := graphHandler.Build(signal)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	switch *format {
+	case "dot":
+		fmt.Print(graphHandler.RenderDot(graph))
+	case "mermaid":
+		fmt.Print(graphHandler.RenderMermaid(graph))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown graph format %q\n", *format)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		os.Exit(1)
+	}
+}
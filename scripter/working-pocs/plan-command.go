@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"scripter/entities"
+	"scripter/utilities"
+)
+
+var installPlanner = utilities.InstallPlanner{Lock: utilities.DependencyLock{Path: utilities.LockFilePath()}}
+
+// scripter plan [-json] [-apply] [-auto-approve] <template> [originator] [nickname]
+func runPlanCommand(args []string) {
+	flags := flag.NewFlagSet("plan", flag.ExitOnError)
+	asJson := flags.Bool("json", false, "print the plans as JSON, one per line")
+	apply := flags.Bool("apply", false, "install what the plans call for")
+	autoApprove := flags.Bool("auto-approve", false, "apply without asking")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: scripter plan [-json] [-apply] [-auto-approve] <template>")
+		os.Exit(2)
+	}
+
+	// A plan only reads the templates, it records nothing in the audit log
+	signal, err := loadSignal(requestFromArgs(flags.Args()))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The steps run where the signal runs, so their dependencies are part of
+	// its plan
+	signals, err := planSignals(signal)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	ctx := context.Background()
+	plans := []entities.InstallPlan{}
+	blocked, failed := false, false
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
+	for _, planned := range signals {
+		plan := installPlanner.Plan(ctx, planned)
+		for _, step := range plan.Steps {
+			blocked = blocked || step.Action == utilities.InstallActionBlocked
+		}
+		plans = append(plans, plan)
+		if *asJson {
+			encoder.Encode(plan)
+		} else {
+			installPlanner.PrintPlan(os.Stdout, plan)
+		}
+	}
+
+	if *apply {
+		// Outside of a run there is no run log, installing logs to stderr
+		handler, err := runLogger.Handler(os.Stderr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		logger := slog.New(handler)
+		for index, plan := range plans {
+			if !installPlanner.HasChanges(plan) {
+				continue
+			}
+			if !*autoApprove && !installPlanner.Approve(plan) {
+				fmt.Printf("Plan of %s not applied\n", plan.Signal)
+				continue
+			}
+			if applyErr := installPlanner.Apply(plan, signals[index].InstallationPolicy, logger.With("sender", plan.Signal)); applyErr != nil {
+				fmt.Fprintf(os.Stderr, "Plan of %s not fully applied: %v\n", plan.Signal, applyErr)
+				failed = true
+			}
+		}
+	}
+
+	if err != nil || blocked || failed {
+		os.Exit(1)
+	}
+}
+
+// planSignals lists the signal and the steps it runs in place, depth first.
+func planSignals(signal entities.Signal) ([]entities.Signal, error) {
+	signals := []entities.Signal{signal}
+	for _, step := range signal.Steps {
+		templatePath, err := stepRunner.ResolvePointer(step.Pointer, signal.SourcePath)
+		if err != nil {
+			return signals, fmt.Errorf("step %s of %s: %w", step.Name, signal.Sender, err)
+		}
+		chain, err := stepRunner.StepChain(signal, templatePath)
+		if err != nil {
+			return signals, fmt.Errorf("step %s of %s: %w", step.Name, signal.Sender, err)
+		}
+		stepSignal, err := loadSignal(entities.SignalRequest{
+			Id:             objectHandler.GenerateSignalId(),
+			TemplatePath:   templatePath,
+			OriginatorPath: signal.SourcePath,
+			Nickname:       step.Name,
+			ParentSignalId: signal.Id,
+			Relationship:   entities.StepDependency,
+		})
+		if err != nil {
+			return signals, err
+		}
+		stepSignal.StepChain = chain
+		stepSignals, err := planSignals(stepSignal)
+		signals = append(signals, stepSignals...)
+		if err != nil {
+			return signals, err
+		}
+	}
+	return signals, nil
+}
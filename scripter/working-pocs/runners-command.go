@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// scripter runners list
+// scripter runners explain <template> [originator] [nickname]
+func runRunnersCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: scripter runners list | explain <template>")
+		os.Exit(2)
+	}
+
+	broker, err := connectBroker(false, 1)
+	if err != nil {
+		log.Fatalf("Failed to connect to broker: %v", err)
+	}
+	if broker != nil {
+		defer broker.Close()
+		useRunnerRegistryOf(broker)
+	}
+
+	runners, err := runnerRegistry.List()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch args[0] {
+	case "list":
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "NAME\tOS\tINSTALLER\tCAPACITY\tLABELS\tLAST SEEN")
+		for _, runner := range runners {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%d\t%s\t%s\n", runner.Name, runner.Os, runner.PackageInstaller, runner.Capacity, strings.Join(runner.Labels, ","), runner.LastSeen.Format("2006-01-02 15:04:05"))
+		}
+		writer.Flush()
+	case "explain":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: scripter runners explain <template>")
+			os.Exit(2)
+		}
+		request := requestFromArgs(args[1:])
+		// Explaining is not running, the signal is only loaded
+		signal, err := loadSignal(request)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("Signal %s labels [%s] executor %q\n", signal.Sender, strings.Join(signal.Labels, ", "), signal.Executor)
+		if len(runners) == 0 {
+			fmt.Println("No runners registered")
+		}
+		for _, match := range runnerMatcher.Match(signal, runners) {
+			verdict := "eligible"
+			if !match.Eligible {
+				verdict = "not eligible"
+			}
+			fmt.Printf("%s: %s\n", match.Runner.Name, verdict)
+			for _, reason := range match.Reasons {
+				fmt.Printf("  - %s\n", reason)
+			}
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown runners command %q\n", args[0])
+		os.Exit(2)
+	}
+}
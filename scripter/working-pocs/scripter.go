@@ -3,134 +3,625 @@ package main
 import (
 	"context"
 	"fmt"
-	"io"
 	"log"
+	"log/slog"
 	"os"
-	"os/exec"
+	"os/signal"
+	"path/filepath"
 	"scripter/entities"
 	"scripter/utilities"
+	"strconv"
 	"strings"
-
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/image"
-	"github.com/docker/docker/client"
+	"sync"
+	"syscall"
+	"time"
 )
 
 var security = utilities.Security{}
 var fileReader = utilities.FileReader{}
 var objectHandler = utilities.ObjectHandler{}
-var configuration = utilities.ActionConfiguration{}
 var queueHandler = utilities.QueueHandler{}
+var acknowledgeHandler = utilities.AcknowledgeHandler{}
+var auditLogger = utilities.AuditLogger{
+	Path:      getEnvOrDefault("SCRIPTER_AUDIT_LOG", "scripter_audit.log"),
+	HashChain: stringHandler.InterpretStringAsBool(os.Getenv("SCRIPTER_AUDIT_HASH_CHAIN")),
+}
+var stringHandler = utilities.StringHandler{}
+var runnerRegistry = utilities.RunnerRegistry{Store: utilities.FileRegistryStore{Path: getEnvOrDefault("SCRIPTER_RUNNER_REGISTRY", "scripter_runners.json")}}
+var runnerMatcher = utilities.RunnerMatcher{}
+var stepRunner = utilities.StepRunner{LibraryPaths: filepath.SplitList(os.Getenv("SCRIPTER_STEPS_PATH"))}
+var runStore = utilities.RunStore{Directory: getEnvOrDefault("SCRIPTER_RUNS_DIR", "runs")}
+var graphHandler = utilities.DependencyGraphHandler{}
+var retryRunner = utilities.RetryRunner{}
+var processRunner = utilities.ProcessRunner{}
+var runLogger = utilities.RunLogger{Store: runStore, Format: os.Getenv("SCRIPTER_LOG_FORMAT"), Level: os.Getenv("SCRIPTER_LOG_LEVEL")}
+var graphExecutor = utilities.GraphExecutor{Parallelism: getEnvIntOrDefault("SCRIPTER_PARALLELISM", 4)}
+var fileGenerator = utilities.FileGenerator{OutputDirectory: getEnvOrDefault("SCRIPTER_GENERATED_DIR", "generated"), Lock: utilities.DependencyLock{Path: utilities.LockFilePath()}}
+
+// Containerized signals are built and run in one runtime for the whole
+// process, picked by SCRIPTER_CONTAINER_RUNTIME and SCRIPTER_CONTAINER_HOST.
+// It is opened once a signal needs it, so one configured wrong only fails
+// those signals. SCRIPTER_IMAGE_REPOSITORY names their images.
+var containerImageBuilder = utilities.ContainerImageBuilder{
+	Repository:  os.Getenv("SCRIPTER_IMAGE_REPOSITORY"),
+	Lock:        utilities.DependencyLock{Path: utilities.LockFilePath()},
+	OpenRuntime: sync.OnceValues(openContainerRuntime),
+}
+var configuration = utilities.ActionConfiguration{Images: containerImageBuilder}
+var containerRunner = utilities.ContainerRunner{Builder: containerImageBuilder}
+
+// Flow dependencies are resolved here as a graph and run in place, each once
+// and after what it depends on. With "queue" they are queued for any runner
+// once the action completed instead; each of them then queues its own, so a
+// dependency shared by two branches runs once per branch and siblings are not
+// ordered against each other.
+var flowExecution = getEnvOrDefault("SCRIPTER_FLOW_EXECUTION", "graph")
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "audit":
+			runAuditCommand(os.Args[2:])
+			return
+		case "await":
+			runAwaitCommand(os.Args[2:])
+			return
+		case "worker":
+			runWorkerCommand(os.Args[2:])
+			return
+		case "runners":
+			runRunnersCommand(os.Args[2:])
+			return
+		case "graph":
+			runGraphCommand(os.Args[2:])
+			return
+		case "plan":
+			runPlanCommand(os.Args[2:])
+			return
+		}
+	}
+
+	// An interrupt shuts the action down as its shutdown-signal says
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	request := requestFromArgs(os.Args[1:])
+
+	signal, err := resolveSignal(request)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Without a broker the signal still runs; what it would queue or
+	// acknowledge fails instead
+	broker, err := connectBroker(true, 1)
+	if err != nil {
+		log.Fatalf("Failed to connect to broker: %v", err)
+	}
+	if broker != nil {
+		queueHandler.Broker = broker
+		acknowledgeHandler.Broker = broker
+	}
+
+	fmt.Printf("%+v\n", objectHandler.RedactSignal(signal))
+
+	exitCode, err := interpretSignal(ctx, signal)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	stop()
+	if broker != nil {
+		broker.Close()
+	}
+	os.Exit(exitCode)
+}
+
+// connectBroker connects to the broker SCRIPTER_BROKER names, nil when it
+// names none. A process that exits once its signal ran can only hand messages
+// to other processes, so it refuses the memory broker, which would drop them
+// on exit while reporting them published. A subscriber is handed at most
+// prefetch deliveries it has not acked yet.
+func connectBroker(crossProcess bool, prefetch int) (utilities.Broker, error) {
+	kind := os.Getenv("SCRIPTER_BROKER")
+	if kind == "" {
+		return nil, nil
+	}
+	if crossProcess && kind == "memory" {
+		return nil, fmt.Errorf("the memory broker does not outlive this process: set SCRIPTER_BROKER to rabbitmq or redis")
+	}
+	return utilities.NewBroker(kind, os.Getenv("SCRIPTER_BROKER_URL"), prefetch)
+}
+
+// requestFromArgs reads <template> [originator] [nickname] [require-acknowledge]
+func requestFromArgs(args []string) entities.SignalRequest {
+	args = append(args, "", "", "", "")
+	return entities.SignalRequest{
+		// An originator that wants to wait for this signal can pick its id upfront
+		Id:                 getEnvOrDefault("SCRIPTER_SIGNAL_ID", objectHandler.GenerateSignalId()),
+		TemplatePath:       args[0],
+		OriginatorPath:     args[1],
+		Nickname:           args[2],
+		RequireAcknowledge: stringHandler.InterpretStringAsBool(args[3]),
+	}
+}
 
-	filePath := os.Args[1]
-	originatorPath := os.Args[2]
-	nickname := os.Args[3]
-	requireAcknowledge := os.Args[4]
+// resolveSignal reads the requested template chain and resolves it into the
+// signal that gets interpreted, for the CLI and the worker alike.
+func resolveSignal(request entities.SignalRequest) (entities.Signal, error) {
+	// The template names the sender, so a request is recorded once it is read;
+	// one that cannot be read is recorded by its path alone
+	signal, err := loadSignal(request)
+	if err != nil {
+		recordAudit(auditLogger.Record(entities.AuditRecord{Event: utilities.AuditEventReceived, SignalId: request.Id, Template: request.TemplatePath, OriginatorQuay: request.OriginatorPath, Outcome: "unresolved"}))
+		return entities.Signal{}, err
+	}
+	recordAudit(auditLogger.RecordSignal(utilities.AuditEventReceived, signal, ""))
+	recordAudit(auditLogger.RecordSignal(utilities.AuditEventResolved, signal, ""))
 
-	yamls := fileReader.ReadAllYamls(filePath)
+	return signal, nil
+}
+
+// loadSignal resolves the request like resolveSignal without recording it,
+// for whoever only looks at the signal.
+func loadSignal(request entities.SignalRequest) (entities.Signal, error) {
+	yamls, err := fileReader.LoadAllYamls(request.TemplatePath)
+	if err != nil {
+		return entities.Signal{}, err
+	}
 
-	generalProperties, contextProperties, signalSteps, labels := objectHandler.GenerateYamlProperties(yamls)
+	generalProperties, contextProperties, signalSteps, labels, err := objectHandler.GenerateYamlProperties(yamls)
+	if err != nil {
+		return entities.Signal{}, err
+	}
 
-	signal := objectHandler.GenerateSignal(generalProperties, contextProperties, signalSteps, labels, originatorPath, nickname, requireAcknowledge)
+	signal, err := objectHandler.GenerateSignal(generalProperties, contextProperties, signalSteps, labels, request.OriginatorPath, request.Nickname, strconv.FormatBool(request.RequireAcknowledge))
+	if err != nil {
+		return entities.Signal{}, err
+	}
 
-	configuration = configuration.SetConfigurationFromSignal(signal)
+	signal.Id = request.Id
+	signal.SourcePath = request.TemplatePath
+	signal.Outputs = request.Outputs
+	// Queued by a signal whose shutdown cascades, it is part of that shutdown
+	signal = inheritShutdown(entities.Signal{ShutdownSignal: request.ShutdownSignal, ShutdownGracePeriod: request.ShutdownGracePeriod}, signal)
 
-	fmt.Printf("%+v\n", signal)
+	return signal, nil
+}
 
-	interpretSignal(signal)
+func openContainerRuntime() (utilities.ContainerRuntime, error) {
+	return utilities.NewContainerRuntime(os.Getenv("SCRIPTER_CONTAINER_RUNTIME"), os.Getenv("SCRIPTER_CONTAINER_HOST"))
 }
 
 func main2() {
 	// 1. Set up the context.
 	ctx := context.Background()
 
-	// 2. Create a new Docker client.
-	cli, err := client.NewClientWithOpts(client.FromEnv)
+	// 2. Connect to the container runtime.
+	runtime, err := utilities.NewContainerRuntime(os.Getenv("SCRIPTER_CONTAINER_RUNTIME"), os.Getenv("SCRIPTER_CONTAINER_HOST"))
 	if err != nil {
-		log.Fatalf("Failed to create Docker client: %v", err)
+		log.Fatalf("Failed to create container runtime: %v", err)
 	}
-	defer cli.Close()
+	defer runtime.Close()
 
-	// 3. Pull the Docker image.  We'll use a Windows image that has Chocolatey.
+	// 3. Pull the image.  We'll use a Windows image that has Chocolatey.
 	//   Make sure the base image you select has chocolatey.
-	reader, err := cli.ImagePull(ctx, "mcr.microsoft.com/windows/servercore:ltsc2022", image.PullOptions{})
-	if err != nil {
+	if err := runtime.Pull(ctx, "mcr.microsoft.com/windows/servercore:ltsc2022", os.Stdout); err != nil {
 		log.Fatalf("Failed to pull image: %v", err)
 	}
-	io.Copy(os.Stdout, reader)
 
 	// 4. Configure the container.  Now, set the command to install
 	//    a list of dependencies using Chocolatey, and then start a shell.
 	deps := []string{"git", "curl", "nodejs"}                                      // Example: Install Git, curl, and Node.js.
 	chocoInstallCmd := fmt.Sprintf("choco install %s -y", strings.Join(deps, ",")) // Join the dependencies with commas.
 	cmdStr := fmt.Sprintf("%s; powershell.exe", chocoInstallCmd)                   // Install and then start powershell
-	containerConfig := &container.Config{
-		Image: "mcr.microsoft.com/windows/servercore:ltsc2022", // Use the Windows image.
-		Cmd:   []string{"powershell", "-Command", cmdStr},      // Run the choco install command in PowerShell.
-		Tty:   true,                                            // IMPORTANT: Set Tty to true to keep the container running and interactive
-	}
 
-	// 5. Configure the host.
-	hostConfig := &container.HostConfig{}
-
-	// 6. Create the container.
-	resp, err := cli.ContainerCreate(ctx, containerConfig, hostConfig, nil, nil, "my-choco-container")
+	// 5. Create the container.
+	containerId, err := runtime.Create(ctx, utilities.ContainerSpec{
+		Name:    "my-choco-container",
+		Image:   "mcr.microsoft.com/windows/servercore:ltsc2022", // Use the Windows image.
+		Command: []string{"powershell", "-Command", cmdStr},      // Run the choco install command in PowerShell.
+		Tty:     true,                                            // IMPORTANT: Set Tty to true to keep the container running and interactive
+	})
 	if err != nil {
 		log.Fatalf("Failed to create container: %v", err)
 	}
 
-	// 7. Start the container.
-	if err := cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+	// 6. Start the container.
+	if err := runtime.Start(ctx, containerId); err != nil {
 		log.Fatalf("Failed to start container: %v", err)
 	}
 
-	// 8. Print the container ID.
-	fmt.Printf("Container ID: %s\n", resp.ID)
+	// 7. Print the container ID.
+	fmt.Printf("Container ID: %s\n", containerId)
 
-	// 9.  No longer wait, just print a message that it is running
+	// 8.  No longer wait, just print a message that it is running
 	fmt.Println("Container is running.  You can connect to it using 'docker exec -it my-choco-container powershell'")
 }
 
 // Executor Lobby
-func interpretSignal(signal entities.Signal) {
+func interpretSignal(ctx context.Context, signal entities.Signal) (int, error) {
+	exitCode, outputs, err := runAction(ctx, signal)
+
+	// What follows the action can reference the outputs of its steps
+	signal.Outputs = outputs
+
+	// Flow dependencies only follow an action that completed, and not one
+	// completing as scripter shuts down
+	if err == nil && ctx.Err() != nil {
+		return max(exitCode, 1), fmt.Errorf("flow dependencies of %s not started, shutting down", signal.Sender)
+	}
+	if err == nil {
+		if flowExecution != "queue" {
+			return runDependencyGraph(ctx, signal)
+		}
+		// A queued signal is interpreted by whoever consumes it, so generating
+		// files would not stop it from running
+		if signal.ExecutionMode == utilities.ExecutionModeFileGenerator {
+			if len(signal.EmitQuays) > 0 {
+				fmt.Printf("Flow dependencies of %s are not queued in %s mode\n", signal.Sender, signal.ExecutionMode)
+			}
+			return exitCode, err
+		}
+		// Flow signals that were not queued never run, which is a failure
+		// even though the action itself succeeded
+		if err := queueHandler.QueueQuaySignals(signal, entities.FlowDependency); err != nil {
+			return max(exitCode, 1), fmt.Errorf("failed to queue flow signals: %w", err)
+		}
+	}
+
+	return exitCode, err
+}
+
+// runAction validates the signal, runs its steps and its executable, without
+// following its flow dependencies. It returns the outputs received along with
+// those its steps published.
+func runAction(ctx context.Context, signal entities.Signal) (int, map[string]string, error) {
+
+	reportAcknowledge(signal, utilities.AcknowledgeReceived, nil, "")
+
+	// Every run, steps included, logs to a file of its own
+	logger, logFile, logErr := runLogger.Open(signal)
+	if logErr != nil {
+		reportAcknowledge(signal, utilities.AcknowledgeFinished, nil, "run log not opened")
+		return 1, signal.Outputs, fmt.Errorf("%s: %w", signal.Sender, logErr)
+	}
+	defer logFile.Close()
+	logger.Info("signal received", "template", signal.SourcePath, "originator", signal.OriginatorQuay.SourceOrPath)
+
+	authorized := security.ValidateSecurity(signal)
+	recordAudit(auditLogger.RecordAuthorization(signal, authorized))
+	if !authorized {
+		logger.Warn("rejected by security")
+		reportAcknowledge(signal, utilities.AcknowledgeFinished, nil, "rejected by security")
+		return 1, signal.Outputs, fmt.Errorf("signal %s rejected by security", signal.Id)
+	}
+
+	generateFiles := false
+	switch signal.ExecutionMode {
+	case "", utilities.ExecutionModeScript:
+	case utilities.ExecutionModeFileGenerator:
+		generateFiles = true
+	default:
+		logger.Error("unknown execution mode", "execution-mode", signal.ExecutionMode)
+		reportAcknowledge(signal, utilities.AcknowledgeFinished, nil, "unknown execution mode")
+		return 1, signal.Outputs, fmt.Errorf("unknown execution mode %q in %s", signal.ExecutionMode, signal.Sender)
+	}
+	actionHandler, handlerErr := utilities.GetActionHandler(signal.Type)
+	if handlerErr != nil {
+		logger.Error("unsupported action type", "type", signal.Type)
+		reportAcknowledge(signal, utilities.AcknowledgeFinished, nil, "unsupported action type")
+		return 1, signal.Outputs, fmt.Errorf("%s: %w", signal.Sender, handlerErr)
+	}
 
-	if !security.ValidateSecurity(signal) {
-		return
+	reportAcknowledge(signal, utilities.AcknowledgeStarted, nil, "")
+	logger.Info("action started", "type", signal.Type, "execution-mode", signal.ExecutionMode)
+
+	// Dependencies are only installed where the action runs; generated files
+	// install them themselves
+	if !generateFiles {
+		if err := configuration.SetConfigurationFromSignal(signal).SetGeneralConfiguration(signal, logger); err != nil {
+			logger.Error("dependencies not installed", "error", err)
+			reportAcknowledge(signal, utilities.AcknowledgeFinished, nil, "dependencies not installed")
+			return 1, signal.Outputs, err
+		}
 	}
 
-	configuration.SetGeneralConfiguration(signal)
+	startTime := time.Now()
+
+	// Steps are part of the action: they run first and a failing one stops
+	// the action unless it is marked on-failure: continue
+	exitCode, outputs, err := 0, signal.Outputs, error(nil)
+	if len(signal.Steps) > 0 {
+		pipeline := stepRunner.Run(signal, func(step entities.SignalStep, templatePath string, outputs map[string]string) (int, map[string]string, error) {
+			return runStep(ctx, signal, step, templatePath, outputs, logger)
+		})
+		stepRunner.PrintReport(pipeline, logger)
+		if err := runStore.SavePipeline(signal.Id, pipeline); err != nil {
+			logger.Warn("pipeline not saved", "error", err)
+		}
+		outputs = pipeline.Outputs
+		logger.Info("steps finished", "steps", len(pipeline.Steps), "succeeded", pipeline.Succeeded)
+		if !pipeline.Succeeded {
+			exitCode, err = pipeline.ExitCode, fmt.Errorf("pipeline of %s failed", signal.Sender)
+		}
+	}
+	// The action itself runs last, so it can reference every step output
+	if err == nil {
+		interpolated, interpolateErr := objectHandler.InterpolateSignal(signal, outputs)
+		switch {
+		case interpolateErr == nil:
+			signal = interpolated
+		case generateFiles:
+			// Steps publish nothing when files are generated, so what refers
+			// to their outputs stays as written
+			logger.Warn("references left as written", "error", interpolateErr)
+			fmt.Printf("%s: %v, left as written\n", signal.Sender, interpolateErr)
+		default:
+			exitCode, err = 1, interpolateErr
+		}
+	}
+	if err == nil && generateFiles {
+		var files []string
+		files, err = fileGenerator.Generate(signal)
+		if err == nil && len(files) == 0 {
+			logger.Info("nothing to generate")
+			fmt.Printf("%s has nothing to generate\n", signal.Sender)
+		}
+		for _, file := range files {
+			logger.Info("file generated", "path", file)
+			fmt.Printf("Generated %s\n", file)
+		}
+		if err != nil {
+			exitCode = 1
+		}
+	} else if err == nil {
+		exitCode, err = retryRunner.Run(ctx, signal.ExecutionPolicy, logger, func(ctx context.Context) (int, error) {
+			return execute(ctx, signal, actionHandler, logger)
+		}, func(attempt entities.Attempt) {
+			logger.Info("attempt finished", "attempt", attempt.Number, "exit-code", attempt.ExitCode, "duration", attempt.FinishTime.Sub(attempt.StartTime).Round(time.Millisecond).String())
+			recordAudit(auditLogger.RecordAttempt(signal, "action", attempt))
+		})
+	}
 
-	//queueHandler.QueueQuaySignals(signal)
+	recordAudit(auditLogger.RecordExecution(signal, startTime, time.Now(), exitCode))
+	message := ""
+	if err != nil {
+		message = err.Error()
+		logger.Error("action failed", "exit-code", exitCode, "error", err)
+	} else {
+		logger.Info("action finished", "exit-code", exitCode)
+	}
+	reportAcknowledge(signal, utilities.AcknowledgeFinished, &exitCode, message)
 
-	//execute("algo", signal.Arguments)
+	return exitCode, outputs, err
 }
 
-// Set labels for the signal so a runner can pick it
-func setLabels(labels []string) {
+// runDependencyGraph runs every template the signal depends on, transitively,
+// once the ones depending on it succeeded. Independent templates run in
+// parallel up to SCRIPTER_PARALLELISM.
+func runDependencyGraph(ctx context.Context, signal entities.Signal) (int, error) {
+	graph, err := graphHandler.Build(signal)
+	if err != nil {
+		return 1, err
+	}
+	if len(graph.Nodes) == 1 {
+		return 0, nil
+	}
 
+	// The graph is part of the run of the signal, it goes to the same log
+	logger, logFile, err := runLogger.Open(signal)
+	if err != nil {
+		return 1, fmt.Errorf("%s: %w", signal.Sender, err)
+	}
+	defer logFile.Close()
+
+	results := graphExecutor.Run(graph, func(node entities.DependencyNode) (int, error) {
+		if ctx.Err() != nil {
+			return 1, fmt.Errorf("not started, %s is shutting down", signal.Sender)
+		}
+		dependencySignal, err := resolveSignal(entities.SignalRequest{
+			Id:             objectHandler.GenerateSignalId(),
+			TemplatePath:   node.Id,
+			OriginatorPath: signal.SourcePath,
+			Nickname:       node.Name,
+			ParentSignalId: signal.Id,
+			Relationship:   entities.FlowDependency,
+			Outputs:        signal.Outputs,
+		})
+		if err != nil {
+			return 1, err
+		}
+		dependencySignal = inheritExecutionMode(signal, inheritShutdown(signal, dependencySignal))
+		logger.Info("running dependency", "dependency", node.Name, "template", node.Id)
+		fmt.Printf("Running dependency %s (%s)\n", node.Name, node.Id)
+		exitCode, _, err := runAction(ctx, dependencySignal)
+		return exitCode, err
+	})
+	graphExecutor.PrintReport(graph, results, logger)
+
+	for _, id := range graph.Order {
+		if results[id].Status != utilities.StepSucceeded {
+			return max(results[id].ExitCode, 1), fmt.Errorf("dependency graph of %s failed", signal.Sender)
+		}
+	}
+	return 0, nil
 }
 
-func execute(command string, args []string) {
-	// Example with a config file:
-	//cmd := exec.Command("dosbox", "-conf", "my_dosbox.conf")
+// runStep resolves the step template as a signal originated by the parent and
+// interprets it in place, then collects the outputs it published.
+func runStep(ctx context.Context, parent entities.Signal, step entities.SignalStep, templatePath string, outputs map[string]string, logger *slog.Logger) (int, map[string]string, error) {
+	if ctx.Err() != nil {
+		return 1, nil, fmt.Errorf("not started, %s is shutting down", parent.Sender)
+	}
+	chain, err := stepRunner.StepChain(parent, templatePath)
+	if err != nil {
+		return 1, nil, err
+	}
+	stepSignal, err := resolveSignal(entities.SignalRequest{
+		Id:             objectHandler.GenerateSignalId(),
+		TemplatePath:   templatePath,
+		OriginatorPath: parent.SourcePath,
+		Nickname:       step.Name,
+		ParentSignalId: parent.Id,
+		Relationship:   entities.StepDependency,
+		Outputs:        outputs,
+	})
+	if err != nil {
+		return 1, nil, err
+	}
+	stepSignal.StepChain = chain
+	// Retries and timeout given in the step list win over the step template's
+	stepSignal.ExecutionPolicy = objectHandler.MergeExecutionPolicy(stepSignal.ExecutionPolicy, step.Policy)
+	stepSignal = inheritExecutionMode(parent, inheritShutdown(parent, stepSignal))
+	logger.Info("running step", "step", step.Name, "template", templatePath, "step-signal-id", stepSignal.Id)
+	fmt.Printf("Running step %s (%s)\n", step.Name, templatePath)
+	exitCode, err := interpretSignal(ctx, stepSignal)
+
+	stepOutputs, readErr := runStore.ReadOutputs(stepSignal.Id)
+	if readErr != nil {
+		logger.Warn("step outputs not read", "step", step.Name, "error", readErr)
+	}
+	return exitCode, stepOutputs, err
+}
 
-	// Example with commands (using -c):
+// A cascading shutdown reaches everything the signal runs in place or emits,
+// whatever those templates say for themselves.
+func inheritShutdown(parent entities.Signal, signal entities.Signal) entities.Signal {
+	if parent.ShutdownSignal == utilities.ShutdownCascade {
+		signal.ShutdownSignal = utilities.ShutdownCascade
+		if signal.ShutdownGracePeriod == 0 {
+			signal.ShutdownGracePeriod = parent.ShutdownGracePeriod
+		}
+	}
+	return signal
+}
 
-	// Capture output (optional)
-	cmd := exec.Command(command, args...)
-	out, err := cmd.CombinedOutput()
+// Generating files for a signal never runs what it runs in place.
+func inheritExecutionMode(parent entities.Signal, signal entities.Signal) entities.Signal {
+	if parent.ExecutionMode == utilities.ExecutionModeFileGenerator {
+		signal.ExecutionMode = utilities.ExecutionModeFileGenerator
+	}
+	return signal
+}
 
-	if err != nil {
-		log.Fatalf("cmd.Run() failed with %s\n", err)
+func reportAcknowledge(signal entities.Signal, status string, exitCode *int, message string) {
+	if err := acknowledgeHandler.Acknowledge(signal, status, exitCode, message); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to acknowledge %s to %s: %v\n", status, signal.OriginatorQuay.Name, err)
 	}
-	fmt.Printf("combined out:\n%s\n", string(out))
+}
 
-	err = cmd.Start()
+// The audit trail must never stop a signal, failures to write it are only reported
+func recordAudit(err error) {
 	if err != nil {
-		log.Fatal(err)
+		fmt.Fprintf(os.Stderr, "audit: %v\n", err)
 	}
+}
+
+func getEnvOrDefault(key string, defaultValue string) string {
+	if value, exists := os.LookupEnv(key); exists && value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvIntOrDefault(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
 
-	fmt.Println(command + " started with config/commands!")
+// useRunnerRegistryOf keeps the runner registry in the broker when it can hold
+// it, shared by every host, and in the file of this host otherwise.
+func useRunnerRegistryOf(broker utilities.Broker) {
+	if store, shared := broker.(utilities.RegistryStore); shared {
+		runnerRegistry.Store = store
+	}
+}
+
+// Set labels for this runner so it can pick the signals they match
+func setLabels(runner entities.Runner, labels []string) (entities.Runner, error) {
+	runner.Labels = labels
+	if err := runnerRegistry.Register(runner); err != nil {
+		return runner, err
+	}
+	return runner, nil
+}
+
+func execute(ctx context.Context, signal entities.Signal, actionHandler utilities.ActionHandler, logger *slog.Logger) (int, error) {
+	actionRunner, runsItself := actionHandler.(utilities.ActionRunner)
+	if signal.ExecutablePath == "" && !runsItself {
+		logger.Info("no executable to run")
+		fmt.Printf("%s has no executable to run\n", signal.Sender)
+		return 0, nil
+	}
+
+	if err := runStore.Prepare(signal.Id); err != nil {
+		return 1, err
+	}
+	if err := runStore.ResetOutputs(signal.Id); err != nil {
+		return 1, err
+	}
+
+	// Outputs are published as "key=value" lines appended to the
+	// SCRIPTER_OUTPUTS file
+	environment := map[string]string{"SCRIPTER_OUTPUTS": runStore.OutputsPath(signal.Id)}
+	for key, value := range signal.EnvironmentVariables {
+		environment[key] = value
+	}
+	spec := utilities.ProcessSpec{
+		Path:             signal.ExecutablePath,
+		Arguments:        signal.Arguments,
+		Environment:      environment,
+		WorkingDirectory: signal.WorkingDirectory,
+		Stdout:           os.Stdout,
+		Stderr:           os.Stderr,
+		Shutdown:         signal.ShutdownSignal,
+		GracePeriod:      signal.ShutdownGracePeriod,
+		Logger:           logger,
+	}
+	// The action type decides what is actually started. In a container the
+	// executable is the one of the image, nothing of the host is looked up.
+	inContainer := containerRunner.Runs(signal) && !runsItself
+	if !inContainer {
+		var err error
+		spec, err = actionHandler.Prepare(signal, spec)
+		if err != nil {
+			return 1, err
+		}
+	}
+	switch signal.Stdin {
+	case "":
+	case "-":
+		spec.Stdin = os.Stdin
+	default:
+		stdin, err := os.Open(signal.Stdin)
+		if err != nil {
+			return 1, fmt.Errorf("failed to open stdin of %s: %w", signal.Sender, err)
+		}
+		defer stdin.Close()
+		spec.Stdin = stdin
+	}
+
+	var result entities.ProcessResult
+	var err error
+	switch {
+	case runsItself:
+		result, err = actionRunner.RunAction(ctx, signal, spec)
+	case inContainer:
+		result, err = containerRunner.Run(ctx, signal, spec)
+	default:
+		result, err = processRunner.Run(ctx, spec)
+	}
+	if saveErr := runStore.SaveProcess(signal.Id, result); saveErr != nil {
+		logger.Warn("process not saved", "error", saveErr)
+	}
+
+	subject := signal.ExecutablePath
+	if runsItself {
+		subject = signal.Api
+	}
+	logger.Info("process finished", "path", subject, "pid", result.Pid, "container", result.Container, "exit-code", result.ExitCode, "detached", result.Detached)
+	fmt.Printf("%s finished with %s\n", subject, processRunner.Describe(result))
+	return result.ExitCode, err
 }
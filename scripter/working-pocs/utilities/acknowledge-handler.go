@@ -0,0 +1,158 @@
+package utilities
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"scripter/entities"
+	"strings"
+	"time"
+)
+
+const (
+	AcknowledgeReceived = "received"
+	AcknowledgeStarted  = "started"
+	AcknowledgeFinished = "finished"
+)
+
+const acknowledgeTopicPrefix = "scripter.ack."
+
+// AcknowledgeHandler reports the progress of a signal back to the quay that
+// originated it, when that quay asked for it through RequireAcknowledge.
+type AcknowledgeHandler struct {
+	Broker Broker
+}
+
+// AcknowledgeTopic announces the signals a quay triggered, with their
+// received acknowledgement, for whoever waits on any of them.
+func AcknowledgeTopic(quayName string, processName string) string {
+	return acknowledgeTopicPrefix + quayName + "." + processName
+}
+
+// acknowledgeTopicExpiry is how long a broker keeps an acknowledgement topic
+// nobody publishes to or subscribes to, for those whoever waited on them gave
+// up on before deleting them.
+const acknowledgeTopicExpiry = 24 * time.Hour
+
+// topicExpiry is the time a topic is kept unused, 0 for a topic kept until
+// it is deleted.
+func topicExpiry(topic string) time.Duration {
+	if strings.HasPrefix(topic, acknowledgeTopicPrefix) {
+		return acknowledgeTopicExpiry
+	}
+	return 0
+}
+
+// AcknowledgeSignalTopic carries every acknowledgement of one signal, so
+// whoever waits on it never receives, and has to hand back, those of others.
+func AcknowledgeSignalTopic(quayName string, processName string, signalId string) string {
+	return AcknowledgeTopic(quayName, processName) + ".signal." + signalId
+}
+
+func (acknowledgeHandler AcknowledgeHandler) Acknowledge(signal entities.Signal, status string, exitCode *int, message string) error {
+	if !signal.OriginatorQuay.RequireAcknowledge {
+		return nil
+	}
+	if acknowledgeHandler.Broker == nil {
+		return fmt.Errorf("no broker configured to acknowledge %s", signal.OriginatorQuay.Name)
+	}
+
+	acknowledgement := entities.Acknowledgement{
+		SignalId:    signal.Id,
+		Quay:        signal.OriginatorQuay.Name,
+		ProcessName: signal.OriginatorQuay.ProcessName,
+		Sender:      signal.Sender,
+		Status:      status,
+		ExitCode:    exitCode,
+		Message:     message,
+		Time:        time.Now().UTC(),
+	}
+	body, err := json.Marshal(acknowledgement)
+	if err != nil {
+		return fmt.Errorf("failed to encode acknowledgement: %w", err)
+	}
+
+	brokerMessage := entities.BrokerMessage{Id: signal.Id + "." + status, Body: body}
+	if status == AcknowledgeReceived {
+		topic := AcknowledgeTopic(signal.OriginatorQuay.Name, signal.OriginatorQuay.ProcessName)
+		if err := acknowledgeHandler.Broker.Publish(context.Background(), topic, brokerMessage); err != nil {
+			return err
+		}
+	}
+	topic := AcknowledgeSignalTopic(signal.OriginatorQuay.Name, signal.OriginatorQuay.ProcessName, signal.Id)
+	return acknowledgeHandler.Broker.Publish(context.Background(), topic, brokerMessage)
+}
+
+// WaitForAcknowledge blocks until the signal reports it finished or the timeout
+// expires. An empty signalId accepts the first signal the quay announces.
+// Every intermediate acknowledgement is passed to onProgress when it is set.
+// The topic of the signal is deleted once the wait is over, nobody else reads
+// it.
+func (acknowledgeHandler AcknowledgeHandler) WaitForAcknowledge(quayName string, processName string, signalId string, timeout time.Duration, onProgress func(entities.Acknowledgement)) (entities.Acknowledgement, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if signalId == "" {
+		announced, err := acknowledgeHandler.first(ctx, AcknowledgeTopic(quayName, processName), quayName, timeout)
+		if err != nil {
+			return entities.Acknowledgement{}, err
+		}
+		signalId = announced.SignalId
+	}
+
+	topic := AcknowledgeSignalTopic(quayName, processName, signalId)
+	defer acknowledgeHandler.Broker.DeleteTopic(context.Background(), topic)
+
+	// One subscription reads every acknowledgement, a consumer cancelled in
+	// between could keep those delivered to it from the next one
+	deliveries, err := acknowledgeHandler.Broker.Subscribe(ctx, topic)
+	if err != nil {
+		return entities.Acknowledgement{}, err
+	}
+	for {
+		acknowledgement, err := acknowledgeHandler.next(ctx, deliveries, quayName, timeout)
+		if err != nil {
+			return entities.Acknowledgement{}, err
+		}
+		if onProgress != nil {
+			onProgress(acknowledgement)
+		}
+		if acknowledgement.Status == AcknowledgeFinished {
+			return acknowledgement, nil
+		}
+	}
+}
+
+// first takes the first acknowledgement of the topic on a subscription of its
+// own.
+func (acknowledgeHandler AcknowledgeHandler) first(ctx context.Context, topic string, quayName string, timeout time.Duration) (entities.Acknowledgement, error) {
+	subscriptionCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	deliveries, err := acknowledgeHandler.Broker.Subscribe(subscriptionCtx, topic)
+	if err != nil {
+		return entities.Acknowledgement{}, err
+	}
+	return acknowledgeHandler.next(ctx, deliveries, quayName, timeout)
+}
+
+// next takes the next acknowledgement delivered, dropping what cannot be read
+// as one.
+func (acknowledgeHandler AcknowledgeHandler) next(ctx context.Context, deliveries <-chan entities.BrokerMessage, quayName string, timeout time.Duration) (entities.Acknowledgement, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return entities.Acknowledgement{}, fmt.Errorf("no acknowledgement from %s within %s", quayName, timeout)
+		case message, open := <-deliveries:
+			if !open {
+				return entities.Acknowledgement{}, fmt.Errorf("acknowledgement subscription to %s closed", quayName)
+			}
+			var acknowledgement entities.Acknowledgement
+			if err := json.Unmarshal(message.Body, &acknowledgement); err != nil {
+				acknowledgeHandler.Broker.Nack(ctx, message, false)
+				continue
+			}
+			acknowledgeHandler.Broker.Ack(ctx, message)
+			return acknowledgement, nil
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package utilities
+
+import (
+	"scripter/entities"
+	"testing"
+	"time"
+)
+
+func TestWaitForAcknowledgeReadsEveryStatusThenDeletesTheTopic(t *testing.T) {
+	broker := NewMemoryBroker()
+	handler := AcknowledgeHandler{Broker: broker}
+	signal := entities.Signal{Id: "run-1", Sender: "deploy", OriginatorQuay: entities.OriginatorQuay{Name: "release", ProcessName: "ship", RequireAcknowledge: true}}
+	exitCode := 0
+	for _, status := range []string{AcknowledgeReceived, AcknowledgeStarted} {
+		if err := handler.Acknowledge(signal, status, nil, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := handler.Acknowledge(signal, AcknowledgeFinished, &exitCode, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	progress := []string{}
+	acknowledgement, err := handler.WaitForAcknowledge("release", "ship", "", time.Second, func(acknowledgement entities.Acknowledgement) {
+		progress = append(progress, acknowledgement.Status)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acknowledgement.SignalId != "run-1" || acknowledgement.ExitCode == nil || *acknowledgement.ExitCode != 0 {
+		t.Errorf("acknowledgement %+v, want run-1 finished with 0", acknowledgement)
+	}
+	if len(progress) != 3 || progress[2] != AcknowledgeFinished {
+		t.Errorf("progress %v, want received, started and finished", progress)
+	}
+	topic := AcknowledgeSignalTopic("release", "ship", "run-1")
+	if _, exists := broker.queues[topic]; exists {
+		t.Errorf("topic %s kept after the wait", topic)
+	}
+}
+
+func TestWaitForAcknowledgeTimesOut(t *testing.T) {
+	handler := AcknowledgeHandler{Broker: NewMemoryBroker()}
+	if _, err := handler.WaitForAcknowledge("release", "ship", "run-1", 50*time.Millisecond, nil); err == nil {
+		t.Error("wait without acknowledgement succeeded")
+	}
+}
+
+func TestTopicExpiryCoversAcknowledgementTopicsAlone(t *testing.T) {
+	if topicExpiry(AcknowledgeSignalTopic("release", "ship", "run-1")) == 0 {
+		t.Error("acknowledgement topic of a signal never expires")
+	}
+	if topicExpiry(SignalTopic) != 0 {
+		t.Error("signal topic expires")
+	}
+}
@@ -1,26 +1,15 @@
 package utilities
 
 import (
-	"archive/tar"
-	"bytes"
 	"context"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"scripter/entities"
 	"strings"
+	"time"
 
-	"github.com/docker/docker/api/types/build"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/image" // New import for image-specific types
-	"github.com/docker/docker/client"
-	"github.com/docker/docker/pkg/jsonmessage"
-	"github.com/docker/docker/pkg/stdcopy"
-	"github.com/moby/go-archive"
-	mobyterm "github.com/moby/term"
 	xterm "golang.org/x/term"
 )
 
@@ -37,20 +26,16 @@ type ActionConfiguration struct {
 	}
 	Type             string
 	PackageInstaller string
+	Images           ContainerImageBuilder // Builds the images of containerized signals, in its runtime
 }
 
-var feasiblePackInstallersInMac = []string{
-	"homebrew",
-}
+var retryRunner = RetryRunner{}
 
-var feasiblePackInstallersInLinux = []string{
-	"apt",
-	"yum",
-}
+// SCRIPTER_LOCK_FILE=none turns locking off.
+var installPlanner = InstallPlanner{Lock: DependencyLock{Path: LockFilePath()}}
 
-var feasiblePackInstallersInWindows = []string{
-	"chocolatey",
-}
+// SCRIPTER_INSTALL_APPROVAL=prompt asks before installing anything.
+var installApproval = os.Getenv("SCRIPTER_INSTALL_APPROVAL")
 
 func (configuration ActionConfiguration) SetConfigurationFromSignal(signal entities.Signal) ActionConfiguration {
 	configuration.HostOs = signal.HostOs
@@ -61,124 +46,120 @@ func (configuration ActionConfiguration) SetConfigurationFromSignal(signal entit
 	return configuration
 }
 
-func setSignalAction(signal entities.Signal) {
-	installDependencies(signal)
+func setSignalAction(signal entities.Signal, images ContainerImageBuilder, logger *slog.Logger) error {
+	return installDependencies(signal, images, logger)
 }
 
-func (configuration ActionConfiguration) SetGeneralConfiguration(signal entities.Signal) {
+func (configuration ActionConfiguration) SetGeneralConfiguration(signal entities.Signal, logger *slog.Logger) error {
 	if !checkConfigurationPlatformCombination(configuration) {
-		panic("Host/signal OS combination, signal type, or package installer not feasible (Currenltly only handling one virtualization level per signal)!")
+		return fmt.Errorf("host/signal OS combination, signal type, or package installer of %s not feasible (currently only handling one virtualization level per signal)", signal.Sender)
 	}
-	setSignalAction(signal)
+	return setSignalAction(signal, configuration.Images, logger)
 }
 
 func checkConfigurationPlatformCombination(configuration ActionConfiguration) bool {
 	if configuration.HostOs == "darwin" && configuration.SignalOs == "windows" && configuration.Containerize {
 		return false
 	}
-	if configuration.HostOs == "darwin" && !stringHandler.ContainsString(feasiblePackInstallersInMac, configuration.PackageInstaller) && !configuration.Containerize {
-		return false
-	}
-	if configuration.HostOs == "linux" && !stringHandler.ContainsString(feasiblePackInstallersInLinux, configuration.PackageInstaller) {
-		return false
+	// A container on a Linux host runs Linux as well, so the installer must
+	// run on Linux whether it installs on the host or in the image
+	if configuration.HostOs == "linux" || !configuration.Containerize {
+		installer, err := GetPackageInstaller(configuration.PackageInstaller)
+		if err != nil || !installer.RunsOn(configuration.HostOs) {
+			return false
+		}
 	}
 	if configuration.HostOs == "linux" && configuration.SignalOs == "windows" && configuration.Containerize {
 		return false
 	}
-	if configuration.HostOs == "windows" && !stringHandler.ContainsString(feasiblePackInstallersInWindows, configuration.PackageInstaller) && !configuration.Containerize {
-		return false
-	}
-	if configuration.Type == "ui-window-program" && configuration.Containerize {
+	if configuration.Type == ActionTypeUiWindowProgram && configuration.Containerize {
 		return false
 	}
 	return true
 }
 
-func installDependencies(signal entities.Signal) {
-	logFileName := "package_installer.log"
-	logFile, err := os.OpenFile(logFileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		fmt.Printf("Error opening log file: %v\n", err)
-		return
+// installDependencies plans the installation first, so it can be approved
+// before anything changes.
+func installDependencies(signal entities.Signal, images ContainerImageBuilder, logger *slog.Logger) error {
+	plan := installPlanner.Plan(context.Background(), signal)
+	switch installApproval {
+	case "", InstallApprovalAuto:
+	case InstallApprovalPrompt:
+		if installPlanner.HasChanges(plan) && !installPlanner.Approve(plan) {
+			logger.Warn("installation plan not approved")
+			return fmt.Errorf("installation plan of %s was not approved", signal.Sender)
+		}
+	default:
+		return fmt.Errorf("unknown SCRIPTER_INSTALL_APPROVAL %q: choose auto or prompt", installApproval)
 	}
-	defer logFile.Close()
-
-	log.SetOutput(logFile)
-	log.SetPrefix("INSTALL: ")
-	log.SetFlags(log.Ldate | log.Ltime)
 
-	installOsDependencies(signal)
+	if err := installOsDependencies(signal, plan, images, logger); err != nil {
+		return err
+	}
 
-	log.Println("Dependency check and installation complete.")
-	fmt.Println("Dependency check and installation complete. See brew_install.log for details.")
+	logger.Info("dependency check and installation complete")
+	fmt.Println("Dependency check and installation complete.")
+	return nil
 }
 
-func installOsDependencies(signal entities.Signal) {
+func installOsDependencies(signal entities.Signal, plan entities.InstallPlan, images ContainerImageBuilder, logger *slog.Logger) error {
 	if signal.HostOs == "darwin" {
-		installDependenciesOnMac(signal.InstallationDependencies, signal.Containerize)
-		return
+		return installDependenciesOnMac(signal, plan, images, logger)
 	}
 	if signal.HostOs == "windows" {
-		installDependenciesOnWindows(signal.InstallationDependencies, signal.Containerize, signal.SignalOs)
-		return
+		return installDependenciesOnWindows(signal, plan, images, logger)
 	}
 	if signal.HostOs == "linux" {
-		installDependenciesOnLinux(signal.InstallationDependencies, signal.Containerize)
-		return
-
+		return installDependenciesOnLinux(signal, plan, images, logger)
 	}
+	return nil
 }
 
-func installDependenciesOnLinux(dependencies []string, containerize bool) {
-	if containerize {
-		installDependenciesOnLinuxContainer()
-		return
-	}
+// installWithPolicy retries a dependency install under the installation policy
+// of the signal and logs every attempt.
+func installWithPolicy(dependency string, policy entities.ExecutionPolicy, logger *slog.Logger, install func(ctx context.Context) error) error {
+	_, err := retryRunner.Run(context.Background(), policy, logger, func(ctx context.Context) (int, error) {
+		err := install(ctx)
+		return ExitCodeOf(err), err
+	}, func(attempt entities.Attempt) {
+		logger.Info("install attempt finished", "dependency", dependency, "attempt", attempt.Number, "exit-code", attempt.ExitCode, "duration", attempt.FinishTime.Sub(attempt.StartTime).Round(time.Millisecond).String())
+	})
+	return err
+}
 
-	for _, dep := range dependencies {
-		if !isInstalledOnLinux(dep) {
-			log.Printf("%s is not installed. Proceeding with installation...\n", dep)
-			err := installDependencyOnLinux(dep)
-			if err != nil {
-				log.Printf("Failed to install %s.\n", dep)
-			}
-		}
+func installDependenciesOnLinux(signal entities.Signal, plan entities.InstallPlan, images ContainerImageBuilder, logger *slog.Logger) error {
+	if signal.Containerize {
+		return installDependenciesOnLinuxContainer(signal, images, logger)
 	}
+
+	return installPlanner.Apply(plan, signal.InstallationPolicy, logger)
 }
 
-func installDependenciesOnWindows(dependencies []string, containerize bool, signalOs string) {
-	if containerize && signalOs == "linux" {
-		installDependenciesOnLinuxContainer()
-		return
+func installDependenciesOnWindows(signal entities.Signal, plan entities.InstallPlan, images ContainerImageBuilder, logger *slog.Logger) error {
+	if signal.Containerize && signal.SignalOs == "linux" {
+		return installDependenciesOnLinuxContainer(signal, images, logger)
 	}
-	if containerize && signalOs == "windows" {
-		installDependenciesOnWindowsContainer(dependencies, true)
-		return
-	}
-
-	for _, dep := range dependencies {
-		if !isInstalledOnWindows(dep) {
-			log.Printf("%s is not installed. Proceeding with installation...\n", dep)
-			err :=
-				installDependencyOnWindows(dep, true, false)
-			if err != nil {
-				log.Printf("Failed to install %s.\n", dep)
-			}
+	if signal.Containerize && signal.SignalOs == "windows" {
+		runtime, err := images.ContainerRuntime()
+		if err != nil {
+			return fmt.Errorf("cannot install dependencies of %s in a container: %w", signal.Sender, err)
 		}
+		return installDependenciesOnWindowsContainer(runtime, DependencyNames(signal.InstallationDependencies), true, logger)
 	}
+
+	return installPlanner.Apply(plan, signal.InstallationPolicy, logger)
 }
 
-func installDependenciesOnWindowsContainer(dependencies []string, preinstall bool) {
+func installDependenciesOnWindowsContainer(runtime ContainerRuntime, dependencies []string, preinstall bool, logger *slog.Logger) error {
 	if !preinstall {
-		runWindowsContainer(dependencies)
-		return
+		return runWindowsContainer(runtime, dependencies, logger)
 	}
 	// Generate the Dockerfile content
 	dockerfileContent, err := generateDockerfile("windows", dependencies)
 	if err != nil {
-		log.Fatalf("Failed to generate Dockerfile: %v", err)
+		return fmt.Errorf("failed to generate Dockerfile: %w", err)
 	}
-	fmt.Println("\nGenerated Dockerfile:\n", dockerfileContent)
+	logger.Info("dockerfile generated", "dockerfile", dockerfileContent)
 
 	// Define a consistent container name
 	// containerName := fmt.Sprintf("my-dev-container-%s", "windows")
@@ -188,87 +169,56 @@ func installDependenciesOnWindowsContainer(dependencies []string, preinstall boo
 	// 	log.Fatalf("Failed to build and run container: %v", err)
 	// }
 
-	fmt.Println("Go program finished.")
+	return nil
 }
 
-func runWindowsContainer(dependencies []string) {
+func runWindowsContainer(runtime ContainerRuntime, dependencies []string, logger *slog.Logger) error {
 	ctx := context.Background()
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	if err != nil {
-		log.Fatalf("Failed to create Docker client: %v", err)
-	}
-	defer cli.Close()
 
 	// Use a common Windows Server Core image. Nano Server is smaller but might lack some tools.
 	// You might need to pick a specific tag like :ltsc2022 or :20H2 depending on your host OS.
 	imageName := "mcr.microsoft.com/windows/servercore:ltsc2022"
 	containerName := "my-windows-dev-interactive"
 
-	fmt.Printf("Attempting to provision Windows container '%s' with dependencies: %s\n", containerName, strings.Join(dependencies, ", "))
-	fmt.Printf("!!! Ensure you are running on a Windows host with Docker Desktop in Windows Container mode. !!!\n")
+	// Windows containers only run on a Windows host with Docker in Windows
+	// container mode
+	logger.Info("provisioning windows container", "container", containerName, "dependencies", strings.Join(dependencies, ", "))
 
 	// --- Step 1: Pre-check and Clean Up Existing Container ---
-	_, err = cli.ContainerInspect(ctx, containerName)
-	if err == nil {
-		fmt.Printf("Container '%s' already exists. Stopping and removing...\n", containerName)
-		timeout := 5
-		if err := cli.ContainerStop(ctx, containerName, container.StopOptions{Timeout: &timeout}); err != nil {
-			log.Printf("Warning: Failed to stop existing container '%s': %v. Attempting to remove anyway.", containerName, err)
-		}
-		if err := cli.ContainerRemove(ctx, containerName, container.RemoveOptions{}); err != nil {
-			log.Fatalf("Failed to remove existing container '%s': %v", containerName, err)
-		}
-		fmt.Printf("Existing container '%s' removed.\n", containerName)
+	if err := replaceContainer(ctx, runtime, containerName, logger); err != nil {
+		return err
 	}
 
 	// --- Step 2: Pull Image ---
-	fmt.Printf("Attempting to pull image '%s'...\n", imageName)
-	reader, err := cli.ImagePull(ctx, imageName, image.PullOptions{})
-	if err != nil {
-		log.Fatalf("Failed to pull image '%s': %v", imageName, err)
-	}
-	defer reader.Close()
-	// Windows container pull output might not use multiplexing, so stdcopy might not be strictly necessary
-	// but it's generally safe to use.
-	if _, err := stdcopy.StdCopy(os.Stdout, os.Stderr, reader); err != nil {
-		log.Printf("Warning: Error streaming image pull output: %v", err)
-	}
-	fmt.Printf("Successfully pulled image '%s'\n", imageName)
-
-	// --- Step 3: Container Configuration for Interactive Session ---
-	config := &container.Config{
-		Image:        imageName,
-		Tty:          true, // Allocate a TTY (behavior may vary compared to Linux)
-		OpenStdin:    true, // Keep STDIN open
-		AttachStdout: true, // Attach stdout
-		AttachStderr: true, // Attach stderr
-		// For Windows, default shell is cmd.exe. We start powershell.exe for more flexibility.
-		Cmd: []string{"powershell.exe"},
-	}
-
-	hostConfig := &container.HostConfig{
-		// No specific host config needed for simple interactive use
+	logger.Info("pulling image", "image", imageName)
+	if err := runtime.Pull(ctx, imageName, os.Stdout); err != nil {
+		return err
 	}
+	logger.Info("image pulled", "image", imageName)
 
-	// --- Step 4: Create and Start Container ---
-	resp, err := cli.ContainerCreate(ctx, config, hostConfig, nil, nil, containerName)
+	// --- Step 3: Create and Start Container for an Interactive Session ---
+	// For Windows, default shell is cmd.exe. We start powershell.exe for more flexibility.
+	containerId, err := runtime.Create(ctx, ContainerSpec{
+		Name:      containerName,
+		Image:     imageName,
+		Command:   []string{"powershell.exe"},
+		Tty:       true,
+		OpenStdin: true,
+	})
 	if err != nil {
-		log.Fatalf("Failed to create container '%s': %v", containerName, err)
+		return err
 	}
-	fmt.Printf("Successfully created container with ID: %s\n", resp.ID)
+	logger.Info("container created", "container", containerName, "container-id", containerId)
 
-	if err := cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
-		log.Fatalf("Failed to start container '%s': %v", containerName, err)
+	if err := runtime.Start(ctx, containerId); err != nil {
+		return err
 	}
-	fmt.Printf("Successfully started container '%s'\n", containerName)
+	logger.Info("container started", "container", containerName)
 
-	// --- Step 5: Install Dependencies via Exec ---
+	// --- Step 4: Install Dependencies via Exec ---
 	// For Windows, installing dependencies often involves different commands.
 	// We'll use a simple PowerShell command. `winget` is often not in base images.
-	// For example, to install a feature or a specific package.
-	// For this example, we'll simulate a simple "installation" command.
 	// Real-world Windows package management (like chocolatey or direct MSIs) is more complex.
-	fmt.Println("\n--- Installing Dependencies ---")
 	// Example: Create a directory and a file.
 	// Real dependencies might involve `dism` for Windows features or specific installers.
 	commands := []string{
@@ -279,237 +229,107 @@ func runWindowsContainer(dependencies []string) {
 	}
 
 	for _, cmd := range commands {
-		fmt.Printf("Executing command in container: %s\n", cmd)
-		execConfig := container.ExecOptions{
-			User:         "ContainerAdministrator", // Typical user for Windows containers
-			Privileged:   false,
-			Tty:          true, // Use TTY for clearer output
-			AttachStdout: true,
-			AttachStderr: true,
-			Cmd:          []string{"powershell.exe", "-Command", cmd}, // Use PowerShell to execute
-		}
-
-		execResp, err := cli.ContainerExecCreate(ctx, resp.ID, execConfig)
-		if err != nil {
-			log.Fatalf("Failed to create exec command for '%s': %v", cmd, err)
-		}
-
-		attachResp, err := cli.ContainerExecAttach(ctx, execResp.ID, container.ExecAttachOptions{})
-		if err != nil {
-			log.Fatalf("Failed to attach to exec command for '%s': %v", cmd, err)
-		}
-		// Windows container output might not be multiplexed, so io.Copy might be more direct.
-		// However, stdcopy.StdCopy is resilient.
-		if _, err := io.Copy(os.Stdout, attachResp.Reader); err != nil { // Directly copy to stdout
-			log.Printf("Warning: Error streaming output for command '%s': %v", cmd, err)
-		}
-		attachResp.Close()
-
-		exitCodeResp, err := cli.ContainerExecInspect(ctx, execResp.ID)
+		logger.Info("executing command in container", "command", cmd)
+		exitCode, err := runtime.Exec(ctx, containerId, ContainerExec{
+			Command: []string{"powershell.exe", "-Command", cmd},
+			User:    "ContainerAdministrator", // Typical user for Windows containers
+			Tty:     true,
+			Stdout:  os.Stdout,
+			Stderr:  os.Stderr,
+		})
 		if err != nil {
-			log.Fatalf("Error inspecting exec command for '%s': %v", cmd, err)
+			return err
 		}
-		if exitCodeResp.ExitCode != 0 {
-			log.Fatalf("Command '%s' failed with exit code: %d", cmd, exitCodeResp.ExitCode)
+		if exitCode != 0 {
+			return fmt.Errorf("command %q failed with exit code %d", cmd, exitCode)
 		}
-		fmt.Printf("Successfully executed command: %s\n", cmd)
 	}
 
-	fmt.Println("\n--- Dependencies Provisioned. Attaching to Windows Container. ---")
+	logger.Info("dependencies provisioned, attaching to container", "container", containerName)
 	fmt.Println("Type 'exit' to detach from the container (container will remain running).")
 
-	// --- Step 6: Attach to the Container's Primary Process (Interactive Shell) ---
-	oldState, err := xterm.MakeRaw(int(os.Stdin.Fd()))
-	if err != nil {
-		log.Fatalf("Failed to set terminal to raw mode: %v", err)
-	}
-	defer func() {
-		fmt.Println("\n--- Detaching from container. Restoring terminal state. ---")
-		xterm.Restore(int(os.Stdin.Fd()), oldState)
-	}()
-
-	width, height, err := xterm.GetSize(int(os.Stdout.Fd()))
-	if err != nil {
-		log.Printf("Warning: Failed to get terminal size: %v. Using default.", err)
-		width, height = 80, 24
-	}
-
-	// Windows containers might have specific attach options or behaviors for TTY/Stdin/Stdout.
-	// The `AttachOptions` are generally the same.
-	attachOptions := container.AttachOptions{
-		Stream:     true,
-		Stdin:      true,
-		Stdout:     true,
-		Stderr:     true,
-		Logs:       false,
-		DetachKeys: "ctrl-p,ctrl-q", // Standard Docker detach keys
-	}
-
-	hijackedResp, err := cli.ContainerAttach(ctx, resp.ID, attachOptions)
-	if err != nil {
-		log.Fatalf("Failed to attach to container: %v", err)
-	}
-	defer hijackedResp.Close()
-
-	// Goroutine to copy container stdout/stderr to os.Stdout/Stderr
-	// For Windows, often direct io.Copy is used as streams might not be multiplexed by default.
-	go func() {
-		_, err := io.Copy(os.Stdout, hijackedResp.Reader)
-		if err != nil {
-			// This error can often be an EOF when the container exits, which is normal.
-			// log.Printf("Error copying stdout from container: %v", err)
-		}
-	}()
-
-	// Goroutine to copy os.Stdin to container stdin
-	go func() {
-		_, err := io.Copy(hijackedResp.Conn, os.Stdin)
-		if err != nil {
-			// This error can often be an EOF when your program terminates or connection closes.
-			// log.Printf("Error copying stdin to container: %v", err)
-		}
-	}()
-
-	// Initial resize call
-	cli.ContainerResize(ctx, resp.ID, container.ResizeOptions{Width: uint(width), Height: uint(height)})
-
-	// Block indefinitely to keep the interactive session open.
-	select {}
+	// --- Step 5: Attach to the Container's Primary Process (Interactive Shell) ---
+	return attachTerminal(ctx, runtime, containerId, logger)
 }
 
-func installDependenciesOnMac(dependencies []string, containerize bool) {
-	if containerize {
-		installDependenciesOnLinuxContainer()
-		return
+func installDependenciesOnMac(signal entities.Signal, plan entities.InstallPlan, images ContainerImageBuilder, logger *slog.Logger) error {
+	if signal.Containerize {
+		return installDependenciesOnLinuxContainer(signal, images, logger)
 	}
 
-	for _, dep := range dependencies {
-		if !isInstalledOnMac(dep) {
-			log.Printf("%s is not installed. Proceeding with installation...\n", dep)
-			err := installDependencyOnMac(dep)
-			if err != nil {
-				log.Printf("Failed to install %s.\n", dep)
-			}
-		}
-	}
+	return installPlanner.Apply(plan, signal.InstallationPolicy, logger)
 }
 
-func installDependencyOnLinux(dep string) any {
-	fmt.Printf("Installing %s with real-time verbose output...\n", dep)
-	cmd := exec.Command("sudo", "apt", "install", dep, "-y")
-
-	cmd.Stdout = os.Stdout // Connect brew's stdout to Go's stdout (your terminal)
-	cmd.Stderr = os.Stderr // Connect brew's stderr to Go's stderr (your terminal)
-
-	err := cmd.Run() // Use Run() instead of CombinedOutput()
-	if err != nil {
-		fmt.Printf("Error installing %s: %v\n", dep, err)
-		return err
-	}
-	fmt.Printf("%s installation finished.\n", dep)
-	return nil
+// LockFilePath is where installed versions and base image digests are locked,
+// empty when locking is off.
+func LockFilePath() string {
+	path := os.Getenv("SCRIPTER_LOCK_FILE")
+	switch path {
+	case "":
+		return "scripter.lock"
+	case "none":
+		return ""
+	}
+	return path
 }
 
-func buildAndRunContainer(containerName, dockerfilePath string) error {
+func buildAndRunContainer(runtime ContainerRuntime, containerName, dockerfilePath string, logger *slog.Logger) error {
 	ctx := context.Background()
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	if err != nil {
-		return fmt.Errorf("failed to create Docker client: %w", err)
-	}
-	defer cli.Close()
 
 	imageTag := strings.ToLower(containerName + ":latest")
 
 	// --- Step 1: Read the Dockerfile content from the file system ---
-	fmt.Printf("Reading Dockerfile from: %s\n", dockerfilePath)
 	dockerfileBytes, err := os.ReadFile(dockerfilePath)
 	if err != nil {
 		return fmt.Errorf("failed to read Dockerfile: %w", err)
 	}
 
-	// --- Step 2: Create an in-memory tar archive with the Dockerfile ---
-	fmt.Println("Creating in-memory Docker build context...")
-	buf := new(bytes.Buffer)
-	tw := tar.NewWriter(buf)
-
-	header := &tar.Header{
-		Name: "Dockerfile",
-		Size: int64(len(dockerfileBytes)),
-		Mode: 0600,
-	}
-
-	if err := tw.WriteHeader(header); err != nil {
-		return fmt.Errorf("failed to write tar header: %w", err)
-	}
-	if _, err := tw.Write(dockerfileBytes); err != nil {
-		return fmt.Errorf("failed to write Dockerfile content to tar: %w", err)
-	}
-	if err := tw.Close(); err != nil {
-		return fmt.Errorf("failed to close tar writer: %w", err)
+	// --- Step 2: Build the Image from the Dockerfile alone ---
+	logger.Info("building container image", "image", imageTag, "dockerfile", dockerfilePath)
+	if err := runtime.Build(ctx, ImageSpec{Tag: imageTag, Dockerfile: string(dockerfileBytes)}, os.Stdout); err != nil {
+		return err
 	}
+	logger.Info("container image built", "image", imageTag)
 
-	tarReader := bytes.NewReader(buf.Bytes())
-
-	// --- Step 3: Build the Docker Image from the in-memory tarball ---
-	fmt.Printf("Building Docker image '%s' from in-memory context...\n", imageTag)
-	buildOptions := build.ImageBuildOptions{
-		Tags:       []string{imageTag},
-		Dockerfile: "Dockerfile",
-		Remove:     true, // Clean up intermediate containers
+	// --- Step 3: Clean Up Old Container ---
+	if err := replaceContainer(ctx, runtime, containerName, logger); err != nil {
+		return err
 	}
 
-	buildResponse, err := cli.ImageBuild(ctx, tarReader, buildOptions)
+	// --- Step 4: Run the Custom Image ---
+	containerId, err := runtime.Create(ctx, ContainerSpec{Name: containerName, Image: imageTag, Tty: true, OpenStdin: true})
 	if err != nil {
-		return fmt.Errorf("failed to start image build: %w", err)
-	}
-	defer buildResponse.Body.Close()
-
-	// Stream build output to standard output
-	if _, err := stdcopy.StdCopy(os.Stdout, os.Stderr, buildResponse.Body); err != nil {
-		log.Printf("Warning: Error streaming build output: %v", err)
+		return err
 	}
-	fmt.Printf("Successfully built image '%s'.\n", imageTag)
+	logger.Info("container created", "container", containerName, "container-id", containerId, "image", imageTag)
 
-	// --- Step 4: Clean Up Old Container ---
-	_, err = cli.ContainerInspect(ctx, containerName)
-	if err == nil {
-		fmt.Printf("Container '%s' already exists. Stopping and removing...\n", containerName)
-		timeout := 5
-		if err := cli.ContainerStop(ctx, containerName, container.StopOptions{Timeout: &timeout}); err != nil {
-			log.Printf("Warning: Failed to stop existing container '%s': %v. Attempting to remove anyway.", containerName, err)
-		}
-		if err := cli.ContainerRemove(ctx, containerName, container.RemoveOptions{}); err != nil {
-			return fmt.Errorf("failed to remove existing container '%s': %w", containerName, err)
-		}
-		fmt.Printf("Existing container '%s' removed.\n", containerName)
+	if err := runtime.Start(ctx, containerId); err != nil {
+		return err
 	}
+	logger.Info("container started, attaching to it", "container", containerName)
 
-	// --- Step 5: Run the Custom Image ---
-	fmt.Printf("Creating and starting container '%s' from image '%s'...\n", containerName, imageTag)
-	config := &container.Config{
-		Image:        imageTag,
-		Tty:          true,
-		OpenStdin:    true,
-		AttachStdout: true,
-		AttachStderr: true,
-	}
+	// --- Step 5: Attach to the Container ---
+	fmt.Println("Type 'exit' to detach from the container (container will remain running).")
+	return attachTerminal(ctx, runtime, containerId, logger)
+}
 
-	resp, err := cli.ContainerCreate(ctx, config, &container.HostConfig{}, nil, nil, containerName)
-	if err != nil {
-		return fmt.Errorf("failed to create container '%s': %w", containerName, err)
+// replaceContainer stops and removes the container of that name, if any, so
+// a new one can take its name.
+func replaceContainer(ctx context.Context, runtime ContainerRuntime, containerName string, logger *slog.Logger) error {
+	exists, err := runtime.ContainerExists(ctx, containerName)
+	if err != nil || !exists {
+		return err
 	}
-	fmt.Printf("Successfully created container with ID: %s\n", resp.ID)
-
-	if err := cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
-		return fmt.Errorf("failed to start container '%s': %w", containerName, err)
-
+	logger.Info("container already exists, removing it", "container", containerName)
+	if err := runtime.Stop(ctx, containerName, 5*time.Second); err != nil {
+		logger.Warn("container not stopped, removing it anyway", "container", containerName, "error", err)
 	}
-	fmt.Printf("Successfully started container '%s'\n", containerName)
-
-	// --- Step 6: Attach to the Container ---
-	fmt.Println("\n--- Attaching to Container. Services are now running. ---")
-	fmt.Println("Type 'exit' to detach from the container (container will remain running).")
+	return runtime.Remove(ctx, containerName)
+}
 
+// attachTerminal hands the terminal over to the container until it detaches
+// or its main process ends.
+func attachTerminal(ctx context.Context, runtime ContainerRuntime, containerId string, logger *slog.Logger) error {
 	// Set the terminal to raw mode to handle user input correctly
 	oldState, err := xterm.MakeRaw(int(os.Stdin.Fd()))
 	if err != nil {
@@ -520,155 +340,46 @@ func buildAndRunContainer(containerName, dockerfilePath string) error {
 		xterm.Restore(int(os.Stdin.Fd()), oldState)
 	}()
 
-	// Get the terminal size for resizing
+	// Resize the container's TTY to match the terminal
 	width, height, err := xterm.GetSize(int(os.Stdout.Fd()))
 	if err != nil {
-		log.Printf("Warning: Failed to get terminal size: %v. Using default.", err)
+		logger.Warn("terminal size unknown, using 80x24", "error", err)
 		width, height = 80, 24
 	}
-
-	attachOptions := container.AttachOptions{
-		Stream:     true,
-		Stdin:      true,
-		Stdout:     true,
-		Stderr:     true,
-		Logs:       false,
-		DetachKeys: "ctrl-p,ctrl-q",
-	}
-
-	hijackedResp, err := cli.ContainerAttach(ctx, resp.ID, attachOptions)
-	if err != nil {
-		return fmt.Errorf("failed to attach to container: %w", err)
+	if err := runtime.Resize(ctx, containerId, uint(width), uint(height)); err != nil {
+		logger.Warn("container terminal not resized", "error", err)
 	}
-	defer hijackedResp.Close()
 
-	// Use goroutines to handle stdin/stdout streams
-	go func() {
-		_, err := io.Copy(os.Stdout, hijackedResp.Reader)
-		if err != nil && err != io.EOF {
-			log.Printf("Error copying stdout from container: %v", err)
-		}
-	}()
-
-	go func() {
-		_, err := io.Copy(hijackedResp.Conn, os.Stdin)
-		if err != nil && err != io.EOF {
-			log.Printf("Error copying stdin to container: %v", err)
-		}
-	}()
-
-	// Resize the container's TTY to match the terminal
-	cli.ContainerResize(ctx, resp.ID, container.ResizeOptions{Width: uint(width), Height: uint(uint16(height))})
-
-	// Block the main goroutine to keep the program running
-	select {}
+	return runtime.Attach(ctx, containerId, ContainerStreams{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr})
 }
 
-// installDependenciesOnLinuxContainer sets up a Docker container, installs multiple dependencies,
-// and leaves the container running.
-func installDependenciesOnLinuxContainer() {
-
-	// Build the image and run the container
-
-	dir, err := os.Getwd()
+// installDependenciesOnLinuxContainer builds the image the signal runs in,
+// with its dependencies installed, instead of installing them on the host.
+func installDependenciesOnLinuxContainer(signal entities.Signal, images ContainerImageBuilder, logger *slog.Logger) error {
+	tag, err := images.Build(context.Background(), signal, logger)
 	if err != nil {
-		log.Fatalf("Failed to get current directory: %v", err)
-	}
-
-	// Print the directory
-	fmt.Println("Current directory is:", dir)
-
-	wd, err := os.Getwd()
-	if err != nil {
-		log.Fatalf("Failed to get current working directory: %v", err)
-	}
-	dockerfilePath := filepath.Join(wd, "Dockerfile")
-
-	err = buildImage("calegro-test", dockerfilePath)
-	if err != nil {
-		log.Fatalf("Provisioning failed: %v", err)
-	}
-
-	fmt.Println("Go program finished.")
-}
-
-func buildImage(imageTag, contextPath string) error {
-	ctx := context.Background()
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	if err != nil {
-		return fmt.Errorf("failed to create Docker client: %w", err)
-	}
-	defer cli.Close()
-
-	// --- Step 1: Create a tar archive of the entire build context directory ---
-	fmt.Printf("Creating tar archive of build context: %s\n", contextPath)
-	tarContext, err := archive.TarWithOptions(contextPath, &archive.TarOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to create build context tar: %w", err)
-	}
-	defer tarContext.Close()
-
-	// --- Step 2: Build the Docker Image from the tar archive ---
-	fmt.Printf("Building Docker image '%s'...\n", imageTag)
-	buildOptions := build.ImageBuildOptions{
-		Tags:       []string{imageTag},
-		Dockerfile: "Dockerfile", // This should be the name of the Dockerfile within the context
-		Remove:     true,         // Clean up intermediate containers
-	}
-
-	buildResponse, err := cli.ImageBuild(ctx, tarContext, buildOptions)
-	if err != nil {
-		return fmt.Errorf("failed to start image build: %w", err)
-	}
-	defer buildResponse.Body.Close()
-
-	// --- Step 3: Stream build output ---
-	// This part of your original code is correct for streaming
-	termFd, isTerm := mobyterm.GetFdInfo(os.Stderr)
-	if err := jsonmessage.DisplayJSONMessagesStream(buildResponse.Body, os.Stderr, termFd, isTerm, nil); err != nil {
-		// Use stdcopy if the output is not JSON-formatted (e.g., plain text logs)
-		if _, err := stdcopy.StdCopy(os.Stdout, os.Stderr, buildResponse.Body); err != nil {
-			log.Printf("Warning: Error streaming build output: %v", err)
-		}
+		return err
 	}
-
+	logger.Info("container image ready", "image", tag)
 	return nil
 }
 
-func executeCommand(ctx context.Context, cli *client.Client, containerID string, cmd string) {
-	fmt.Printf("Executing command in container: %s\n", cmd)
-	execConfig := container.ExecOptions{
-		User:         "root",
-		Privileged:   false,
-		Tty:          true,
-		AttachStdout: true,
-		AttachStderr: true,
-		Cmd:          []string{"bash", "-c", cmd},
-	}
-
-	execResp, err := cli.ContainerExecCreate(ctx, containerID, execConfig)
-	if err != nil {
-		log.Fatalf("Failed to create exec command for '%s': %v", cmd, err)
-	}
-
-	attachResp, err := cli.ContainerExecAttach(ctx, execResp.ID, container.ExecAttachOptions{})
-	if err != nil {
-		log.Fatalf("Failed to attach to exec command for '%s': %v", cmd, err)
-	}
-	defer attachResp.Close()
-
-	if _, err := stdcopy.StdCopy(os.Stdout, os.Stderr, attachResp.Reader); err != nil {
-		log.Printf("Warning: Error streaming output for command '%s': %v", cmd, err)
-	}
-
-	exitCodeResp, err := cli.ContainerExecInspect(ctx, execResp.ID)
+func executeCommand(ctx context.Context, runtime ContainerRuntime, containerId string, cmd string, logger *slog.Logger) error {
+	logger.Info("executing command in container", "command", cmd)
+	exitCode, err := runtime.Exec(ctx, containerId, ContainerExec{
+		Command: []string{"bash", "-c", cmd},
+		User:    "root",
+		Tty:     true,
+		Stdout:  os.Stdout,
+		Stderr:  os.Stderr,
+	})
 	if err != nil {
-		log.Fatalf("Error inspecting exec command for '%s': %v", cmd, err)
+		return err
 	}
-	if exitCodeResp.ExitCode != 0 {
-		log.Fatalf("Command '%s' failed with exit code: %d", cmd, exitCodeResp.ExitCode)
+	if exitCode != 0 {
+		return fmt.Errorf("command %q failed with exit code %d", cmd, exitCode)
 	}
-	fmt.Printf("Successfully executed command: %s\n", cmd)
+	return nil
 }
 
 func generateDockerfile(osType string, dependencies []string) (string, error) {
@@ -720,13 +431,8 @@ func generateDockerfile(osType string, dependencies []string) (string, error) {
 }
 
 // buildAndRunContainer builds a custom Docker image and runs a container from it.
-func readAndBuildContainer(containerName, dockerfilePath string) error {
+func readAndBuildContainer(runtime ContainerRuntime, containerName, dockerfilePath string, logger *slog.Logger) error {
 	ctx := context.Background()
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	if err != nil {
-		return fmt.Errorf("failed to create Docker client: %w", err)
-	}
-	defer cli.Close()
 
 	imageTag := strings.ToLower(containerName + ":latest")
 
@@ -736,112 +442,13 @@ func readAndBuildContainer(containerName, dockerfilePath string) error {
 		return fmt.Errorf("failed to read Dockerfile at %s: %w", dockerfilePath, err)
 	}
 
-	// --- Step 2: Create an in-memory tar archive with the Dockerfile ---
-	fmt.Println("Creating in-memory Docker build context...")
-	buf := new(bytes.Buffer)
-	tw := tar.NewWriter(buf)
-
-	header := &tar.Header{
-		Name: "Dockerfile",
-		Size: int64(len(dockerfileBytes)),
-		Mode: 0600,
-	}
-
-	if err := tw.WriteHeader(header); err != nil {
-		return fmt.Errorf("failed to write tar header: %w", err)
-	}
-	if _, err := tw.Write(dockerfileBytes); err != nil {
-		return fmt.Errorf("failed to write Dockerfile content to tar: %w", err)
-	}
-	if err := tw.Close(); err != nil {
-		return fmt.Errorf("failed to close tar writer: %w", err)
-	}
-
-	tarReader := bytes.NewReader(buf.Bytes())
-
-	// --- Step 3: Build the Docker Image from the in-memory tarball ---
-	fmt.Printf("Building Docker image '%s' from in-memory context...\n", imageTag)
-	buildOptions := build.ImageBuildOptions{
-		Tags:       []string{imageTag},
-		Dockerfile: "Dockerfile",
-		Remove:     true, // Clean up intermediate containers
-	}
-
-	buildResponse, err := cli.ImageBuild(ctx, tarReader, buildOptions)
-	if err != nil {
-		return fmt.Errorf("failed to start image build: %w", err)
-	}
-	defer buildResponse.Body.Close()
-
-	// Stream build output to standard output
-	if _, err := stdcopy.StdCopy(os.Stdout, os.Stderr, buildResponse.Body); err != nil {
-		log.Printf("Warning: Error streaming build output: %v", err)
-	}
-	fmt.Printf("Successfully built image '%s'.\n", imageTag)
-
-	return nil
-}
-
-func isInstalledOnLinux(dep string) bool {
-	cmd := exec.Command(dep)
-	if strings.Contains(cmd.Path, "/") {
-		return true
-	}
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return false // Assume not installed if there's an error checking
-	}
-	return strings.Contains(string(output), dep)
-}
-
-func installDependencyOnWindows(dep string, containairize bool, vmize bool) any {
-	fmt.Printf("Installing %s with real-time verbose output...\n", dep)
-	cmd := exec.Command("choco", "install", dep)
-
-	cmd.Stdout = os.Stdout // Connect brew's stdout to Go's stdout (your terminal)
-	cmd.Stderr = os.Stderr // Connect brew's stderr to Go's stderr (your terminal)
-
-	err := cmd.Run() // Use Run() instead of CombinedOutput()
-	if err != nil {
-		fmt.Printf("Error installing %s: %v\n", dep, err)
+	// --- Step 2: Build the Image from the Dockerfile alone ---
+	logger.Info("building container image", "image", imageTag, "dockerfile", dockerfilePath)
+	if err := runtime.Build(ctx, ImageSpec{Tag: imageTag, Dockerfile: string(dockerfileBytes)}, os.Stdout); err != nil {
 		return err
 	}
-	fmt.Printf("%s installation finished.\n", dep)
-	return nil
-}
-
-func isInstalledOnWindows(dep string) bool {
-	cmd := exec.Command("choco", "list", "--versions", dep)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return false // Assume not installed if there's an error checking
-	}
-	return strings.Contains(string(output), dep)
-}
-
-func isInstalledOnMac(dep string) bool {
-	cmd := exec.Command("brew", "list", "--versions", dep)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return false // Assume not installed if there's an error checking
-	}
-	return strings.Contains(string(output), dep)
-}
+	logger.Info("container image built", "image", imageTag)
 
-func installDependencyOnMac(dependency string) error {
-
-	fmt.Printf("Installing %s with real-time verbose output...\n", dependency)
-	cmd := exec.Command("brew", "install", dependency)
-
-	cmd.Stdout = os.Stdout // Connect brew's stdout to Go's stdout (your terminal)
-	cmd.Stderr = os.Stderr // Connect brew's stderr to Go's stderr (your terminal)
-
-	err := cmd.Run() // Use Run() instead of CombinedOutput()
-	if err != nil {
-		fmt.Printf("Error installing %s: %v\n", dependency, err)
-		return err
-	}
-	fmt.Printf("%s installation finished.\n", dependency)
 	return nil
 }
 
@@ -0,0 +1,147 @@
+package utilities
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"scripter/entities"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	ActionTypeExecutable      = "executable"
+	ActionTypeRawProgram      = "raw-program"
+	ActionTypeUiWindowProgram = "ui-window-program"
+	ActionTypeApi             = "api"
+)
+
+// ActionHandler turns the process an action would start into the one it
+// actually starts, given the action type. The process runner runs what it
+// returns.
+type ActionHandler interface {
+	Prepare(signal entities.Signal, spec ProcessSpec) (ProcessSpec, error)
+}
+
+// ActionRunner is a handler whose action is not a process, it runs the
+// action itself in place of the process runner.
+type ActionRunner interface {
+	ActionHandler
+	RunAction(ctx context.Context, signal entities.Signal, spec ProcessSpec) (entities.ProcessResult, error)
+}
+
+// ActionHandlerFunc lets a plain function be registered as a handler.
+type ActionHandlerFunc func(signal entities.Signal, spec ProcessSpec) (ProcessSpec, error)
+
+func (handlerFunc ActionHandlerFunc) Prepare(signal entities.Signal, spec ProcessSpec) (ProcessSpec, error) {
+	return handlerFunc(signal, spec)
+}
+
+var actionHandlers = map[string]ActionHandler{
+	ActionTypeExecutable:      ExecutableHandler{},
+	ActionTypeRawProgram:      RawProgramHandler{},
+	ActionTypeUiWindowProgram: UiWindowProgramHandler{},
+	ActionTypeApi:             ApiHandler{},
+}
+var actionHandlersMutex sync.RWMutex
+
+// RegisterActionHandler adds the handler of a custom action type, or replaces
+// a built-in one.
+func RegisterActionHandler(actionType string, handler ActionHandler) {
+	actionHandlersMutex.Lock()
+	defer actionHandlersMutex.Unlock()
+	actionHandlers[actionType] = handler
+}
+
+// GetActionHandler returns the handler of an action type, an action without
+// one being an executable.
+func GetActionHandler(actionType string) (ActionHandler, error) {
+	if actionType == "" {
+		actionType = ActionTypeExecutable
+	}
+
+	actionHandlersMutex.RLock()
+	defer actionHandlersMutex.RUnlock()
+	handler, exists := actionHandlers[actionType]
+	if !exists {
+		types := []string{}
+		for registered := range actionHandlers {
+			types = append(types, registered)
+		}
+		sort.Strings(types)
+		return nil, fmt.Errorf("unsupported action type %q: choose %s", actionType, strings.Join(types, ", "))
+	}
+	return handler, nil
+}
+
+// ExecutableHandler makes sure the executable exists before anything is
+// started, looking a bare name up in PATH and a path from the working
+// directory.
+type ExecutableHandler struct{}
+
+func (executableHandler ExecutableHandler) Prepare(signal entities.Signal, spec ProcessSpec) (ProcessSpec, error) {
+	if !strings.ContainsRune(spec.Path, '/') && !strings.ContainsRune(spec.Path, filepath.Separator) {
+		path, err := exec.LookPath(spec.Path)
+		if err != nil {
+			return spec, fmt.Errorf("executable %s of %s not found in PATH", spec.Path, signal.Sender)
+		}
+		spec.Path = path
+		return spec, nil
+	}
+
+	path := spec.Path
+	if !filepath.IsAbs(path) && spec.WorkingDirectory != "" {
+		path = filepath.Join(spec.WorkingDirectory, path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return spec, fmt.Errorf("executable %s of %s not found", path, signal.Sender)
+	}
+	if info.IsDir() {
+		return spec, fmt.Errorf("executable %s of %s is a directory", path, signal.Sender)
+	}
+	return spec, nil
+}
+
+// RawProgramHandler starts the program as written, its inputs handed over
+// untouched, for programs that parse them in their own way.
+type RawProgramHandler struct{}
+
+func (rawProgramHandler RawProgramHandler) Prepare(signal entities.Signal, spec ProcessSpec) (ProcessSpec, error) {
+	return spec, nil
+}
+
+// UiWindowProgramHandler runs a program that opens windows. On Linux without
+// a display it runs under a virtual X display (xvfb-run), so it also runs on
+// headless hosts; SCRIPTER_VIRTUAL_DISPLAY=always forces it and never turns
+// it off.
+type UiWindowProgramHandler struct{}
+
+func (uiWindowProgramHandler UiWindowProgramHandler) Prepare(signal entities.Signal, spec ProcessSpec) (ProcessSpec, error) {
+	if runtime.GOOS != "linux" {
+		return spec, nil
+	}
+
+	switch os.Getenv("SCRIPTER_VIRTUAL_DISPLAY") {
+	case "never":
+		return spec, nil
+	case "always":
+	default:
+		if os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != "" {
+			return spec, nil
+		}
+	}
+
+	xvfbRun, err := exec.LookPath("xvfb-run")
+	if err != nil {
+		return spec, fmt.Errorf("%s needs a display: set DISPLAY or install xvfb-run (package xvfb)", signal.Sender)
+	}
+	// -a picks a free display number, so several window programs can run at once
+	spec.Arguments = append([]string{"-a", spec.Path}, spec.Arguments...)
+	spec.Path = xvfbRun
+	return spec, nil
+}
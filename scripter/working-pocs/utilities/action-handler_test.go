@@ -0,0 +1,109 @@
+package utilities
+
+import (
+	"os"
+	"path/filepath"
+	"scripter/entities"
+	"strings"
+	"testing"
+)
+
+func TestGetActionHandlerDefaultsToExecutable(t *testing.T) {
+	handler, err := GetActionHandler("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, isExecutable := handler.(ExecutableHandler); !isExecutable {
+		t.Errorf("handler of an action without a type is %T, want ExecutableHandler", handler)
+	}
+}
+
+func TestGetActionHandlerNamesTheTypesOnOffer(t *testing.T) {
+	_, err := GetActionHandler("teleport")
+	if err == nil {
+		t.Fatal("unknown action type accepted")
+	}
+	for _, actionType := range []string{ActionTypeApi, ActionTypeExecutable, ActionTypeRawProgram, ActionTypeUiWindowProgram} {
+		if !strings.Contains(err.Error(), actionType) {
+			t.Errorf("error %q does not offer %s", err, actionType)
+		}
+	}
+}
+
+func TestRegisterActionHandlerAddsACustomType(t *testing.T) {
+	const actionType = "test-wrapped"
+	RegisterActionHandler(actionType, ActionHandlerFunc(func(signal entities.Signal, spec ProcessSpec) (ProcessSpec, error) {
+		spec.Arguments = append([]string{spec.Path}, spec.Arguments...)
+		spec.Path = "/usr/bin/env"
+		return spec, nil
+	}))
+	t.Cleanup(func() {
+		actionHandlersMutex.Lock()
+		defer actionHandlersMutex.Unlock()
+		delete(actionHandlers, actionType)
+	})
+
+	handler, err := GetActionHandler(actionType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := handler.Prepare(entities.Signal{}, ProcessSpec{Path: "date", Arguments: []string{"-u"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Path != "/usr/bin/env" || strings.Join(spec.Arguments, " ") != "date -u" {
+		t.Errorf("prepared %s %v, want /usr/bin/env [date -u]", spec.Path, spec.Arguments)
+	}
+}
+
+func TestRegisterActionHandlerReplacesABuiltInType(t *testing.T) {
+	replaced := ActionHandlerFunc(func(signal entities.Signal, spec ProcessSpec) (ProcessSpec, error) {
+		spec.Path = "replaced"
+		return spec, nil
+	})
+	actionHandlersMutex.RLock()
+	original := actionHandlers[ActionTypeRawProgram]
+	actionHandlersMutex.RUnlock()
+	RegisterActionHandler(ActionTypeRawProgram, replaced)
+	t.Cleanup(func() { RegisterActionHandler(ActionTypeRawProgram, original) })
+
+	handler, err := GetActionHandler(ActionTypeRawProgram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := handler.Prepare(entities.Signal{}, ProcessSpec{Path: "program"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Path != "replaced" {
+		t.Errorf("built-in raw-program handler still in place, prepared %s", spec.Path)
+	}
+}
+
+func TestExecutableHandlerResolvesPaths(t *testing.T) {
+	directory := t.TempDir()
+	if err := os.WriteFile(filepath.Join(directory, "run.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	signal := entities.Signal{Sender: "test"}
+
+	tests := []struct {
+		name    string
+		spec    ProcessSpec
+		wantErr bool
+	}{
+		{"relative to the working directory", ProcessSpec{Path: "./run.sh", WorkingDirectory: directory}, false},
+		{"absolute", ProcessSpec{Path: filepath.Join(directory, "run.sh")}, false},
+		{"missing", ProcessSpec{Path: "./absent.sh", WorkingDirectory: directory}, true},
+		{"a directory", ProcessSpec{Path: directory}, true},
+		{"a bare name not in PATH", ProcessSpec{Path: "scripter-test-no-such-program"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ExecutableHandler{}.Prepare(signal, test.spec)
+			if (err != nil) != test.wantErr {
+				t.Errorf("Prepare(%s) error = %v, want error %v", test.spec.Path, err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package utilities
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"scripter/entities"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Responses past this size are cut, they are meant to be read by the next steps.
+const maxApiResponseSize = 10 << 20
+
+// ApiHandler runs an action that calls an HTTP endpoint rather than a
+// process. The response is printed and published as the "status" and "body"
+// outputs. A call answered with an unexpected status exits with its class,
+// 4 for a 4xx and 5 for a 5xx, so retry-on can pick server errors alone.
+type ApiHandler struct{}
+
+func (apiHandler ApiHandler) Prepare(signal entities.Signal, spec ProcessSpec) (ProcessSpec, error) {
+	endpoint, err := url.Parse(signal.Api)
+	if err != nil || signal.Api == "" {
+		return spec, fmt.Errorf("%s has no valid api to call: %q", signal.Sender, signal.Api)
+	}
+	switch endpoint.Scheme {
+	case "http", "https":
+		return spec, nil
+	case "grpc", "grpcs":
+		return spec, fmt.Errorf("%s calls %s: gRPC endpoints are not supported yet, only http and https", signal.Sender, signal.Api)
+	default:
+		return spec, fmt.Errorf("%s calls %s: unsupported scheme %q, only http and https", signal.Sender, signal.Api, endpoint.Scheme)
+	}
+}
+
+func (apiHandler ApiHandler) RunAction(ctx context.Context, signal entities.Signal, spec ProcessSpec) (result entities.ProcessResult, err error) {
+	result = entities.ProcessResult{ExitCode: 1, StartTime: time.Now()}
+	defer func() { result.FinishTime = time.Now() }()
+	stdout := spec.Stdout
+	if stdout == nil {
+		stdout = io.Discard
+	}
+
+	request := signal.ApiRequest
+	method := request.Method
+	if method == "" {
+		method = http.MethodGet
+		if request.Body != "" {
+			method = http.MethodPost
+		}
+	}
+	var body io.Reader
+	if request.Body != "" {
+		body = strings.NewReader(request.Body)
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, method, signal.Api, body)
+	if err != nil {
+		return result, fmt.Errorf("failed to build request of %s: %w", signal.Sender, err)
+	}
+	for name, value := range request.Headers {
+		httpRequest.Header.Set(name, value)
+	}
+	if request.Body != "" && httpRequest.Header.Get("Content-Type") == "" && json.Valid([]byte(request.Body)) {
+		httpRequest.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := http.DefaultClient.Do(httpRequest)
+	if err != nil {
+		return result, fmt.Errorf("%s %s failed: %w", method, signal.Api, err)
+	}
+	defer response.Body.Close()
+	responseBody, err := io.ReadAll(io.LimitReader(response.Body, maxApiResponseSize))
+	if err != nil {
+		return result, fmt.Errorf("failed to read response of %s %s: %w", method, signal.Api, err)
+	}
+
+	if len(responseBody) > 0 {
+		stdout.Write(responseBody)
+		if !bytes.HasSuffix(responseBody, []byte("\n")) {
+			fmt.Fprintln(stdout)
+		}
+	}
+	// Published like a process would, the response only printed
+	if outputsPath := spec.Environment["SCRIPTER_OUTPUTS"]; outputsPath != "" {
+		if err := WriteOutput(outputsPath, "status", strconv.Itoa(response.StatusCode)); err != nil {
+			return result, err
+		}
+		if err := WriteOutput(outputsPath, "body", singleLine(responseBody)); err != nil {
+			return result, err
+		}
+	}
+
+	if !expectedStatus(request.ExpectedStatus, response.StatusCode) {
+		result.ExitCode = max(response.StatusCode/100, 1)
+		return result, fmt.Errorf("%s %s answered %s", method, signal.Api, response.Status)
+	}
+	result.ExitCode = 0
+	return result, nil
+}
+
+func expectedStatus(expected []int, statusCode int) bool {
+	if len(expected) == 0 {
+		return statusCode >= 200 && statusCode < 300
+	}
+	for _, expectedCode := range expected {
+		if expectedCode == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// An output is a single line: JSON is compacted and other text has its line
+// breaks turned into spaces.
+func singleLine(body []byte) string {
+	var compacted bytes.Buffer
+	if json.Compact(&compacted, body) == nil {
+		return compacted.String()
+	}
+	return strings.Join(strings.Fields(string(body)), " ")
+}
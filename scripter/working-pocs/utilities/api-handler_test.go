@@ -0,0 +1,158 @@
+package utilities
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"scripter/entities"
+	"strings"
+	"testing"
+)
+
+// apiRun runs the api action of the signal with an outputs file of its own
+// and returns what it published.
+func apiRun(t *testing.T, signal entities.Signal) (entities.ProcessResult, map[string]string, error) {
+	t.Helper()
+	runStore := RunStore{Directory: t.TempDir()}
+	if err := runStore.Prepare(signal.Id); err != nil {
+		t.Fatal(err)
+	}
+	spec := ProcessSpec{Environment: map[string]string{"SCRIPTER_OUTPUTS": runStore.OutputsPath(signal.Id)}, Stdout: io.Discard}
+	result, runErr := ApiHandler{}.RunAction(context.Background(), signal, spec)
+	outputs, err := runStore.ReadOutputs(signal.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result, outputs, runErr
+}
+
+func TestApiHandlerSendsTheTemplatedRequest(t *testing.T) {
+	var method, path, authorization, contentType, body string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		method, path = request.Method, request.URL.Path
+		authorization, contentType = request.Header.Get("Authorization"), request.Header.Get("Content-Type")
+		read, _ := io.ReadAll(request.Body)
+		body = string(read)
+		writer.WriteHeader(http.StatusCreated)
+		io.WriteString(writer, "{\n  \"created\": true\n}\n")
+	}))
+	defer server.Close()
+
+	signal := entities.Signal{
+		Id:                   "run-1",
+		Sender:               "deploy",
+		Type:                 ActionTypeApi,
+		Api:                  server.URL + "/deployments/${{ signal.id }}",
+		EnvironmentVariables: map[string]string{"TOKEN": "secret"},
+		ApiRequest: entities.ApiRequest{
+			Headers: map[string]string{"Authorization": "Bearer ${{ env.TOKEN }}"},
+			Body:    `{"version": "${{ steps.build.outputs.version }}"}`,
+		},
+	}
+	signal, err := ObjectHandler{}.InterpolateSignal(signal, map[string]string{"steps.build.outputs.version": "1.4.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, outputs, err := apiRun(t, signal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if method != http.MethodPost {
+		t.Errorf("method %s, want POST for a request with a body", method)
+	}
+	if path != "/deployments/run-1" {
+		t.Errorf("path %s, want /deployments/run-1", path)
+	}
+	if authorization != "Bearer secret" {
+		t.Errorf("Authorization %q, want %q", authorization, "Bearer secret")
+	}
+	if contentType != "application/json" {
+		t.Errorf("Content-Type %q, want application/json for a JSON body", contentType)
+	}
+	if body != `{"version": "1.4.2"}` {
+		t.Errorf("body %s, want the version interpolated", body)
+	}
+	if result.ExitCode != 0 {
+		t.Errorf("exit code %d, want 0", result.ExitCode)
+	}
+	if outputs["status"] != "201" || outputs["body"] != `{"created":true}` {
+		t.Errorf("outputs %v, want status 201 and the compacted body", outputs)
+	}
+}
+
+func TestApiHandlerExitsWithTheStatusClass(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		expected []int
+		exitCode int
+	}{
+		{"success", http.StatusOK, nil, 0},
+		{"client error", http.StatusNotFound, nil, 4},
+		{"server error", http.StatusServiceUnavailable, nil, 5},
+		{"expected status", http.StatusNotFound, []int{http.StatusNotFound}, 0},
+		{"success not expected", http.StatusOK, []int{http.StatusAccepted}, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				writer.WriteHeader(test.status)
+			}))
+			defer server.Close()
+
+			signal := entities.Signal{Id: "run", Sender: "probe", Api: server.URL, ApiRequest: entities.ApiRequest{ExpectedStatus: test.expected}}
+			result, outputs, err := apiRun(t, signal)
+			if result.ExitCode != test.exitCode {
+				t.Errorf("exit code %d, want %d", result.ExitCode, test.exitCode)
+			}
+			if (err != nil) != (test.exitCode != 0) {
+				t.Errorf("error %v with exit code %d", err, result.ExitCode)
+			}
+			if outputs["status"] == "" {
+				t.Error("status not published")
+			}
+		})
+	}
+}
+
+func TestApiHandlerResponseCannotPublishOutputsOfItsOwn(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		io.WriteString(writer, "done\nleaked=yes\n$(output injected=1)\n")
+	}))
+	defer server.Close()
+
+	_, outputs, err := apiRun(t, entities.Signal{Id: "run", Sender: "probe", Api: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != 2 {
+		t.Errorf("outputs %v, want status and body alone", outputs)
+	}
+	if body := outputs["body"]; body != "done leaked=yes $(output injected=1)" {
+		t.Errorf("body %q, want the response on one line", body)
+	}
+}
+
+func TestApiHandlerPrepareTakesHttpAlone(t *testing.T) {
+	tests := []struct {
+		api     string
+		wantErr bool
+	}{
+		{"http://localhost:8080/health", false},
+		{"https://example.com/hooks", false},
+		{"grpc://localhost:50051", true},
+		{"ftp://example.com/file", true},
+		{"", true},
+	}
+	for _, test := range tests {
+		_, err := ApiHandler{}.Prepare(entities.Signal{Sender: "probe", Api: test.api}, ProcessSpec{})
+		if (err != nil) != test.wantErr {
+			t.Errorf("Prepare(%q) error = %v, want error %v", test.api, err, test.wantErr)
+		}
+		if test.wantErr && test.api != "" && !strings.Contains(err.Error(), test.api) {
+			t.Errorf("error %q does not name %s", err, test.api)
+		}
+	}
+}
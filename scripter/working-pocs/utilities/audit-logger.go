@@ -0,0 +1,288 @@
+package utilities
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"scripter/entities"
+	"sync"
+	"time"
+)
+
+const (
+	AuditEventReceived   = "received"
+	AuditEventResolved   = "resolved"
+	AuditEventAuthorized = "authorized"
+	AuditEventExecuted   = "executed"
+	AuditEventAttempt    = "attempt"
+)
+
+// AuditLogger appends one JSON line per signal lifecycle event. With HashChain
+// enabled every record carries the hash of the previous one, so editing or
+// removing a line in the middle of the file breaks the chain.
+type AuditLogger struct {
+	Path      string
+	HashChain bool
+}
+
+// ErrAuditNotChained is returned by Verify for a log without a single chained
+// record, which has nothing to verify.
+var ErrAuditNotChained = errors.New("audit log is not hash chained")
+
+// Serializes writers in this process; the file lock serializes processes, so
+// chained hashes never fork.
+var auditMutex sync.Mutex
+
+func (auditLogger AuditLogger) Record(record entities.AuditRecord) error {
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+
+	file, err := os.OpenFile(auditLogger.Path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log %s: %w", auditLogger.Path, err)
+	}
+	defer file.Close()
+	if err := lockFile(file); err != nil {
+		return fmt.Errorf("failed to lock audit log %s: %w", auditLogger.Path, err)
+	}
+	defer unlockFile(file)
+
+	if auditLogger.HashChain {
+		previousHash, err := lastAuditHash(file)
+		if err != nil {
+			return fmt.Errorf("failed to read audit log %s: %w", auditLogger.Path, err)
+		}
+		record.PreviousHash = previousHash
+		record.Hash = ""
+		hash, err := hashAuditRecord(record)
+		if err != nil {
+			return err
+		}
+		record.Hash = hash
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log %s: %w", auditLogger.Path, err)
+	}
+	return nil
+}
+
+// RecordSignal writes an event carrying the identifying fields of the signal.
+func (auditLogger AuditLogger) RecordSignal(event string, signal entities.Signal, outcome string) error {
+	return auditLogger.Record(newAuditRecord(event, signal, outcome))
+}
+
+func (auditLogger AuditLogger) RecordAuthorization(signal entities.Signal, authorized bool) error {
+	record := newAuditRecord(AuditEventAuthorized, signal, "")
+	record.SecurityDecision = "denied"
+	record.Outcome = "rejected"
+	if authorized {
+		record.SecurityDecision = "granted"
+		if signal.BypassSecurity {
+			record.SecurityDecision = "bypassed"
+		}
+		record.Outcome = "accepted"
+	}
+	return auditLogger.Record(record)
+}
+
+func (auditLogger AuditLogger) RecordExecution(signal entities.Signal, startTime time.Time, finishTime time.Time, exitCode int) error {
+	record := newAuditRecord(AuditEventExecuted, signal, "succeeded")
+	record.StartTime = startTime.UTC()
+	record.FinishTime = finishTime.UTC()
+	record.ExitCode = &exitCode
+	if exitCode != 0 {
+		record.Outcome = "failed"
+	}
+	return auditLogger.Record(record)
+}
+
+// RecordAttempt writes one attempt at the action or at a dependency install,
+// named by subject.
+func (auditLogger AuditLogger) RecordAttempt(signal entities.Signal, subject string, attempt entities.Attempt) error {
+	record := newAuditRecord(AuditEventAttempt, signal, "succeeded")
+	record.Subject = subject
+	record.Attempt = attempt.Number
+	record.StartTime = attempt.StartTime.UTC()
+	record.FinishTime = attempt.FinishTime.UTC()
+	record.ExitCode = &attempt.ExitCode
+	if attempt.TimedOut {
+		record.Outcome = "timed-out"
+	} else if attempt.ExitCode != 0 || attempt.Error != "" {
+		record.Outcome = "failed"
+	}
+	return auditLogger.Record(record)
+}
+
+func (auditLogger AuditLogger) Query(filter entities.AuditFilter) ([]entities.AuditRecord, error) {
+	records, err := auditLogger.readAll()
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := []entities.AuditRecord{}
+	for _, record := range records {
+		if !filter.Since.IsZero() && record.Time.Before(filter.Since) {
+			continue
+		}
+		if !filter.Until.IsZero() && record.Time.After(filter.Until) {
+			continue
+		}
+		if filter.Template != "" && record.Sender != filter.Template && record.Template != filter.Template {
+			continue
+		}
+		if filter.Outcome != "" && record.Outcome != filter.Outcome {
+			continue
+		}
+		filtered = append(filtered, record)
+	}
+	return filtered, nil
+}
+
+// Verify walks the hash chain and returns the line number of the first record
+// that does not match its predecessor, or 0 when the chain is intact. Records
+// written before chaining was enabled are not part of the chain; an unchained
+// one after it started breaks it.
+func (auditLogger AuditLogger) Verify() (int, error) {
+	records, err := auditLogger.readAll()
+	if err != nil {
+		return 0, err
+	}
+
+	start := 0
+	for start < len(records) && records[start].Hash == "" && records[start].PreviousHash == "" {
+		start++
+	}
+	if start == len(records) {
+		return 0, ErrAuditNotChained
+	}
+
+	previousHash := ""
+	for index, record := range records[start:] {
+		expected := record.Hash
+		record.Hash = ""
+		hash, err := hashAuditRecord(record)
+		if err != nil {
+			return 0, err
+		}
+		if record.PreviousHash != previousHash || hash != expected {
+			return start + index + 1, nil
+		}
+		previousHash = expected
+	}
+	return 0, nil
+}
+
+func (auditLogger AuditLogger) readAll() ([]entities.AuditRecord, error) {
+	records := []entities.AuditRecord{}
+
+	file, err := os.Open(auditLogger.Path)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %w", auditLogger.Path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record entities.AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("malformed audit record at %s:%d: %w", auditLogger.Path, line, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log %s: %w", auditLogger.Path, err)
+	}
+	return records, nil
+}
+
+// lastAuditHash reads the hash of the last record, reading the file backwards
+// from its end so that writing stays cheap however long the log grows.
+func lastAuditHash(file *os.File) (string, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	end := info.Size()
+	line := []byte{}
+	chunk := make([]byte, 4096)
+	for end > 0 {
+		size := min(int64(len(chunk)), end)
+		if _, err := file.ReadAt(chunk[:size], end-size); err != nil {
+			return "", err
+		}
+		line = append(append([]byte{}, chunk[:size]...), line...)
+		end -= size
+		trimmed := bytes.TrimRight(line, "\n")
+		if newline := bytes.LastIndexByte(trimmed, '\n'); newline != -1 {
+			line = trimmed[newline+1:]
+			break
+		}
+		if end == 0 {
+			line = trimmed
+		}
+	}
+	if len(bytes.TrimSpace(line)) == 0 {
+		return "", nil
+	}
+
+	var record entities.AuditRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		return "", fmt.Errorf("malformed last audit record: %w", err)
+	}
+	return record.Hash, nil
+}
+
+func newAuditRecord(event string, signal entities.Signal, outcome string) entities.AuditRecord {
+	return entities.AuditRecord{
+		Event:          event,
+		SignalId:       signal.Id,
+		Sender:         signal.Sender,
+		Template:       signal.SourcePath,
+		OriginatorQuay: signal.OriginatorQuay.Name,
+		User:           signalUser(signal),
+		Executor:       signal.Executor,
+		Outcome:        outcome,
+	}
+}
+
+func signalUser(signal entities.Signal) string {
+	if signal.User != "" {
+		return signal.User
+	}
+	current, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return current.Username
+}
+
+func hashAuditRecord(record entities.AuditRecord) (string, error) {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
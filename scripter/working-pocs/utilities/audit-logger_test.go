@@ -0,0 +1,145 @@
+package utilities
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"scripter/entities"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeAudit records one event per signal id, chained or not, and returns the
+// lines of the log.
+func writeAudit(t *testing.T, auditLogger AuditLogger, signalIds ...string) []string {
+	t.Helper()
+	for _, signalId := range signalIds {
+		if err := auditLogger.Record(entities.AuditRecord{Event: AuditEventReceived, SignalId: signalId, Outcome: "accepted"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	content, err := os.ReadFile(auditLogger.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+func rewriteAudit(t *testing.T, path string, lines []string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuditLoggerVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(lines []string) []string
+		broken int
+	}{
+		{"intact chain", func(lines []string) []string { return lines }, 0},
+		{"edited record", func(lines []string) []string {
+			lines[1] = strings.Replace(lines[1], `"outcome":"accepted"`, `"outcome":"rejected"`, 1)
+			return lines
+		}, 2},
+		{"removed record", func(lines []string) []string {
+			return append(lines[:1], lines[2:]...)
+		}, 2},
+		// Cutting the end off leaves a chain as valid as it was
+		{"removed last records", func(lines []string) []string { return lines[:2] }, 0},
+		{"reordered records", func(lines []string) []string {
+			lines[1], lines[2] = lines[2], lines[1]
+			return lines
+		}, 2},
+		{"unchained record appended", func(lines []string) []string {
+			return append(lines, `{"time":"2026-01-01T00:00:00Z","event":"received","signal-id":"forged"}`)
+		}, 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			auditLogger := AuditLogger{Path: filepath.Join(t.TempDir(), "audit.log"), HashChain: true}
+			lines := writeAudit(t, auditLogger, "first", "second", "third")
+			rewriteAudit(t, auditLogger.Path, test.tamper(lines))
+
+			broken, err := auditLogger.Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if broken != test.broken {
+				t.Errorf("Verify() = %d, want %d", broken, test.broken)
+			}
+		})
+	}
+}
+
+func TestAuditLoggerVerifySkipsTheRecordsWrittenBeforeChaining(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeAudit(t, AuditLogger{Path: path}, "before", "also-before")
+	lines := writeAudit(t, AuditLogger{Path: path, HashChain: true}, "first", "second")
+	if strings.Contains(lines[2], "previous-hash") {
+		t.Errorf("first chained record %s links to an unchained one", lines[2])
+	}
+
+	broken, err := AuditLogger{Path: path}.Verify()
+	if err != nil || broken != 0 {
+		t.Errorf("Verify() = %d, %v, want an intact chain", broken, err)
+	}
+
+	lines[0] = strings.Replace(lines[0], "before", "edited", 1)
+	lines[3] = strings.Replace(lines[3], "second", "edited", 1)
+	rewriteAudit(t, path, lines)
+	if broken, err := (AuditLogger{Path: path}).Verify(); err != nil || broken != 4 {
+		t.Errorf("Verify() = %d, %v, want the chain broken at line 4", broken, err)
+	}
+}
+
+func TestAuditLoggerVerifyRefusesAnUnchainedLog(t *testing.T) {
+	for _, signalIds := range [][]string{nil, {"first", "second"}} {
+		auditLogger := AuditLogger{Path: filepath.Join(t.TempDir(), "audit.log")}
+		if len(signalIds) > 0 {
+			writeAudit(t, auditLogger, signalIds...)
+		}
+		if _, err := auditLogger.Verify(); !errors.Is(err, ErrAuditNotChained) {
+			t.Errorf("Verify() of %d unchained records: %v, want ErrAuditNotChained", len(signalIds), err)
+		}
+	}
+}
+
+func TestAuditLoggerQuery(t *testing.T) {
+	auditLogger := AuditLogger{Path: filepath.Join(t.TempDir(), "audit.log")}
+	signal := entities.Signal{Id: "run-1", Sender: "deploy", SourcePath: "/templates/deploy.yaml"}
+	for _, record := range []func() error{
+		func() error { return auditLogger.RecordAuthorization(signal, true) },
+		func() error { return auditLogger.RecordExecution(signal, time.Now(), time.Now(), 2) },
+		func() error {
+			return auditLogger.Record(entities.AuditRecord{Event: AuditEventReceived, SignalId: "run-2", Template: "other.yaml", Outcome: "unresolved"})
+		},
+	} {
+		if err := record(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		filter entities.AuditFilter
+		want   int
+	}{
+		{entities.AuditFilter{}, 3},
+		{entities.AuditFilter{Template: "deploy"}, 2},
+		{entities.AuditFilter{Template: "other.yaml"}, 1},
+		{entities.AuditFilter{Outcome: "failed"}, 1},
+		{entities.AuditFilter{Outcome: "unresolved"}, 1},
+		{entities.AuditFilter{Template: "deploy", Outcome: "unresolved"}, 0},
+	}
+	for _, test := range tests {
+		records, err := auditLogger.Query(test.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != test.want {
+			t.Errorf("Query(%+v) returned %d records, want %d", test.filter, len(records), test.want)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package utilities
+
+import (
+	"fmt"
+	"scripter/entities"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ConditionExpression is the "when" condition of a step or a dependency, such
+// as `signal.host-os == "linux" && context != "production-1"` or
+// `previous.exit-code > 0`. Names are looked up in the variables of the
+// resolved signal, nothing else can be reached from an expression.
+type ConditionExpression struct{}
+
+// Holds evaluates the condition, an empty one always holds.
+func (conditionExpression ConditionExpression) Holds(expression string, variables map[string]string) (bool, error) {
+	if strings.TrimSpace(expression) == "" {
+		return true, nil
+	}
+	return conditionExpression.Evaluate(expression, variables)
+}
+
+func (conditionExpression ConditionExpression) Evaluate(expression string, variables map[string]string) (bool, error) {
+	tokens, err := tokenizeConditionExpression(expression)
+	if err != nil {
+		return false, err
+	}
+	parser := conditionExpressionParser{tokens: tokens, variables: variables}
+	result, err := parser.parseOr()
+	if err != nil {
+		return false, fmt.Errorf("%v in condition %q", err, expression)
+	}
+	if parser.position < len(parser.tokens) {
+		return false, fmt.Errorf("unexpected %q in condition %q", parser.tokens[parser.position].text, expression)
+	}
+	return result, nil
+}
+
+// SignalVariables lists what a condition may refer to. Environment variables
+// of the signal are reachable as env.<NAME> and the step outputs it received
+// as steps.<name>.outputs.<key>.
+func (conditionExpression ConditionExpression) SignalVariables(signal entities.Signal) map[string]string {
+	variables := map[string]string{
+		"signal.id":                signal.Id,
+		"signal.sender":            signal.Sender,
+		"signal.host-os":           signal.HostOs,
+		"signal.os":                signal.SignalOs,
+		"signal.executor":          signal.Executor,
+		"signal.execution-mode":    signal.ExecutionMode,
+		"signal.type":              signal.Type,
+		"signal.package-installer": signal.PackageInstaller,
+		"signal.containerize":      strconv.FormatBool(signal.Containerize),
+		"signal.context":           signal.Environment,
+		"context":                  signal.Environment,
+	}
+	for key, value := range signal.EnvironmentVariables {
+		variables["env."+key] = value
+	}
+	for key, value := range signal.Outputs {
+		variables[key] = value
+	}
+	return variables
+}
+
+// Grammar, lowest precedence first:
+//
+//	or         = and { "||" and }
+//	and        = unary { "&&" unary }
+//	unary      = "!" unary | "(" or ")" | comparison
+//	comparison = operand [ ( "==" | "!=" | "<" | "<=" | ">" | ">=" ) operand ]
+//	operand    = string | number | true | false | name
+//
+// A lone operand holds when it reads as true, see InterpretStringAsBool.
+type conditionExpressionParser struct {
+	tokens    []conditionToken
+	position  int
+	variables map[string]string
+}
+
+type conditionToken struct {
+	text   string
+	quoted bool
+}
+
+var conditionOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")"}
+
+func (parser *conditionExpressionParser) parseOr() (bool, error) {
+	result, err := parser.parseAnd()
+	if err != nil {
+		return false, err
+	}
+	for parser.peek() == "||" {
+		parser.position++
+		right, err := parser.parseAnd()
+		if err != nil {
+			return false, err
+		}
+		result = result || right
+	}
+	return result, nil
+}
+
+func (parser *conditionExpressionParser) parseAnd() (bool, error) {
+	result, err := parser.parseUnary()
+	if err != nil {
+		return false, err
+	}
+	for parser.peek() == "&&" {
+		parser.position++
+		right, err := parser.parseUnary()
+		if err != nil {
+			return false, err
+		}
+		result = result && right
+	}
+	return result, nil
+}
+
+func (parser *conditionExpressionParser) parseUnary() (bool, error) {
+	switch parser.peek() {
+	case "!":
+		parser.position++
+		result, err := parser.parseUnary()
+		return !result, err
+	case "(":
+		parser.position++
+		result, err := parser.parseOr()
+		if err != nil {
+			return false, err
+		}
+		if parser.peek() != ")" {
+			return false, fmt.Errorf("missing closing parenthesis")
+		}
+		parser.position++
+		return result, nil
+	}
+	return parser.parseComparison()
+}
+
+func (parser *conditionExpressionParser) parseComparison() (bool, error) {
+	left, err := parser.parseOperand()
+	if err != nil {
+		return false, err
+	}
+
+	operator := parser.peek()
+	switch operator {
+	case "==", "!=", "<", "<=", ">", ">=":
+		parser.position++
+	default:
+		return stringHandler.InterpretStringAsBool(left), nil
+	}
+
+	right, err := parser.parseOperand()
+	if err != nil {
+		return false, err
+	}
+
+	leftNumber, leftErr := strconv.ParseFloat(left, 64)
+	rightNumber, rightErr := strconv.ParseFloat(right, 64)
+	numeric := leftErr == nil && rightErr == nil
+
+	switch operator {
+	case "==":
+		return left == right || (numeric && leftNumber == rightNumber), nil
+	case "!=":
+		return left != right && !(numeric && leftNumber == rightNumber), nil
+	}
+	if !numeric {
+		return false, fmt.Errorf("%q %s %q compares values that are not numbers", left, operator, right)
+	}
+	switch operator {
+	case "<":
+		return leftNumber < rightNumber, nil
+	case "<=":
+		return leftNumber <= rightNumber, nil
+	case ">":
+		return leftNumber > rightNumber, nil
+	default:
+		return leftNumber >= rightNumber, nil
+	}
+}
+
+func (parser *conditionExpressionParser) parseOperand() (string, error) {
+	if parser.position >= len(parser.tokens) {
+		return "", fmt.Errorf("expression ended unexpectedly")
+	}
+	token := parser.tokens[parser.position]
+	if !token.quoted && stringHandler.ContainsString(conditionOperators, token.text) {
+		return "", fmt.Errorf("unexpected %q", token.text)
+	}
+	parser.position++
+
+	if token.quoted {
+		return token.text, nil
+	}
+	if token.text == "true" || token.text == "false" {
+		return token.text, nil
+	}
+	if _, err := strconv.ParseFloat(token.text, 64); err == nil {
+		return token.text, nil
+	}
+	if value, exists := parser.variables[token.text]; exists {
+		return value, nil
+	}
+	// An environment variable the signal does not set is simply empty
+	if strings.HasPrefix(token.text, "env.") {
+		return "", nil
+	}
+	return "", fmt.Errorf("unknown name %q", token.text)
+}
+
+func (parser *conditionExpressionParser) peek() string {
+	if parser.position >= len(parser.tokens) || parser.tokens[parser.position].quoted {
+		return ""
+	}
+	return parser.tokens[parser.position].text
+}
+
+func tokenizeConditionExpression(expression string) ([]conditionToken, error) {
+	tokens := []conditionToken{}
+	for index := 0; index < len(expression); {
+		character := rune(expression[index])
+		if unicode.IsSpace(character) {
+			index++
+			continue
+		}
+
+		if character == '"' || character == '\'' {
+			end := strings.IndexRune(expression[index+1:], character)
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated string in condition %q", expression)
+			}
+			tokens = append(tokens, conditionToken{text: expression[index+1 : index+1+end], quoted: true})
+			index += end + 2
+			continue
+		}
+
+		operator := ""
+		for _, candidate := range conditionOperators {
+			if strings.HasPrefix(expression[index:], candidate) {
+				operator = candidate
+				break
+			}
+		}
+		if operator != "" {
+			tokens = append(tokens, conditionToken{text: operator})
+			index += len(operator)
+			continue
+		}
+
+		if !isConditionCharacter(character) {
+			return nil, fmt.Errorf("invalid character %q in condition %q", character, expression)
+		}
+		start := index
+		for index < len(expression) && isConditionCharacter(rune(expression[index])) {
+			index++
+		}
+		tokens = append(tokens, conditionToken{text: expression[start:index]})
+	}
+	return tokens, nil
+}
+
+func isConditionCharacter(character rune) bool {
+	return unicode.IsLetter(character) || unicode.IsDigit(character) || strings.ContainsRune("-_.", character)
+}
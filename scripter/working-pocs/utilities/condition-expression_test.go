@@ -0,0 +1,122 @@
+package utilities
+
+import (
+	"testing"
+)
+
+var conditionVariables = map[string]string{
+	"signal.host-os":               "linux",
+	"context":                      "production-1",
+	"previous.exit-code":           "2",
+	"steps.build.status":           "succeeded",
+	"steps.build.outputs.version":  "1.10",
+	"steps.build.outputs.released": "true",
+	"env.REGION":                   "eu",
+}
+
+func TestConditionExpressionEvaluate(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       bool
+	}{
+		// Precedence: && binds tighter than ||, ! tighter than both
+		{`true || false && false`, true},
+		{`(true || false) && false`, false},
+		{`!false && false`, false},
+		{`!(false && false)`, true},
+		{`!!true`, true},
+		{`false || false || true`, true},
+
+		// Quoting
+		{`signal.host-os == "linux"`, true},
+		{`signal.host-os == 'linux'`, true},
+		{`context == "production-1"`, true},
+		{`"a && b" == 'a && b'`, true},
+		{`"signal.host-os" == "linux"`, false},
+		{`"" == env.UNSET`, true},
+
+		// Numbers compare as numbers, everything else as strings
+		{`previous.exit-code > 0`, true},
+		{`previous.exit-code == 2.0`, true},
+		{`previous.exit-code != 2.0`, false},
+		{`steps.build.outputs.version < 1.9`, true},
+		{`steps.build.outputs.version == "1.10"`, true},
+		{`steps.build.outputs.version == 1.1`, true},
+		{`"1.10" != "1.1"`, false},
+		{`-1 < 0`, true},
+		{`"linux" != "Linux"`, true},
+
+		// A lone operand holds when it reads as true
+		{`steps.build.outputs.released`, true},
+		{`env.REGION`, false},
+		{`env.UNSET`, false},
+		{`1`, true},
+	}
+	for _, test := range tests {
+		got, err := ConditionExpression{}.Evaluate(test.expression, conditionVariables)
+		if err != nil {
+			t.Errorf("Evaluate(%s): %v", test.expression, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Evaluate(%s) = %v, want %v", test.expression, got, test.want)
+		}
+	}
+}
+
+func TestConditionExpressionRefusesWhatItCannotRead(t *testing.T) {
+	for _, expression := range []string{
+		// An unknown name is an error rather than false, so a typo does not
+		// silently skip a step
+		`nope == 1`,
+		`signal.hostos == "linux"`,
+		`true || nope`,
+
+		// Ordering strings
+		`signal.host-os > "a"`,
+		`previous.exit-code < "two"`,
+
+		// Malformed
+		`signal.host-os == "linux`,
+		`(true`,
+		`true)`,
+		`true &&`,
+		`|| true`,
+		`== 1`,
+		`1 ==`,
+		`!`,
+		`()`,
+		`1 2`,
+		`signal.host-os = "linux"`,
+		`true & false`,
+		`env.REGION == $HOME`,
+		`context == "a" "b"`,
+		`ünicode == 1`,
+	} {
+		if got, err := (ConditionExpression{}).Evaluate(expression, conditionVariables); err == nil {
+			t.Errorf("Evaluate(%s) = %v, want an error", expression, got)
+		}
+	}
+}
+
+func TestConditionExpressionHoldsWhenEmpty(t *testing.T) {
+	for _, expression := range []string{"", "  \t"} {
+		if holds, err := (ConditionExpression{}).Holds(expression, nil); err != nil || !holds {
+			t.Errorf("Holds(%q) = %v, %v, want true", expression, holds, err)
+		}
+	}
+}
+
+// FuzzConditionExpression checks that no input makes the evaluation panic.
+func FuzzConditionExpression(f *testing.F) {
+	for _, seed := range []string{
+		`signal.host-os == "linux" && context != "production-1"`,
+		`previous.exit-code > 0 || (steps.build.status == 'succeeded')`,
+		`!(!(`, `"`, `'`, `((((((((((true))))))))))`, `1 <= <= 2`, `!`, `)`, "\xff", `env.`, `-`,
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, expression string) {
+		ConditionExpression{}.Evaluate(expression, conditionVariables)
+	})
+}
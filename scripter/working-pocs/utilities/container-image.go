@@ -0,0 +1,136 @@
+package utilities
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"scripter/entities"
+	"strings"
+)
+
+// ContainerImageBuilder builds the image a containerized signal runs in, from
+// the signal itself: the base image of its package installer, its
+// dependencies and its executable as the entrypoint. The base image is pinned
+// by digest and the dependencies at their locked versions, so the tag, a hash
+// of that content, changes whenever the image would: a signal that did not
+// change reuses its image and two signals needing the same image share it.
+type ContainerImageBuilder struct {
+	Repository  string
+	Lock        DependencyLock                   // Where base image digests are locked, next to the packages
+	Runtime     ContainerRuntime                 // What images are built in
+	OpenRuntime func() (ContainerRuntime, error) // Opens the runtime on first use when Runtime is not set
+}
+
+// ContainerRuntime is the runtime images are built and run in, opened now when
+// the builder was given none.
+func (builder ContainerImageBuilder) ContainerRuntime() (ContainerRuntime, error) {
+	if builder.Runtime != nil {
+		return builder.Runtime, nil
+	}
+	if builder.OpenRuntime == nil {
+		return nil, fmt.Errorf("no container runtime")
+	}
+	return builder.OpenRuntime()
+}
+
+// Dockerfile of the image of the signal, the one the file generator writes
+// without what the container is run with.
+func (builder ContainerImageBuilder) Dockerfile(ctx context.Context, signal entities.Signal) (string, error) {
+	if signal.SignalOs == "windows" {
+		return "", fmt.Errorf("cannot generate an image for %s: only Linux images are generated from the signal", signal.Sender)
+	}
+	base, err := builder.baseImage(ctx, signal)
+	if err != nil {
+		return "", err
+	}
+	installs, err := imageInstallCommands(signal, builder.Lock)
+	if err != nil {
+		return "", err
+	}
+	return imageDockerfile(signal, base, installs), nil
+}
+
+// baseImage is the base image of the signal by digest, the locked one or the
+// one the registry serves now, which is locked in turn.
+func (builder ContainerImageBuilder) baseImage(ctx context.Context, signal entities.Signal) (string, error) {
+	base, err := signalBaseImage(signal, builder.Lock)
+	if err != nil || strings.Contains(base, "@") {
+		return base, err
+	}
+	runtime, err := builder.ContainerRuntime()
+	if err != nil {
+		return "", fmt.Errorf("cannot pin base image of %s: %w", signal.Sender, err)
+	}
+	digest, err := runtime.ImageDigest(ctx, base)
+	if err != nil {
+		return "", fmt.Errorf("cannot pin base image of %s: %w", signal.Sender, err)
+	}
+	if err := builder.Lock.Record(entities.LockedDependency{Installer: imageLockInstaller, Name: base, Version: digest}); err != nil {
+		return "", err
+	}
+	return base + "@" + digest, nil
+}
+
+// Tag is <repository>/<sender>:<first 12 hex digits of the hash of the build
+// context>, the repository being "scripter" unless given. The context is the
+// Dockerfile and the files it copies in, by their content.
+func (builder ContainerImageBuilder) Tag(signal entities.Signal, dockerfile string, files map[string]string) (string, error) {
+	repository := builder.Repository
+	if repository == "" {
+		repository = "scripter"
+	}
+	hash := sha256.New()
+	hash.Write([]byte(dockerfile))
+	for _, name := range sortedKeys(files) {
+		content, err := os.ReadFile(files[name])
+		if err != nil {
+			return "", fmt.Errorf("cannot build an image for %s: %w", signal.Sender, err)
+		}
+		fileSum := sha256.Sum256(content)
+		fmt.Fprintf(hash, "\n%s %x", name, fileSum)
+	}
+	return fmt.Sprintf("%s/%s:%s", repository, serviceName(signal.Sender), hex.EncodeToString(hash.Sum(nil))[:12]), nil
+}
+
+// Build returns the tag of the image of the signal, building it unless an
+// image with that tag already exists.
+func (builder ContainerImageBuilder) Build(ctx context.Context, signal entities.Signal, logger *slog.Logger) (string, error) {
+	runtime, err := builder.ContainerRuntime()
+	if err != nil {
+		return "", fmt.Errorf("cannot build an image for %s: %w", signal.Sender, err)
+	}
+	dockerfile, err := builder.Dockerfile(ctx, signal)
+	if err != nil {
+		return "", err
+	}
+	_, files := imageExecutable(signal)
+	tag, err := builder.Tag(signal, dockerfile, files)
+	if err != nil {
+		return "", err
+	}
+
+	exists, err := runtime.ImageExists(ctx, tag)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		logger.Info("container image up to date", "image", tag, "runtime", runtime.Name())
+		return tag, nil
+	}
+
+	logger.Info("building container image", "image", tag, "runtime", runtime.Name())
+	err = runtime.Build(ctx, ImageSpec{
+		Tag:        tag,
+		Dockerfile: dockerfile,
+		Files:      files,
+		Labels:     map[string]string{"scripter.sender": signal.Sender, "scripter.template": signal.SourcePath},
+	}, os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", signal.Sender, err)
+	}
+	logger.Info("container image built", "image", tag)
+	return tag, nil
+}
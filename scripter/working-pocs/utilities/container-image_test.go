@@ -0,0 +1,228 @@
+package utilities
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"scripter/entities"
+	"strings"
+	"testing"
+)
+
+var testLogger = slog.New(slog.DiscardHandler)
+
+// containerSignal is a containerized signal whose executable is a script in
+// a directory of its own.
+func containerSignal(t *testing.T) entities.Signal {
+	t.Helper()
+	directory := t.TempDir()
+	if err := os.WriteFile(filepath.Join(directory, "deploy.sh"), []byte("#!/bin/sh\necho deployed\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return entities.Signal{
+		Id:                       "run-1",
+		Sender:                   "deploy",
+		ExecutablePath:           "./deploy.sh",
+		WorkingDirectory:         directory,
+		Arguments:                []string{"--target", "staging"},
+		Containerize:             true,
+		HostOs:                   "linux",
+		SignalOs:                 "linux",
+		PackageInstaller:         "apt",
+		InstallationDependencies: []entities.Dependency{{Name: "redis-server>=7"}, {Name: "curl", Version: ">=8"}, {Name: "jq"}},
+	}
+}
+
+func TestContainerImageBuilderPinsWhatTheImageIsMadeOf(t *testing.T) {
+	lock := DependencyLock{Path: filepath.Join(t.TempDir(), "scripter.lock")}
+	if err := lock.Record(entities.LockedDependency{Installer: "apt", Name: "redis-server", Constraint: ">=7", Version: "5:7.0.15-1"}); err != nil {
+		t.Fatal(err)
+	}
+	runtime := NewFakeContainerRuntime()
+	builder := ContainerImageBuilder{Lock: lock, Runtime: runtime}
+	signal := containerSignal(t)
+
+	tag, err := builder.Build(context.Background(), signal, testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(tag, "scripter/deploy:") {
+		t.Errorf("tag %s, want it in scripter/deploy", tag)
+	}
+	spec := runtime.Images[tag]
+	for _, want := range []string{
+		"FROM debian:bookworm-slim@sha256:",
+		"apt-get install -y --allow-downgrades redis-server=5:7.0.15-1 curl jq",
+		"# curl >=8 is not locked",
+		`COPY ["bin/deploy.sh", "/opt/scripter/deploy.sh"]`,
+		`ENTRYPOINT ["/opt/scripter/deploy.sh"]`,
+	} {
+		if !strings.Contains(spec.Dockerfile, want) {
+			t.Errorf("Dockerfile lacks %q:\n%s", want, spec.Dockerfile)
+		}
+	}
+	if strings.Contains(spec.Dockerfile, "staging") {
+		t.Errorf("Dockerfile holds the arguments of the run:\n%s", spec.Dockerfile)
+	}
+	if spec.Files["bin/deploy.sh"] != filepath.Join(signal.WorkingDirectory, "deploy.sh") {
+		t.Errorf("build context %v, want the executable in bin", spec.Files)
+	}
+
+	locked, isLocked, err := lock.Get(imageLockInstaller, "debian:bookworm-slim")
+	if err != nil || !isLocked || !strings.HasPrefix(locked.Version, "sha256:") {
+		t.Errorf("base image digest not locked: %+v, %v, %v", locked, isLocked, err)
+	}
+}
+
+func TestContainerImageBuilderReusesAnImageUntilItsContentChanges(t *testing.T) {
+	runtime := NewFakeContainerRuntime()
+	builder := ContainerImageBuilder{Lock: DependencyLock{Path: filepath.Join(t.TempDir(), "scripter.lock")}, Runtime: runtime}
+	signal := containerSignal(t)
+	ctx := context.Background()
+
+	first, err := builder.Build(ctx, signal, testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runtime.Calls = nil
+	signal.Arguments = []string{"--target", "production"}
+	signal.EnvironmentVariables = map[string]string{"REGION": "eu"}
+	second, err := builder.Build(ctx, signal, testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first {
+		t.Errorf("arguments and environment changed the image: %s, then %s", first, second)
+	}
+	if strings.Join(runtime.Calls, "; ") != "image-exists "+first {
+		t.Errorf("calls %v, want the locked digest used and the image found", runtime.Calls)
+	}
+
+	executable := filepath.Join(signal.WorkingDirectory, "deploy.sh")
+	if err := os.WriteFile(executable, []byte("#!/bin/sh\necho deployed again\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	third, err := builder.Build(ctx, signal, testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third == first {
+		t.Error("a changed executable kept the image")
+	}
+}
+
+func TestContainerImageBuilderRefusesWindowsSignals(t *testing.T) {
+	signal := containerSignal(t)
+	signal.SignalOs = "windows"
+	runtime := NewFakeContainerRuntime()
+	if _, err := (ContainerImageBuilder{Runtime: runtime}).Build(context.Background(), signal, testLogger); err == nil {
+		t.Error("built a Linux image for a windows signal")
+	}
+	if len(runtime.Images) != 0 {
+		t.Errorf("images %v, want none", runtime.Images)
+	}
+}
+
+func TestContainerImageBuilderInstallsPipAndNpmFirst(t *testing.T) {
+	tests := []struct {
+		installer string
+		want      string
+	}{
+		{"apt", "RUN apt-get update && DEBIAN_FRONTEND=noninteractive apt-get install -y python3-pip npm && rm -rf /var/lib/apt/lists/*\n"},
+		{"apk", "RUN apk add --no-cache py3-pip npm\n"},
+		{"dnf", "RUN dnf install -y python3-pip npm\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.installer, func(t *testing.T) {
+			signal := containerSignal(t)
+			signal.PackageInstaller = test.installer
+			signal.InstallationDependencies = []entities.Dependency{{Name: "pip:requests"}, {Name: "typescript", Installer: "npm"}, {Name: "pip:httpx"}}
+			builder := ContainerImageBuilder{Lock: DependencyLock{Path: filepath.Join(t.TempDir(), "scripter.lock")}, Runtime: NewFakeContainerRuntime()}
+			dockerfile, err := builder.Dockerfile(context.Background(), signal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bootstrap := strings.Index(dockerfile, test.want)
+			pip := strings.Index(dockerfile, "RUN PIP_BREAK_SYSTEM_PACKAGES=1 python3 -m pip install requests httpx\n")
+			npm := strings.Index(dockerfile, "RUN npm install --global typescript\n")
+			if bootstrap == -1 || pip < bootstrap || npm < bootstrap {
+				t.Errorf("pip and npm not installed before they install:\n%s", dockerfile)
+			}
+		})
+	}
+}
+
+func TestContainerImageBuilderRefusesWindowsInstallers(t *testing.T) {
+	builder := ContainerImageBuilder{Lock: DependencyLock{Path: filepath.Join(t.TempDir(), "scripter.lock")}, Runtime: NewFakeContainerRuntime()}
+	platform := containerSignal(t)
+	platform.PackageInstaller = "chocolatey"
+	dependency := containerSignal(t)
+	dependency.InstallationDependencies = []entities.Dependency{{Name: "jq"}, {Name: "choco:git"}}
+	for _, signal := range []entities.Signal{platform, dependency} {
+		if dockerfile, err := builder.Dockerfile(context.Background(), signal); err == nil || !strings.Contains(err.Error(), "chocolatey") {
+			t.Errorf("error %v, want chocolatey refused in a Linux image:\n%s", err, dockerfile)
+		}
+	}
+}
+
+func TestContainerRunnerRunsTheActionInItsImage(t *testing.T) {
+	runtime := NewFakeContainerRuntime()
+	var created ContainerSpec
+	runtime.RunExitCode = func(container FakeContainer) int {
+		created = container.Spec
+		return 3
+	}
+	runner := ContainerRunner{Builder: ContainerImageBuilder{Runtime: runtime}}
+	signal := containerSignal(t)
+	outputs := filepath.Join(t.TempDir(), "outputs")
+	spec := ProcessSpec{
+		Arguments:        signal.Arguments,
+		Environment:      map[string]string{"SCRIPTER_OUTPUTS": outputs, "REGION": "eu"},
+		WorkingDirectory: signal.WorkingDirectory,
+		Logger:           testLogger,
+	}
+
+	result, err := runner.Run(context.Background(), signal, spec)
+	if err == nil || result.ExitCode != 3 {
+		t.Errorf("exit code %d, error %v, want 3 and an error", result.ExitCode, err)
+	}
+	if result.Container != "scripter-deploy-run-1" {
+		t.Errorf("container %q, want scripter-deploy-run-1", result.Container)
+	}
+	if strings.Join(created.Command, " ") != "--target staging" {
+		t.Errorf("command %v, want the arguments of the run", created.Command)
+	}
+	if created.Environment["REGION"] != "eu" || created.Environment["SCRIPTER_OUTPUTS"] != containerOutputsDirectory+"/outputs" {
+		t.Errorf("environment %v, want REGION and the outputs file in the container", created.Environment)
+	}
+	if created.Mounts[filepath.Dir(outputs)] != containerOutputsDirectory {
+		t.Errorf("mounts %v, want the outputs directory at %s", created.Mounts, containerOutputsDirectory)
+	}
+	if len(runtime.Containers) != 0 {
+		t.Errorf("containers %v left after the run, want them removed", runtime.Containers)
+	}
+}
+
+func TestContainerImageBuilderOpensItsRuntimeWhenNeeded(t *testing.T) {
+	opened := 0
+	runtime := NewFakeContainerRuntime()
+	builder := ContainerImageBuilder{Lock: DependencyLock{Path: filepath.Join(t.TempDir(), "scripter.lock")}, OpenRuntime: func() (ContainerRuntime, error) {
+		opened++
+		return runtime, nil
+	}}
+	if _, err := builder.Build(context.Background(), containerSignal(t), testLogger); err != nil {
+		t.Fatal(err)
+	}
+	if opened == 0 {
+		t.Error("runtime not opened")
+	}
+
+	failing := ContainerImageBuilder{OpenRuntime: func() (ContainerRuntime, error) {
+		return nil, errors.New("unsupported container runtime")
+	}}
+	if _, err := failing.Build(context.Background(), containerSignal(t), testLogger); err == nil || !strings.Contains(err.Error(), "unsupported container runtime") {
+		t.Errorf("error %v, want the runtime failure", err)
+	}
+}
@@ -0,0 +1,134 @@
+package utilities
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"scripter/entities"
+	"time"
+)
+
+// ContainerRunner runs the action of a containerized signal in the image built
+// for it instead of on the host. The container gets the arguments, the
+// environment and the working directory of the run, and the directory of the
+// outputs file is mounted in, so the action publishes its outputs through
+// SCRIPTER_OUTPUTS as it would on the host. When the context ends first, the
+// container is stopped as the process would be, or left running under
+// shutdown none unless its attempt timed out.
+type ContainerRunner struct {
+	Builder ContainerImageBuilder // Builds the image, in the runtime the container runs in
+}
+
+// Where the directory of the outputs file is mounted in the container.
+const containerOutputsDirectory = "/scripter/run"
+
+// Runs tells whether the action of the signal runs in a container, as it does
+// whenever a Linux image is built for it, whatever the host.
+func (containerRunner ContainerRunner) Runs(signal entities.Signal) bool {
+	return signal.Containerize && signal.SignalOs != "windows"
+}
+
+func (containerRunner ContainerRunner) Run(ctx context.Context, signal entities.Signal, spec ProcessSpec) (entities.ProcessResult, error) {
+	result := entities.ProcessResult{ExitCode: 1}
+	if spec.GracePeriod <= 0 {
+		spec.GracePeriod = DefaultGracePeriod
+	}
+	logger := spec.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	image, err := containerRunner.Builder.Build(ctx, signal, logger)
+	if err != nil {
+		return result, err
+	}
+	runtime, err := containerRunner.Builder.ContainerRuntime()
+	if err != nil {
+		return result, err
+	}
+
+	environment := map[string]string{}
+	for key, value := range spec.Environment {
+		environment[key] = value
+	}
+	mounts := map[string]string{}
+	if outputs := spec.Environment["SCRIPTER_OUTPUTS"]; outputs != "" {
+		directory, err := filepath.Abs(filepath.Dir(outputs))
+		if err != nil {
+			return result, fmt.Errorf("failed to mount outputs of %s: %w", signal.Sender, err)
+		}
+		mounts[directory] = containerOutputsDirectory
+		environment["SCRIPTER_OUTPUTS"] = path.Join(containerOutputsDirectory, filepath.Base(outputs))
+	}
+
+	name := "scripter-" + serviceName(signal.Sender) + "-" + serviceName(signal.Id)
+	result.Container = name
+	// A container left by an attempt that could not remove it
+	if err := replaceContainer(ctx, runtime, name, logger); err != nil {
+		return result, err
+	}
+	_, err = runtime.Create(ctx, ContainerSpec{
+		Name:             name,
+		Image:            image,
+		Command:          spec.Arguments,
+		Environment:      environment,
+		WorkingDirectory: spec.WorkingDirectory,
+		Labels:           map[string]string{"scripter.sender": signal.Sender, "scripter.signal-id": signal.Id},
+		Mounts:           mounts,
+		OpenStdin:        spec.Stdin != nil,
+		StdinOnce:        spec.Stdin != nil,
+	})
+	if err != nil {
+		return result, err
+	}
+
+	// The container is stopped and removed past the end of the context
+	background := context.WithoutCancel(ctx)
+	type exit struct {
+		code int
+		err  error
+	}
+	exited := make(chan exit, 1)
+	result.StartTime = time.Now()
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				exited <- exit{1, fmt.Errorf("running container %s panicked: %v", name, recovered)}
+			}
+		}()
+		code, err := runtime.Run(background, name, ContainerStreams{Stdin: spec.Stdin, Stdout: spec.Stdout, Stderr: spec.Stderr})
+		exited <- exit{code, err}
+	}()
+
+	var ended exit
+	select {
+	case ended = <-exited:
+	case <-ctx.Done():
+		if spec.Shutdown == ShutdownNone && !errors.Is(context.Cause(ctx), ErrAttemptTimedOut) {
+			result.Detached = true
+			result.FinishTime = time.Now()
+			return result, fmt.Errorf("%s in container %s: %w", signal.ExecutablePath, name, ErrLeftRunning)
+		}
+		logger.Info("stopping container", "container", name, "grace-period", spec.GracePeriod.String())
+		if err := runtime.Stop(background, name, spec.GracePeriod); err != nil {
+			logger.Warn("container not stopped", "container", name, "error", err)
+		}
+		ended = <-exited
+	}
+	result.FinishTime = time.Now()
+	result.ExitCode = ended.code
+	if err := runtime.Remove(background, name); err != nil {
+		logger.Warn("container not removed", "container", name, "error", err)
+	}
+
+	if ended.err != nil {
+		return result, ended.err
+	}
+	if ended.code != 0 {
+		return result, fmt.Errorf("%s exited with %d in container %s", signal.ExecutablePath, ended.code, name)
+	}
+	return result, nil
+}
@@ -0,0 +1,85 @@
+package utilities
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ContainerRuntime is the container engine containerized signals build and
+// run in. Containers are named or referred to by id alike.
+type ContainerRuntime interface {
+	Name() string
+	Build(ctx context.Context, spec ImageSpec, output io.Writer) error
+	ImageExists(ctx context.Context, image string) (bool, error)
+	// ImageDigest is the digest the registry serves the image under, or the
+	// one it was pulled at when the registry cannot be reached.
+	ImageDigest(ctx context.Context, image string) (string, error)
+	Pull(ctx context.Context, image string, output io.Writer) error
+	Create(ctx context.Context, spec ContainerSpec) (string, error)
+	Start(ctx context.Context, container string) error
+	// Exec runs a command in a running container and returns its exit code.
+	Exec(ctx context.Context, container string, exec ContainerExec) (int, error)
+	// Attach connects the streams to the main process of the container until
+	// its output ends or ctx is done.
+	Attach(ctx context.Context, container string, streams ContainerStreams) error
+	// Run starts a created container with the streams attached and returns
+	// the exit code of its main process once it ends.
+	Run(ctx context.Context, container string, streams ContainerStreams) (int, error)
+	Resize(ctx context.Context, container string, width uint, height uint) error
+	Stop(ctx context.Context, container string, timeout time.Duration) error
+	Remove(ctx context.Context, container string) error
+	ContainerExists(ctx context.Context, container string) (bool, error)
+	Logs(ctx context.Context, container string, streams ContainerStreams) error
+	Close() error
+}
+
+// ImageSpec is an image built from a Dockerfile and the files its build
+// context holds besides it.
+type ImageSpec struct {
+	Tag        string
+	Dockerfile string
+	Files      map[string]string // Path in the build context to the file on the host
+	Labels     map[string]string
+}
+
+type ContainerSpec struct {
+	Name             string
+	Image            string
+	Command          []string // The image's own command when empty
+	Environment      map[string]string
+	WorkingDirectory string
+	Labels           map[string]string
+	Mounts           map[string]string // Host directory to the path it is mounted at
+	Tty              bool
+	OpenStdin        bool
+	StdinOnce        bool // Stdin closes once the first attachment ends
+}
+
+type ContainerExec struct {
+	Command []string
+	User    string
+	Tty     bool
+	Stdout  io.Writer
+	Stderr  io.Writer
+}
+
+type ContainerStreams struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// NewContainerRuntime builds the runtime named by kind: docker or podman. Host
+// is the daemon socket, the runtime's own default when empty.
+func NewContainerRuntime(kind string, host string) (ContainerRuntime, error) {
+	switch kind {
+	case "", "docker":
+		return NewDockerRuntime(host)
+	case "podman":
+		return NewPodmanRuntime(host)
+	default:
+		return nil, fmt.Errorf("unsupported container runtime %q: choose docker or podman", kind)
+	}
+}
@@ -0,0 +1,202 @@
+package utilities
+
+import (
+	"fmt"
+	"scripter/entities"
+	"sort"
+	"strings"
+)
+
+// DependencyGraphHandler turns the flow dependencies of a signal into a graph:
+// every dependency template is resolved in turn and contributes its own
+// execution dependencies. An edge goes from a template to each dependency,
+// which runs once that template completed. Dependencies whose "when" condition
+// does not hold for the template declaring them are not part of the graph.
+type DependencyGraphHandler struct{}
+
+func (graphHandler DependencyGraphHandler) Build(signal entities.Signal) (entities.DependencyGraph, error) {
+	graph := entities.DependencyGraph{Root: signal.SourcePath, Nodes: map[string]*entities.DependencyNode{}}
+
+	root := &entities.DependencyNode{Id: signal.SourcePath, Name: signal.Sender, Reference: signal.SourcePath}
+	graph.Nodes[root.Id] = root
+	pending := []*entities.DependencyNode{}
+
+	addDependencies := func(parent *entities.DependencyNode, dependencySignal entities.Signal) {
+		variables := conditionExpression.SignalVariables(dependencySignal)
+		for _, emitQuay := range dependencySignal.EmitQuays {
+			if emitQuay.Relationship != entities.FlowDependency {
+				continue
+			}
+			holds, conditionErr := conditionExpression.Holds(emitQuay.When, variables)
+			if conditionErr == nil && !holds {
+				continue
+			}
+			node := &entities.DependencyNode{Id: emitQuay.Path, Name: emitQuay.Name, Reference: emitQuay.Path}
+			resolvedPath, err := fileReader.ResolveTemplatePath(emitQuay.Path, parent.Id)
+			if conditionErr != nil {
+				node.Error = conditionErr.Error()
+			} else if err != nil {
+				node.Error = err.Error()
+			} else {
+				node.Id = resolvedPath
+			}
+			if existing, exists := graph.Nodes[node.Id]; exists {
+				node = existing
+			} else {
+				graph.Nodes[node.Id] = node
+				pending = append(pending, node)
+			}
+			if !stringHandler.ContainsString(parent.Dependencies, node.Id) {
+				parent.Dependencies = append(parent.Dependencies, node.Id)
+			}
+		}
+	}
+
+	addDependencies(root, signal)
+	for len(pending) > 0 {
+		node := pending[0]
+		pending = pending[1:]
+		if node.Error != "" {
+			continue
+		}
+		dependencySignal, err := loadSignal(node.Id)
+		if err != nil {
+			node.Error = err.Error()
+			continue
+		}
+		if node.Name == "" {
+			node.Name = dependencySignal.Sender
+		}
+		addDependencies(node, dependencySignal)
+	}
+
+	order, err := graphHandler.TopologicalOrder(graph)
+	if err != nil {
+		return graph, err
+	}
+	graph.Order = order
+	return graph, nil
+}
+
+// TopologicalOrder sorts the nodes so every node comes after all the nodes
+// that depend on it, and reports the nodes involved when there is a cycle.
+func (graphHandler DependencyGraphHandler) TopologicalOrder(graph entities.DependencyGraph) ([]string, error) {
+	incoming := graphHandler.IncomingCounts(graph)
+
+	ready := []string{}
+	for id, count := range incoming {
+		if count == 0 {
+			ready = append(ready, id)
+		}
+	}
+	sort.Strings(ready)
+
+	order := []string{}
+	for len(ready) > 0 {
+		id := ready[0]
+		ready = ready[1:]
+		order = append(order, id)
+		for _, dependency := range graph.Nodes[id].Dependencies {
+			incoming[dependency]--
+			if incoming[dependency] == 0 {
+				ready = append(ready, dependency)
+			}
+		}
+	}
+
+	if len(order) < len(graph.Nodes) {
+		cycle := []string{}
+		for id, count := range incoming {
+			if count > 0 {
+				cycle = append(cycle, id)
+			}
+		}
+		sort.Strings(cycle)
+		return nil, fmt.Errorf("dependency cycle between %s", strings.Join(cycle, ", "))
+	}
+	return order, nil
+}
+
+func (graphHandler DependencyGraphHandler) IncomingCounts(graph entities.DependencyGraph) map[string]int {
+	incoming := map[string]int{}
+	for id, node := range graph.Nodes {
+		if _, exists := incoming[id]; !exists {
+			incoming[id] = 0
+		}
+		for _, dependency := range node.Dependencies {
+			incoming[dependency]++
+		}
+	}
+	return incoming
+}
+
+func (graphHandler DependencyGraphHandler) RenderDot(graph entities.DependencyGraph) string {
+	var builder strings.Builder
+	builder.WriteString("digraph dependencies {\n")
+	builder.WriteString("  rankdir=LR;\n")
+	for _, id := range sortedNodeIds(graph) {
+		node := graph.Nodes[id]
+		attributes := fmt.Sprintf("label=%q", node.Name)
+		if node.Error != "" {
+			attributes += ", style=dashed, color=red, tooltip=" + fmt.Sprintf("%q", node.Error)
+		}
+		builder.WriteString(fmt.Sprintf("  %q [%s];\n", id, attributes))
+	}
+	for _, id := range sortedNodeIds(graph) {
+		for _, dependency := range graph.Nodes[id].Dependencies {
+			builder.WriteString(fmt.Sprintf("  %q -> %q;\n", id, dependency))
+		}
+	}
+	builder.WriteString("}\n")
+	return builder.String()
+}
+
+func (graphHandler DependencyGraphHandler) RenderMermaid(graph entities.DependencyGraph) string {
+	identifiers := map[string]string{}
+	for index, id := range sortedNodeIds(graph) {
+		identifiers[id] = fmt.Sprintf("n%d", index)
+	}
+
+	var builder strings.Builder
+	builder.WriteString("flowchart LR\n")
+	for _, id := range sortedNodeIds(graph) {
+		node := graph.Nodes[id]
+		builder.WriteString(fmt.Sprintf("  %s[\"%s\"]\n", identifiers[id], strings.ReplaceAll(node.Name, "\"", "'")))
+		if node.Error != "" {
+			builder.WriteString(fmt.Sprintf("  style %s stroke:#d00,stroke-dasharray: 5 5\n", identifiers[id]))
+		}
+	}
+	for _, id := range sortedNodeIds(graph) {
+		for _, dependency := range graph.Nodes[id].Dependencies {
+			builder.WriteString(fmt.Sprintf("  %s --> %s\n", identifiers[id], identifiers[dependency]))
+		}
+	}
+	return builder.String()
+}
+
+// loadSignal resolves a template into a signal only to read its dependencies.
+func loadSignal(path string) (entities.Signal, error) {
+	yamls, err := fileReader.LoadAllYamls(path)
+	if err != nil {
+		return entities.Signal{}, err
+	}
+	generalProperties, contextProperties, signalSteps, labels, err := objectHandler.GenerateYamlProperties(yamls)
+	if err != nil {
+		return entities.Signal{}, err
+	}
+	signal, err := objectHandler.GenerateSignal(generalProperties, contextProperties, signalSteps, labels, "", "", "")
+	if err != nil {
+		return entities.Signal{}, err
+	}
+	signal.SourcePath = path
+	return signal, nil
+}
+
+func sortedNodeIds(graph entities.DependencyGraph) []string {
+	ids := []string{}
+	for id := range graph.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,234 @@
+package utilities
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"scripter/entities"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testGraph builds a graph rooted at "root" from a list of edges written
+// "node>dependency".
+func testGraph(edges ...string) entities.DependencyGraph {
+	graph := entities.DependencyGraph{Root: "root", Nodes: map[string]*entities.DependencyNode{"root": {Id: "root", Name: "root"}}}
+	node := func(id string) *entities.DependencyNode {
+		if _, exists := graph.Nodes[id]; !exists {
+			graph.Nodes[id] = &entities.DependencyNode{Id: id, Name: id}
+		}
+		return graph.Nodes[id]
+	}
+	for _, edge := range edges {
+		from, to, _ := strings.Cut(edge, ">")
+		node(from).Dependencies = append(node(from).Dependencies, node(to).Id)
+	}
+	return graph
+}
+
+func TestTopologicalOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		graph entities.DependencyGraph
+		want  string
+		cycle string
+	}{
+		{"root alone", testGraph(), "root", ""},
+		{"chain", testGraph("root>build", "build>test", "test>deploy"), "root build test deploy", ""},
+		{"diamond", testGraph("root>left", "root>right", "left>merge", "right>merge"), "root left right merge", ""},
+		{"shared dependency waits for every dependent", testGraph("root>a", "root>b", "a>b"), "root a b", ""},
+		{"cycle", testGraph("root>a", "a>b", "b>a"), "", "a, b"},
+		{"self dependency", testGraph("root>a", "a>a"), "", "a"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			order, err := DependencyGraphHandler{}.TopologicalOrder(test.graph)
+			if test.cycle != "" {
+				if err == nil || !strings.Contains(err.Error(), "cycle between "+test.cycle) {
+					t.Errorf("error %v, want a cycle between %s", err, test.cycle)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(order, " "); got != test.want {
+				t.Errorf("order %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func writeTemplate(t *testing.T, directory string, name string, dependencies ...string) {
+	t.Helper()
+	content := fmt.Sprintf("header:\n  name: %s\naction:\n  name-or-full-path: echo\n", name)
+	if len(dependencies) > 0 {
+		content += "  execution-dependencies:\n"
+		for _, dependency := range dependencies {
+			content += "    - " + dependency + "\n"
+		}
+	}
+	if err := os.WriteFile(filepath.Join(directory, name+".yaml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDependencyGraphHandlerBuild(t *testing.T) {
+	directory := t.TempDir()
+	writeTemplate(t, directory, "build", "path: test.yaml", "path: lint.yaml")
+	writeTemplate(t, directory, "test", "path: deploy.yaml")
+	writeTemplate(t, directory, "lint", "path: deploy.yaml", "{path: never.yaml, when: signal.os == \"nothing\"}")
+	writeTemplate(t, directory, "deploy")
+
+	root := entities.Signal{
+		Sender:     "release",
+		SourcePath: filepath.Join(directory, "release.yaml"),
+		EmitQuays: []entities.EmitQuay{
+			{Name: "build", Path: "build.yaml", Relationship: entities.FlowDependency},
+			{Name: "missing", Path: "missing.yaml", Relationship: entities.FlowDependency},
+			{Name: "step", Path: "test.yaml", Relationship: entities.StepDependency},
+		},
+	}
+	graph, err := DependencyGraphHandler{}.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, id := range graph.Order {
+		names = append(names, graph.Nodes[id].Name)
+	}
+	if got := strings.Join(names, " "); got != "release build missing test lint deploy" {
+		t.Errorf("order %s, want release build missing test lint deploy", got)
+	}
+	for _, node := range graph.Nodes {
+		if node.Name == "never" {
+			t.Error("dependency whose condition does not hold is part of the graph")
+		}
+		if (node.Name == "missing") != (node.Error != "") {
+			t.Errorf("node %s error %q", node.Name, node.Error)
+		}
+	}
+}
+
+func TestDependencyGraphHandlerBuildReportsCycles(t *testing.T) {
+	directory := t.TempDir()
+	writeTemplate(t, directory, "first", "path: second.yaml")
+	writeTemplate(t, directory, "second", "path: first.yaml")
+	root := entities.Signal{
+		Sender:     "release",
+		SourcePath: filepath.Join(directory, "release.yaml"),
+		EmitQuays:  []entities.EmitQuay{{Name: "first", Path: "first.yaml", Relationship: entities.FlowDependency}},
+	}
+	_, err := DependencyGraphHandler{}.Build(root)
+	if err == nil || !strings.Contains(err.Error(), "first.yaml") || !strings.Contains(err.Error(), "second.yaml") {
+		t.Errorf("error %v, want the cycle between first and second", err)
+	}
+}
+
+func TestGraphExecutorRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		graph  entities.DependencyGraph
+		failed string
+		want   map[string]string
+	}{
+		{
+			"every node succeeds",
+			testGraph("root>a", "a>b"),
+			"",
+			map[string]string{"root": StepSucceeded, "a": StepSucceeded, "b": StepSucceeded},
+		},
+		{
+			"descendants of a failed node are skipped",
+			testGraph("root>a", "root>b", "a>c", "c>d", "b>e"),
+			"a",
+			map[string]string{"a": StepFailed, "b": StepSucceeded, "c": StepSkipped, "d": StepSkipped, "e": StepSucceeded},
+		},
+		{
+			"a node one of its dependents failed is skipped",
+			testGraph("root>a", "root>b", "a>merge", "b>merge"),
+			"b",
+			map[string]string{"a": StepSucceeded, "b": StepFailed, "merge": StepSkipped},
+		},
+		{
+			"a panicking node fails",
+			testGraph("root>panics", "panics>after"),
+			"panics",
+			map[string]string{"panics": StepFailed, "after": StepSkipped},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mutex sync.Mutex
+			ran := map[string]bool{}
+			results := GraphExecutor{Parallelism: 2}.Run(test.graph, func(node entities.DependencyNode) (int, error) {
+				mutex.Lock()
+				ran[node.Id] = true
+				mutex.Unlock()
+				if node.Id == "panics" {
+					panic("node panicked")
+				}
+				if node.Id == test.failed {
+					return 3, fmt.Errorf("%s failed", node.Id)
+				}
+				return 0, nil
+			})
+			for id, status := range test.want {
+				if results[id].Status != status {
+					t.Errorf("%s %s, want %s", id, results[id].Status, status)
+				}
+				if status == StepSkipped && ran[id] {
+					t.Errorf("skipped node %s ran", id)
+				}
+			}
+			if test.failed != "" && results[test.failed].ExitCode == 0 {
+				t.Errorf("failed node %s has exit code 0", test.failed)
+			}
+		})
+	}
+}
+
+func TestGraphExecutorRunFailsNodesWithErrorsWithoutRunningThem(t *testing.T) {
+	graph := testGraph("root>unresolved", "unresolved>after")
+	graph.Nodes["unresolved"].Error = "template not found"
+	results := GraphExecutor{}.Run(graph, func(node entities.DependencyNode) (int, error) {
+		t.Errorf("%s ran", node.Id)
+		return 0, nil
+	})
+	if results["unresolved"].Status != StepFailed || results["unresolved"].Error != "template not found" {
+		t.Errorf("result %+v, want failed with the node error", results["unresolved"])
+	}
+	if results["after"].Status != StepSkipped {
+		t.Errorf("after %s, want skipped", results["after"].Status)
+	}
+}
+
+func TestGraphExecutorRunKeepsToItsParallelism(t *testing.T) {
+	for _, parallelism := range []int{0, 1, 3} {
+		t.Run(fmt.Sprint(parallelism), func(t *testing.T) {
+			edges := []string{}
+			for index := range 8 {
+				edges = append(edges, fmt.Sprintf("root>n%d", index))
+			}
+			var mutex sync.Mutex
+			running, peak := 0, 0
+			GraphExecutor{Parallelism: parallelism}.Run(testGraph(edges...), func(node entities.DependencyNode) (int, error) {
+				mutex.Lock()
+				running++
+				peak = max(peak, running)
+				mutex.Unlock()
+				time.Sleep(10 * time.Millisecond)
+				mutex.Lock()
+				running--
+				mutex.Unlock()
+				return 0, nil
+			})
+			if want := max(parallelism, 1); peak != want {
+				t.Errorf("%d nodes ran at once, want %d", peak, want)
+			}
+		})
+	}
+}
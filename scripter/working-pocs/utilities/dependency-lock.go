@@ -0,0 +1,105 @@
+package utilities
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"scripter/entities"
+	"sync"
+	"time"
+)
+
+// DependencyLock records the version every dependency was installed at in a
+// JSON file, keyed by installer and package. Checked in next to the
+// templates, it makes every host install the same versions. An empty path
+// turns locking off.
+type DependencyLock struct {
+	Path string
+}
+
+var dependencyLockMutex sync.Mutex
+
+func (dependencyLock DependencyLock) Get(installer string, name string) (entities.LockedDependency, bool, error) {
+	if dependencyLock.Path == "" {
+		return entities.LockedDependency{}, false, nil
+	}
+	dependencyLockMutex.Lock()
+	defer dependencyLockMutex.Unlock()
+
+	locked, err := dependencyLock.load()
+	if err != nil {
+		return entities.LockedDependency{}, false, err
+	}
+	dependency, exists := locked[lockKey(installer, name)]
+	return dependency, exists, nil
+}
+
+// Record keeps the version a dependency is installed at, leaving the file
+// alone when it already says so.
+func (dependencyLock DependencyLock) Record(dependency entities.LockedDependency) error {
+	if dependencyLock.Path == "" {
+		return nil
+	}
+	dependencyLockMutex.Lock()
+	defer dependencyLockMutex.Unlock()
+
+	locked, err := dependencyLock.load()
+	if err != nil {
+		return err
+	}
+	key := lockKey(dependency.Installer, dependency.Name)
+	if previous, exists := locked[key]; exists && previous.Version == dependency.Version && previous.Constraint == dependency.Constraint {
+		return nil
+	}
+	dependency.LockedAt = time.Now().UTC()
+	locked[key] = dependency
+	return dependencyLock.save(locked)
+}
+
+func (dependencyLock DependencyLock) load() (map[string]entities.LockedDependency, error) {
+	locked := map[string]entities.LockedDependency{}
+
+	data, err := os.ReadFile(dependencyLock.Path)
+	if os.IsNotExist(err) {
+		return locked, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock file %s: %w", dependencyLock.Path, err)
+	}
+	if err := json.Unmarshal(data, &locked); err != nil {
+		return nil, fmt.Errorf("malformed lock file %s: %w", dependencyLock.Path, err)
+	}
+	return locked, nil
+}
+
+// save writes through a temporary file so readers never see a partial lock.
+func (dependencyLock DependencyLock) save(locked map[string]entities.LockedDependency) error {
+	// Constraints read as written, ">=7" rather than "\u003e=7"
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(locked); err != nil {
+		return fmt.Errorf("failed to encode lock file: %w", err)
+	}
+	temporary, err := os.CreateTemp(filepath.Dir(dependencyLock.Path), ".lock-*")
+	if err != nil {
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+	defer os.Remove(temporary.Name())
+
+	if _, err := temporary.Write(data.Bytes()); err != nil {
+		temporary.Close()
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+	if err := temporary.Close(); err != nil {
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+	return os.Rename(temporary.Name(), dependencyLock.Path)
+}
+
+func lockKey(installer string, name string) string {
+	return installer + ":" + name
+}
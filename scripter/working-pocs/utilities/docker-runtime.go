@@ -0,0 +1,388 @@
+package utilities
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/build"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/stdcopy"
+	mobyterm "github.com/moby/term"
+)
+
+// DockerRuntime drives a daemon through the Docker API. Podman serves the
+// same API on a socket of its own, so it is driven the same way.
+type DockerRuntime struct {
+	client *client.Client
+	name   string
+}
+
+// NewDockerRuntime connects to the host given, or to the one DOCKER_HOST
+// names.
+func NewDockerRuntime(host string) (*DockerRuntime, error) {
+	return newDockerApiRuntime("docker", host)
+}
+
+// NewPodmanRuntime connects to the Docker compatible socket of Podman, the
+// one of the system service when scripter is root and the one of the user's
+// service otherwise, unless CONTAINER_HOST or host names another.
+func NewPodmanRuntime(host string) (*DockerRuntime, error) {
+	if host == "" {
+		host = os.Getenv("CONTAINER_HOST")
+	}
+	if host == "" {
+		host = "unix:///run/podman/podman.sock"
+		if runtimeDirectory := os.Getenv("XDG_RUNTIME_DIR"); os.Geteuid() > 0 && runtimeDirectory != "" {
+			host = "unix://" + filepath.Join(runtimeDirectory, "podman", "podman.sock")
+		}
+	}
+	return newDockerApiRuntime("podman", host)
+}
+
+func newDockerApiRuntime(name string, host string) (*DockerRuntime, error) {
+	options := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+	if host != "" {
+		options = append(options, client.WithHost(host))
+	}
+	cli, err := client.NewClientWithOpts(options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s client: %w", name, err)
+	}
+	return &DockerRuntime{client: cli, name: name}, nil
+}
+
+func (runtime *DockerRuntime) Name() string {
+	return runtime.name
+}
+
+func (runtime *DockerRuntime) Build(ctx context.Context, spec ImageSpec, output io.Writer) error {
+	var buildContext bytes.Buffer
+	archive := tar.NewWriter(&buildContext)
+	if err := writeContextFile(archive, "Dockerfile", []byte(spec.Dockerfile), 0644); err != nil {
+		return fmt.Errorf("failed to write build context of %s: %w", spec.Tag, err)
+	}
+	for _, name := range sortedKeys(spec.Files) {
+		info, err := os.Stat(spec.Files[name])
+		if err != nil {
+			return fmt.Errorf("failed to write build context of %s: %w", spec.Tag, err)
+		}
+		content, err := os.ReadFile(spec.Files[name])
+		if err != nil {
+			return fmt.Errorf("failed to write build context of %s: %w", spec.Tag, err)
+		}
+		if err := writeContextFile(archive, name, content, int64(info.Mode().Perm())); err != nil {
+			return fmt.Errorf("failed to write build context of %s: %w", spec.Tag, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to write build context of %s: %w", spec.Tag, err)
+	}
+
+	response, err := runtime.client.ImageBuild(ctx, &buildContext, build.ImageBuildOptions{
+		Tags:       []string{spec.Tag},
+		Dockerfile: "Dockerfile",
+		Remove:     true,
+		Labels:     spec.Labels,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build image %s: %w", spec.Tag, err)
+	}
+	defer response.Body.Close()
+	// A failing instruction comes back as an error message in the stream
+	if err := displayJsonMessages(response.Body, output); err != nil {
+		return fmt.Errorf("failed to build image %s: %w", spec.Tag, err)
+	}
+	return nil
+}
+
+func (runtime *DockerRuntime) ImageExists(ctx context.Context, image string) (bool, error) {
+	_, err := runtime.client.ImageInspect(ctx, image)
+	if cerrdefs.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect image %s: %w", image, err)
+	}
+	return true, nil
+}
+
+func (runtime *DockerRuntime) ImageDigest(ctx context.Context, imageName string) (string, error) {
+	distribution, err := runtime.client.DistributionInspect(ctx, imageName, "")
+	if err == nil {
+		return string(distribution.Descriptor.Digest), nil
+	}
+	inspected, inspectErr := runtime.client.ImageInspect(ctx, imageName)
+	if inspectErr != nil {
+		return "", fmt.Errorf("failed to find digest of image %s: %w", imageName, err)
+	}
+	repository, _, _ := strings.Cut(imageName, ":")
+	for _, repoDigest := range inspected.RepoDigests {
+		if name, digest, found := strings.Cut(repoDigest, "@"); found && (name == repository || strings.HasSuffix(name, "/"+repository)) {
+			return digest, nil
+		}
+	}
+	return "", fmt.Errorf("failed to find digest of image %s: %w", imageName, err)
+}
+
+func (runtime *DockerRuntime) Pull(ctx context.Context, imageName string, output io.Writer) error {
+	reader, err := runtime.client.ImagePull(ctx, imageName, image.PullOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", imageName, err)
+	}
+	defer reader.Close()
+	if err := displayJsonMessages(reader, output); err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", imageName, err)
+	}
+	return nil
+}
+
+func (runtime *DockerRuntime) Create(ctx context.Context, spec ContainerSpec) (string, error) {
+	config := &container.Config{
+		Image:        spec.Image,
+		Cmd:          spec.Command,
+		WorkingDir:   spec.WorkingDirectory,
+		Labels:       spec.Labels,
+		Tty:          spec.Tty,
+		OpenStdin:    spec.OpenStdin,
+		StdinOnce:    spec.StdinOnce,
+		AttachStdin:  spec.OpenStdin,
+		AttachStdout: true,
+		AttachStderr: true,
+	}
+	for _, key := range sortedKeys(spec.Environment) {
+		config.Env = append(config.Env, key+"="+spec.Environment[key])
+	}
+	hostConfig := &container.HostConfig{}
+	for _, directory := range sortedKeys(spec.Mounts) {
+		hostConfig.Binds = append(hostConfig.Binds, directory+":"+spec.Mounts[directory])
+	}
+	response, err := runtime.client.ContainerCreate(ctx, config, hostConfig, nil, nil, spec.Name)
+	if err != nil {
+		return "", fmt.Errorf("failed to create container %s: %w", spec.Name, err)
+	}
+	return response.ID, nil
+}
+
+func (runtime *DockerRuntime) Start(ctx context.Context, containerName string) error {
+	if err := runtime.client.ContainerStart(ctx, containerName, container.StartOptions{}); err != nil {
+		return fmt.Errorf("failed to start container %s: %w", containerName, err)
+	}
+	return nil
+}
+
+func (runtime *DockerRuntime) Exec(ctx context.Context, containerName string, exec ContainerExec) (int, error) {
+	created, err := runtime.client.ContainerExecCreate(ctx, containerName, container.ExecOptions{
+		User:         exec.User,
+		Tty:          exec.Tty,
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          exec.Command,
+	})
+	if err != nil {
+		return 1, fmt.Errorf("failed to create exec %v in %s: %w", exec.Command, containerName, err)
+	}
+
+	attached, err := runtime.client.ContainerExecAttach(ctx, created.ID, container.ExecAttachOptions{Tty: exec.Tty})
+	if err != nil {
+		return 1, fmt.Errorf("failed to attach to exec %v in %s: %w", exec.Command, containerName, err)
+	}
+	defer attached.Close()
+	if err := copyContainerOutput(attached.Reader, exec.Tty, exec.Stdout, exec.Stderr); err != nil {
+		return 1, fmt.Errorf("failed to read output of exec %v in %s: %w", exec.Command, containerName, err)
+	}
+
+	inspected, err := runtime.client.ContainerExecInspect(ctx, created.ID)
+	if err != nil {
+		return 1, fmt.Errorf("failed to inspect exec %v in %s: %w", exec.Command, containerName, err)
+	}
+	return inspected.ExitCode, nil
+}
+
+func (runtime *DockerRuntime) Attach(ctx context.Context, containerName string, streams ContainerStreams) error {
+	tty, err := runtime.hasTty(ctx, containerName)
+	if err != nil {
+		return err
+	}
+	attached, err := runtime.client.ContainerAttach(ctx, containerName, container.AttachOptions{
+		Stream:     true,
+		Stdin:      streams.Stdin != nil,
+		Stdout:     true,
+		Stderr:     true,
+		DetachKeys: "ctrl-p,ctrl-q",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to attach to container %s: %w", containerName, err)
+	}
+	defer attached.Close()
+
+	if streams.Stdin != nil {
+		go func() {
+			io.Copy(attached.Conn, streams.Stdin)
+			attached.CloseWrite()
+		}()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- copyContainerOutput(attached.Reader, tty, streams.Stdout, streams.Stderr)
+	}()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("attachment to container %s ended: %w", containerName, err)
+	}
+	return nil
+}
+
+// Run attaches and waits for the exit before starting, so neither the first
+// output nor a quick exit is missed.
+func (runtime *DockerRuntime) Run(ctx context.Context, containerName string, streams ContainerStreams) (int, error) {
+	tty, err := runtime.hasTty(ctx, containerName)
+	if err != nil {
+		return 1, err
+	}
+	attached, err := runtime.client.ContainerAttach(ctx, containerName, container.AttachOptions{
+		Stream: true,
+		Stdin:  streams.Stdin != nil,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		return 1, fmt.Errorf("failed to attach to container %s: %w", containerName, err)
+	}
+	defer attached.Close()
+	waited, waitErrs := runtime.client.ContainerWait(ctx, containerName, container.WaitConditionNextExit)
+
+	if err := runtime.Start(ctx, containerName); err != nil {
+		return 1, err
+	}
+	if streams.Stdin != nil {
+		go func() {
+			io.Copy(attached.Conn, streams.Stdin)
+			attached.CloseWrite()
+		}()
+	}
+	copyErr := copyContainerOutput(attached.Reader, tty, streams.Stdout, streams.Stderr)
+
+	select {
+	case status := <-waited:
+		if status.Error != nil {
+			return 1, fmt.Errorf("failed to wait for container %s: %s", containerName, status.Error.Message)
+		}
+		if copyErr != nil {
+			return int(status.StatusCode), fmt.Errorf("failed to read output of container %s: %w", containerName, copyErr)
+		}
+		return int(status.StatusCode), nil
+	case err := <-waitErrs:
+		return 1, fmt.Errorf("failed to wait for container %s: %w", containerName, err)
+	}
+}
+
+func (runtime *DockerRuntime) Resize(ctx context.Context, containerName string, width uint, height uint) error {
+	if err := runtime.client.ContainerResize(ctx, containerName, container.ResizeOptions{Width: width, Height: height}); err != nil {
+		return fmt.Errorf("failed to resize container %s: %w", containerName, err)
+	}
+	return nil
+}
+
+func (runtime *DockerRuntime) Stop(ctx context.Context, containerName string, timeout time.Duration) error {
+	seconds := int(timeout.Seconds())
+	if err := runtime.client.ContainerStop(ctx, containerName, container.StopOptions{Timeout: &seconds}); err != nil {
+		return fmt.Errorf("failed to stop container %s: %w", containerName, err)
+	}
+	return nil
+}
+
+func (runtime *DockerRuntime) Remove(ctx context.Context, containerName string) error {
+	if err := runtime.client.ContainerRemove(ctx, containerName, container.RemoveOptions{}); err != nil {
+		return fmt.Errorf("failed to remove container %s: %w", containerName, err)
+	}
+	return nil
+}
+
+func (runtime *DockerRuntime) ContainerExists(ctx context.Context, containerName string) (bool, error) {
+	_, err := runtime.client.ContainerInspect(ctx, containerName)
+	if cerrdefs.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect container %s: %w", containerName, err)
+	}
+	return true, nil
+}
+
+func (runtime *DockerRuntime) Logs(ctx context.Context, containerName string, streams ContainerStreams) error {
+	tty, err := runtime.hasTty(ctx, containerName)
+	if err != nil {
+		return err
+	}
+	reader, err := runtime.client.ContainerLogs(ctx, containerName, container.LogsOptions{ShowStdout: true, ShowStderr: true})
+	if err != nil {
+		return fmt.Errorf("failed to read logs of container %s: %w", containerName, err)
+	}
+	defer reader.Close()
+	return copyContainerOutput(reader, tty, streams.Stdout, streams.Stderr)
+}
+
+func (runtime *DockerRuntime) Close() error {
+	return runtime.client.Close()
+}
+
+func (runtime *DockerRuntime) hasTty(ctx context.Context, containerName string) (bool, error) {
+	inspected, err := runtime.client.ContainerInspect(ctx, containerName)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect container %s: %w", containerName, err)
+	}
+	return inspected.Config != nil && inspected.Config.Tty, nil
+}
+
+func writeContextFile(archive *tar.Writer, name string, content []byte, mode int64) error {
+	if err := archive.WriteHeader(&tar.Header{Name: name, Size: int64(len(content)), Mode: mode}); err != nil {
+		return err
+	}
+	_, err := archive.Write(content)
+	return err
+}
+
+// Without a TTY stdout and stderr come multiplexed in one stream.
+func copyContainerOutput(reader io.Reader, tty bool, stdout io.Writer, stderr io.Writer) error {
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	var err error
+	if tty {
+		_, err = io.Copy(stdout, reader)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, reader)
+	}
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// displayJsonMessages renders build and pull progress, as the docker CLI
+// does when output is a terminal.
+func displayJsonMessages(reader io.Reader, output io.Writer) error {
+	if output == nil {
+		output = io.Discard
+	}
+	termFd, isTerm := mobyterm.GetFdInfo(output)
+	return jsonmessage.DisplayJSONMessagesStream(reader, output, termFd, isTerm, nil)
+}
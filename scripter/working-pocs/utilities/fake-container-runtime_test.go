@@ -0,0 +1,247 @@
+package utilities
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeContainerRuntime keeps images and containers in memory and runs
+// nothing, so containerized paths can be exercised without a daemon. Every
+// call is recorded in Calls; an error set in Errors for an operation ("build",
+// "image-digest", "pull", "create", "start", "exec", "attach", "run",
+// "resize", "stop", "remove", "logs") makes every call of it fail.
+type FakeContainerRuntime struct {
+	mutex      sync.Mutex
+	Images     map[string]ImageSpec
+	Containers map[string]*FakeContainer
+	Calls      []string
+	Errors     map[string]error
+	// ExecExitCode decides how an exec ends, 0 when it is not set.
+	ExecExitCode func(container FakeContainer, exec ContainerExec) int
+	// RunExitCode decides how a run ends, 0 when it is not set.
+	RunExitCode func(container FakeContainer) int
+	nextId      int
+}
+
+type FakeContainer struct {
+	Id      string
+	Spec    ContainerSpec
+	Running bool
+	Execs   [][]string
+	Output  string // What attaching and the logs print
+}
+
+func NewFakeContainerRuntime() *FakeContainerRuntime {
+	return &FakeContainerRuntime{
+		Images:     map[string]ImageSpec{},
+		Containers: map[string]*FakeContainer{},
+		Errors:     map[string]error{},
+	}
+}
+
+func (runtime *FakeContainerRuntime) Name() string {
+	return "fake"
+}
+
+func (runtime *FakeContainerRuntime) Build(ctx context.Context, spec ImageSpec, output io.Writer) error {
+	if err := runtime.call("build", spec.Tag); err != nil {
+		return err
+	}
+	runtime.mutex.Lock()
+	defer runtime.mutex.Unlock()
+	runtime.Images[spec.Tag] = spec
+	return nil
+}
+
+func (runtime *FakeContainerRuntime) ImageExists(ctx context.Context, image string) (bool, error) {
+	runtime.call("image-exists", image)
+	runtime.mutex.Lock()
+	defer runtime.mutex.Unlock()
+	_, exists := runtime.Images[image]
+	return exists, nil
+}
+
+// ImageDigest makes up a digest from the name, the same one every time.
+func (runtime *FakeContainerRuntime) ImageDigest(ctx context.Context, image string) (string, error) {
+	if err := runtime.call("image-digest", image); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(image))
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+func (runtime *FakeContainerRuntime) Pull(ctx context.Context, image string, output io.Writer) error {
+	if err := runtime.call("pull", image); err != nil {
+		return err
+	}
+	runtime.mutex.Lock()
+	defer runtime.mutex.Unlock()
+	if _, exists := runtime.Images[image]; !exists {
+		runtime.Images[image] = ImageSpec{Tag: image}
+	}
+	return nil
+}
+
+func (runtime *FakeContainerRuntime) Create(ctx context.Context, spec ContainerSpec) (string, error) {
+	if err := runtime.call("create", spec.Name); err != nil {
+		return "", err
+	}
+	runtime.mutex.Lock()
+	defer runtime.mutex.Unlock()
+	if _, exists := runtime.Images[spec.Image]; !exists {
+		return "", fmt.Errorf("failed to create container %s: no image %s", spec.Name, spec.Image)
+	}
+	if spec.Name != "" && runtime.find(spec.Name) != nil {
+		return "", fmt.Errorf("failed to create container %s: the name is in use", spec.Name)
+	}
+	runtime.nextId++
+	id := "fake-" + strconv.Itoa(runtime.nextId)
+	runtime.Containers[id] = &FakeContainer{Id: id, Spec: spec}
+	return id, nil
+}
+
+func (runtime *FakeContainerRuntime) Start(ctx context.Context, container string) error {
+	return runtime.update("start", container, func(found *FakeContainer) error {
+		found.Running = true
+		return nil
+	})
+}
+
+func (runtime *FakeContainerRuntime) Exec(ctx context.Context, container string, exec ContainerExec) (int, error) {
+	exitCode := 0
+	err := runtime.update("exec", container, func(found *FakeContainer) error {
+		if !found.Running {
+			return fmt.Errorf("failed to exec %v in %s: container is not running", exec.Command, container)
+		}
+		found.Execs = append(found.Execs, exec.Command)
+		if runtime.ExecExitCode != nil {
+			exitCode = runtime.ExecExitCode(*found, exec)
+		}
+		return nil
+	})
+	if err != nil {
+		return 1, err
+	}
+	return exitCode, nil
+}
+
+func (runtime *FakeContainerRuntime) Attach(ctx context.Context, container string, streams ContainerStreams) error {
+	return runtime.writeOutput("attach", container, streams)
+}
+
+// Run prints the output of the container and ends at once, leaving it
+// stopped.
+func (runtime *FakeContainerRuntime) Run(ctx context.Context, container string, streams ContainerStreams) (int, error) {
+	exitCode := 0
+	output := ""
+	err := runtime.update("run", container, func(found *FakeContainer) error {
+		if found.Running {
+			return fmt.Errorf("failed to run container %s: it is running", container)
+		}
+		output = found.Output
+		if runtime.RunExitCode != nil {
+			exitCode = runtime.RunExitCode(*found)
+		}
+		return nil
+	})
+	if err != nil {
+		return 1, err
+	}
+	if streams.Stdout != nil {
+		if _, err := io.WriteString(streams.Stdout, output); err != nil {
+			return exitCode, err
+		}
+	}
+	return exitCode, nil
+}
+
+func (runtime *FakeContainerRuntime) Resize(ctx context.Context, container string, width uint, height uint) error {
+	return runtime.update("resize", container, func(found *FakeContainer) error { return nil })
+}
+
+func (runtime *FakeContainerRuntime) Stop(ctx context.Context, container string, timeout time.Duration) error {
+	return runtime.update("stop", container, func(found *FakeContainer) error {
+		found.Running = false
+		return nil
+	})
+}
+
+func (runtime *FakeContainerRuntime) Remove(ctx context.Context, container string) error {
+	return runtime.update("remove", container, func(found *FakeContainer) error {
+		if found.Running {
+			return fmt.Errorf("failed to remove container %s: it is running", container)
+		}
+		delete(runtime.Containers, found.Id)
+		return nil
+	})
+}
+
+func (runtime *FakeContainerRuntime) ContainerExists(ctx context.Context, container string) (bool, error) {
+	runtime.call("container-exists", container)
+	runtime.mutex.Lock()
+	defer runtime.mutex.Unlock()
+	return runtime.find(container) != nil, nil
+}
+
+func (runtime *FakeContainerRuntime) Logs(ctx context.Context, container string, streams ContainerStreams) error {
+	return runtime.writeOutput("logs", container, streams)
+}
+
+func (runtime *FakeContainerRuntime) Close() error {
+	return nil
+}
+
+// call records the call and returns the error set for the operation.
+func (runtime *FakeContainerRuntime) call(operation string, arguments ...string) error {
+	runtime.mutex.Lock()
+	defer runtime.mutex.Unlock()
+	runtime.Calls = append(runtime.Calls, strings.TrimSpace(operation+" "+strings.Join(arguments, " ")))
+	return runtime.Errors[operation]
+}
+
+func (runtime *FakeContainerRuntime) update(operation string, container string, change func(found *FakeContainer) error) error {
+	if err := runtime.call(operation, container); err != nil {
+		return err
+	}
+	runtime.mutex.Lock()
+	defer runtime.mutex.Unlock()
+	found := runtime.find(container)
+	if found == nil {
+		return fmt.Errorf("failed to %s container %s: no such container", operation, container)
+	}
+	return change(found)
+}
+
+func (runtime *FakeContainerRuntime) writeOutput(operation string, container string, streams ContainerStreams) error {
+	output := ""
+	if err := runtime.update(operation, container, func(found *FakeContainer) error {
+		output = found.Output
+		return nil
+	}); err != nil {
+		return err
+	}
+	if streams.Stdout != nil {
+		_, err := io.WriteString(streams.Stdout, output)
+		return err
+	}
+	return nil
+}
+
+func (runtime *FakeContainerRuntime) find(container string) *FakeContainer {
+	if found, exists := runtime.Containers[container]; exists {
+		return found
+	}
+	for _, found := range runtime.Containers {
+		if found.Spec.Name != "" && found.Spec.Name == container {
+			return found
+		}
+	}
+	return nil
+}
@@ -0,0 +1,493 @@
+package utilities
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"scripter/entities"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ExecutionModeScript        = "script"
+	ExecutionModeFileGenerator = "file-generator"
+)
+
+// FileGenerator renders what running a signal would do, instead of running
+// it: a shell script, a Dockerfile with a compose file to run it, and a
+// systemd unit. Every signal gets a directory of its own, named after it and
+// its id, so a template run as several steps keeps the files of each.
+type FileGenerator struct {
+	OutputDirectory string
+	Lock            DependencyLock // Versions and base image digests to pin
+}
+
+// Base images the Dockerfile starts from, by package installer. The lock
+// pins them by digest under the image installer.
+var packageInstallerImages = map[string]string{
+	"apt":        "debian:bookworm-slim",
+	"yum":        "rockylinux:9",
+	"dnf":        "fedora:latest",
+	"apk":        "alpine:latest",
+	"pacman":     "archlinux:latest",
+	"chocolatey": "mcr.microsoft.com/windows/servercore:ltsc2022",
+}
+
+// Generate returns the files it wrote. A signal without an executable, as one
+// made of steps alone or an api call, has nothing of its own to generate.
+func (fileGenerator FileGenerator) Generate(signal entities.Signal) ([]string, error) {
+	if signal.ExecutablePath == "" || signal.Type == ActionTypeApi {
+		return nil, nil
+	}
+
+	// The name comes from the template, it must not lead out of the output
+	// directory
+	if signal.Sender == "" || signal.Sender == ".." || strings.ContainsAny(signal.Sender, `/\`) {
+		return nil, fmt.Errorf("cannot generate files for %q: not a valid name", signal.Sender)
+	}
+	name := serviceName(signal.Sender)
+	directory := filepath.Join(fileGenerator.OutputDirectory, name+"-"+serviceName(signal.Id))
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", directory, err)
+	}
+
+	compose, err := generateCompose(signal)
+	if err != nil {
+		return nil, err
+	}
+	base, err := signalBaseImage(signal, fileGenerator.Lock)
+	if err != nil {
+		return nil, err
+	}
+	installs, err := installCommands(signal, fileGenerator.Lock)
+	if err != nil {
+		return nil, err
+	}
+	imageInstalls, err := imageInstallCommands(signal, fileGenerator.Lock)
+	if err != nil {
+		return nil, err
+	}
+	files := []struct {
+		name    string
+		content string
+		mode    os.FileMode
+	}{
+		{name + ".sh", generateShellScript(signal, installs), 0755},
+		{"Dockerfile", generateSignalDockerfile(signal, base, imageInstalls), 0644},
+		{"compose.yaml", compose, 0644},
+		{name + ".service", generateSystemdUnit(signal), 0644},
+	}
+
+	// The Dockerfile copies the executable in from the directory
+	_, contextFiles := imageExecutable(signal)
+	written := []string{}
+	for _, name := range sortedKeys(contextFiles) {
+		path := filepath.Join(directory, filepath.FromSlash(name))
+		if err := copyFile(contextFiles[name], path); err != nil {
+			return written, err
+		}
+		written = append(written, path)
+	}
+	for _, file := range files {
+		path := filepath.Join(directory, file.name)
+		if err := os.WriteFile(path, []byte(file.content), file.mode); err != nil {
+			return written, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
+
+func generateShellScript(signal entities.Signal, installs []string) string {
+	var script strings.Builder
+	script.WriteString("#!/bin/sh\n")
+	script.WriteString(fmt.Sprintf("# Generated by scripter from %s\n", signal.Sender))
+	script.WriteString("set -eu\n\n")
+
+	if len(installs) > 0 {
+		script.WriteString(strings.Join(installs, "\n") + "\n\n")
+	}
+	for _, key := range sortedKeys(signal.EnvironmentVariables) {
+		script.WriteString(fmt.Sprintf("export %s=%s\n", key, shellQuote(signal.EnvironmentVariables[key])))
+	}
+	if signal.WorkingDirectory != "" {
+		script.WriteString(fmt.Sprintf("cd %s\n", shellQuote(signal.WorkingDirectory)))
+	}
+
+	command := "exec " + shellCommand(signal)
+	if signal.Stdin != "" && signal.Stdin != "-" {
+		command += " < " + shellQuote(signal.Stdin)
+	}
+	script.WriteString(command + "\n")
+	return script.String()
+}
+
+// generateSignalDockerfile is the Dockerfile of the image with what the
+// container is run with on top, so the generated compose file runs the action
+// as scripter would.
+func generateSignalDockerfile(signal entities.Signal, base string, installs []string) string {
+	var dockerfile strings.Builder
+	dockerfile.WriteString(imageDockerfile(signal, base, installs))
+	for _, key := range sortedKeys(signal.EnvironmentVariables) {
+		value := signal.EnvironmentVariables[key]
+		if strings.ContainsAny(value, "\r\n") {
+			// A Dockerfile instruction cannot hold a line break
+			dockerfile.WriteString(fmt.Sprintf("# %s spans several lines, compose.yaml sets it\n", key))
+			continue
+		}
+		dockerfile.WriteString(fmt.Sprintf("ENV %s=%s\n", key, dockerfileQuote(value)))
+	}
+	if signal.WorkingDirectory != "" {
+		dockerfile.WriteString(fmt.Sprintf("WORKDIR %s\n", signal.WorkingDirectory))
+	}
+	if len(signal.Arguments) > 0 {
+		dockerfile.WriteString(fmt.Sprintf("CMD %s\n", execForm(signal.Arguments)))
+	}
+	return dockerfile.String()
+}
+
+// imageDockerfile holds what the image of the signal is made of: its base
+// image, its dependencies and its executable. The arguments, the environment
+// and the working directory are given to the container instead, so they do
+// not change the image.
+func imageDockerfile(signal entities.Signal, base string, installs []string) string {
+	var dockerfile strings.Builder
+	dockerfile.WriteString(fmt.Sprintf("# Generated by scripter from %s\n", signal.Sender))
+	dockerfile.WriteString(fmt.Sprintf("FROM %s\n", base))
+	for _, install := range installs {
+		if strings.HasPrefix(install, "# ") {
+			dockerfile.WriteString(install + "\n")
+			continue
+		}
+		if strings.HasPrefix(install, "apt-get ") {
+			install = "apt-get update && DEBIAN_FRONTEND=noninteractive " + install + " && rm -rf /var/lib/apt/lists/*"
+		}
+		if strings.HasPrefix(install, pythonCommand()+" -m pip ") {
+			// Recent distributions keep pip out of their Python (PEP 668); the
+			// image is the signal's alone, there is nothing of theirs to break
+			install = "PIP_BREAK_SYSTEM_PACKAGES=1 " + install
+		}
+		if strings.HasPrefix(install, "brew ") {
+			dockerfile.WriteString(fmt.Sprintf("# %s cannot run here\n", install))
+			continue
+		}
+		dockerfile.WriteString(fmt.Sprintf("RUN %s\n", install))
+	}
+	executable, files := imageExecutable(signal)
+	for _, name := range sortedKeys(files) {
+		dockerfile.WriteString(fmt.Sprintf("COPY %s\n", execForm([]string{name, executable})))
+	}
+	// The exec form keeps the action as PID 1, so it receives the stop signal
+	dockerfile.WriteString(fmt.Sprintf("ENTRYPOINT %s\n", execForm([]string{executable})))
+	return dockerfile.String()
+}
+
+// Base images are locked by digest under this installer, next to the
+// packages.
+const imageLockInstaller = "image"
+
+// signalBaseImage is the base image of the signal, by the digest the lock
+// holds for it when it holds one. Homebrew has no image of its own, what it
+// installs is left out of the container.
+func signalBaseImage(signal entities.Signal, lock DependencyLock) (string, error) {
+	image, exists := packageInstallerImages[signal.PackageInstaller]
+	if !exists {
+		image = packageInstallerImages["apt"]
+	}
+	locked, isLocked, err := lock.Get(imageLockInstaller, image)
+	if err != nil {
+		return "", err
+	}
+	if isLocked {
+		return image + "@" + locked.Version, nil
+	}
+	return image, nil
+}
+
+// Where the executable of the signal is copied to in the image, and where it
+// sits in the build context.
+const (
+	imageExecutableDirectory   = "/opt/scripter"
+	contextExecutableDirectory = "bin"
+)
+
+// imageExecutable is the executable as the image runs it, with the files of
+// the build context by their path in it. An executable named alone is looked
+// up in the PATH of the image, one given by its path is copied in from the
+// host, relative to the working directory when the path is.
+func imageExecutable(signal entities.Signal) (string, map[string]string) {
+	path := signal.ExecutablePath
+	if !strings.ContainsAny(path, `/\`) {
+		return path, nil
+	}
+	if !filepath.IsAbs(path) && signal.WorkingDirectory != "" {
+		path = filepath.Join(signal.WorkingDirectory, path)
+	}
+	name := filepath.Base(path)
+	return imageExecutableDirectory + "/" + name, map[string]string{contextExecutableDirectory + "/" + name: path}
+}
+
+func execForm(parts []string) string {
+	quoted := []string{}
+	for _, part := range parts {
+		quoted = append(quoted, fmt.Sprintf("%q", part))
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+type composeFile struct {
+	Services map[string]composeService `yaml:"services"`
+}
+
+type composeService struct {
+	Build           string            `yaml:"build"`
+	Environment     map[string]string `yaml:"environment,omitempty"`
+	StdinOpen       bool              `yaml:"stdin_open,omitempty"`
+	Init            bool              `yaml:"init,omitempty"`
+	StopGracePeriod string            `yaml:"stop_grace_period,omitempty"`
+}
+
+func generateCompose(signal entities.Signal) (string, error) {
+	service := composeService{
+		Build:       ".",
+		Environment: signal.EnvironmentVariables,
+		StdinOpen:   signal.Stdin == "-",
+		// An init process forwards the stop signal to the whole tree
+		Init: signal.ShutdownSignal == ShutdownCascade,
+	}
+	if signal.ShutdownGracePeriod > 0 {
+		service.StopGracePeriod = signal.ShutdownGracePeriod.String()
+	}
+
+	content, err := yaml.Marshal(composeFile{Services: map[string]composeService{serviceName(signal.Sender): service}})
+	if err != nil {
+		return "", fmt.Errorf("failed to generate compose file for %s: %w", signal.Sender, err)
+	}
+	return fmt.Sprintf("# Generated by scripter from %s\n", signal.Sender) + string(content), nil
+}
+
+// Shutdown modes map onto the kill modes of systemd.
+var systemdKillModes = map[string]string{
+	ShutdownCascade: "control-group",
+	ShutdownSingle:  "process",
+	ShutdownNone:    "none",
+}
+
+func generateSystemdUnit(signal entities.Signal) string {
+	var unit strings.Builder
+	unit.WriteString(fmt.Sprintf("# Generated by scripter from %s\n", signal.Sender))
+	unit.WriteString("[Unit]\n")
+	unit.WriteString(fmt.Sprintf("Description=%s\n\n", signal.Sender))
+
+	unit.WriteString("[Service]\n")
+	unit.WriteString("Type=simple\n")
+	unit.WriteString(fmt.Sprintf("ExecStart=%s\n", systemdCommand(signal)))
+	if signal.WorkingDirectory != "" {
+		unit.WriteString(fmt.Sprintf("WorkingDirectory=%s\n", signal.WorkingDirectory))
+	}
+	for _, key := range sortedKeys(signal.EnvironmentVariables) {
+		unit.WriteString(fmt.Sprintf("Environment=%s\n", systemdQuote(key+"="+signal.EnvironmentVariables[key])))
+	}
+	if signal.Stdin != "" && signal.Stdin != "-" {
+		unit.WriteString(fmt.Sprintf("StandardInput=file:%s\n", signal.Stdin))
+	}
+	if killMode, exists := systemdKillModes[signal.ShutdownSignal]; exists {
+		unit.WriteString(fmt.Sprintf("KillMode=%s\n", killMode))
+	}
+	if signal.ShutdownGracePeriod > 0 {
+		unit.WriteString(fmt.Sprintf("TimeoutStopSec=%d\n", int(signal.ShutdownGracePeriod.Seconds())))
+	}
+	if signal.ExecutionPolicy.Timeout > 0 {
+		unit.WriteString(fmt.Sprintf("RuntimeMaxSec=%d\n", int(signal.ExecutionPolicy.Timeout.Seconds())))
+	}
+	if signal.ExecutionPolicy.Retry.MaxAttempts > 1 {
+		unit.WriteString("Restart=on-failure\n")
+		if signal.ExecutionPolicy.Retry.Backoff > 0 {
+			unit.WriteString(fmt.Sprintf("RestartSec=%d\n", int(signal.ExecutionPolicy.Retry.Backoff.Seconds())))
+		}
+	}
+
+	unit.WriteString("\n[Install]\n")
+	unit.WriteString("WantedBy=multi-user.target\n")
+	return unit.String()
+}
+
+// installCommands installs the dependencies with one command per installer,
+// in the order the installers first appear. A dependency the lock holds a
+// version of, picked under the constraint it still asks for, is pinned to
+// that version. One whose constraint the lock does not settle gets the latest
+// version; a comment says so, which keeps the constraint in the image hash.
+func installCommands(signal entities.Signal, lock DependencyLock) ([]string, error) {
+	installers := []string{}
+	packages := map[string][]string{}
+	unlocked := []string{}
+	for _, dependency := range signal.InstallationDependencies {
+		parsed := ResolveDependency(dependency, signal.PackageInstaller)
+		installer, err := GetPackageInstaller(parsed.Installer)
+		if err != nil {
+			continue
+		}
+		if _, seen := packages[installer.Name()]; !seen {
+			installers = append(installers, installer.Name())
+		}
+
+		pinned := []string{parsed.Name}
+		locked, isLocked, err := lock.Get(installer.Name(), parsed.Name)
+		if err != nil {
+			return nil, err
+		}
+		commandInstaller, isCommand := installer.(CommandPackageInstaller)
+		switch {
+		case isCommand && isLocked && locked.Constraint == parsed.Version:
+			pinned = commandInstaller.PinnedPackage(parsed.Name, locked.Version)
+		case parsed.Version != "":
+			unlocked = append(unlocked, fmt.Sprintf("# %s %s is not locked, the latest version is installed", parsed.Name, parsed.Version))
+		}
+		packages[installer.Name()] = append(packages[installer.Name()], pinned...)
+	}
+
+	commands := unlocked
+	for _, installerName := range installers {
+		installer, isCommand := packageInstallers[installerName].(CommandPackageInstaller)
+		if !isCommand {
+			continue
+		}
+		// The names come from the template, the shell must take them as they are
+		quoted := []string{}
+		for _, part := range withPackage(installer.InstallCommand, packages[installerName]...) {
+			quoted = append(quoted, shellQuote(part))
+		}
+		commands = append(commands, strings.Join(quoted, " "))
+	}
+	return commands, nil
+}
+
+// Packages that bring pip and npm along, by the installer of the base image,
+// which have neither.
+var imageInstallerPackages = map[string]map[string]string{
+	"pip": {"apt": "python3-pip", "dnf": "python3-pip", "yum": "python3-pip", "apk": "py3-pip", "pacman": "python-pip"},
+	"npm": {"apt": "npm", "dnf": "npm", "yum": "npm", "apk": "npm", "pacman": "npm"},
+}
+
+// imageInstallCommands are the install commands of the image of the signal:
+// pip and npm are installed through the installer of the base image before
+// anything is installed through them, and what only installs on Windows is
+// refused in a Linux image.
+func imageInstallCommands(signal entities.Signal, lock DependencyLock) ([]string, error) {
+	imageInstaller := signal.PackageInstaller
+	if alias, exists := packageInstallerAliases[imageInstaller]; exists {
+		imageInstaller = alias
+	}
+	if _, exists := packageInstallerImages[imageInstaller]; !exists {
+		imageInstaller = "apt"
+	}
+	windowsImage := imageInstaller == "chocolatey"
+	if windowsImage && signal.SignalOs != "windows" {
+		return nil, fmt.Errorf("cannot generate an image for %s: chocolatey only installs on Windows, the signal runs on %s", signal.Sender, signal.SignalOs)
+	}
+
+	bootstrap := []string{}
+	for _, dependency := range signal.InstallationDependencies {
+		parsed := ResolveDependency(dependency, signal.PackageInstaller)
+		installer, err := GetPackageInstaller(parsed.Installer)
+		if err != nil {
+			continue
+		}
+		if !windowsImage && !installer.RunsOn("linux") {
+			return nil, fmt.Errorf("cannot generate an image for %s: %s does not install on Linux, %s cannot go in its image", signal.Sender, installer.Name(), parsed.Name)
+		}
+		pkg, needed := imageInstallerPackages[installer.Name()][imageInstaller]
+		if needed && installer.Name() != imageInstaller && !stringHandler.ContainsString(bootstrap, pkg) {
+			bootstrap = append(bootstrap, pkg)
+		}
+	}
+
+	installs, err := installCommands(signal, lock)
+	if err != nil || len(bootstrap) == 0 {
+		return installs, err
+	}
+	command := []string{}
+	for _, part := range withPackage(packageInstallers[imageInstaller].(CommandPackageInstaller).InstallCommand, bootstrap...) {
+		command = append(command, shellQuote(part))
+	}
+	return append([]string{strings.Join(command, " ")}, installs...), nil
+}
+
+func shellCommand(signal entities.Signal) string {
+	parts := []string{shellQuote(signal.ExecutablePath)}
+	for _, argument := range signal.Arguments {
+		parts = append(parts, shellQuote(argument))
+	}
+	return strings.Join(parts, " ")
+}
+
+func systemdCommand(signal entities.Signal) string {
+	parts := []string{systemdQuote(signal.ExecutablePath)}
+	for _, argument := range signal.Arguments {
+		parts = append(parts, systemdQuote(argument))
+	}
+	return strings.Join(parts, " ")
+}
+
+func shellQuote(value string) string {
+	if value != "" && strings.IndexFunc(value, func(character rune) bool {
+		return !(character >= 'a' && character <= 'z' || character >= 'A' && character <= 'Z' || character >= '0' && character <= '9' || strings.ContainsRune("-_./=:,+@%", character))
+	}) == -1 {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// A Dockerfile expands "$" and takes "\" as an escape within double quotes.
+func dockerfileQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`).Replace(value) + `"`
+}
+
+// systemd takes double quoted words with C-style escapes, and "%" and "$"
+// would otherwise be expanded.
+func systemdQuote(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$").Replace(value)
+	if value != "" && !strings.ContainsAny(value, " \t'") {
+		return value
+	}
+	return `"` + value + `"`
+}
+
+func serviceName(name string) string {
+	return strings.Map(func(character rune) rune {
+		if character >= 'a' && character <= 'z' || character >= '0' && character <= '9' || character == '-' || character == '_' {
+			return character
+		}
+		if character >= 'A' && character <= 'Z' {
+			return character + 'a' - 'A'
+		}
+		return '-'
+	}, name)
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// copyFile copies an executable, keeping it runnable.
+func copyFile(source string, destination string) error {
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", source, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(destination), err)
+	}
+	if err := os.WriteFile(destination, content, 0755); err != nil {
+		return fmt.Errorf("failed to write %s: %w", destination, err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package utilities
+
+import (
+	"os"
+	"path/filepath"
+	"scripter/entities"
+	"strings"
+	"testing"
+)
+
+func TestFileGeneratorEscapesWhatTheTemplateGives(t *testing.T) {
+	signal := containerSignal(t)
+	signal.InstallationDependencies = []entities.Dependency{{Name: "jq"}, {Name: "redis;touch$IFS/tmp/owned"}}
+	signal.EnvironmentVariables = map[string]string{
+		"GREETING":    `say "hi" to $USER \o/`,
+		"CERTIFICATE": "-----BEGIN-----\nabc\n-----END-----",
+	}
+	output := t.TempDir()
+	if _, err := (FileGenerator{OutputDirectory: output}).Generate(signal); err != nil {
+		t.Fatal(err)
+	}
+	read := func(name string) string {
+		content, err := os.ReadFile(filepath.Join(output, "deploy-run-1", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(content)
+	}
+
+	script, dockerfile := read("deploy.sh"), read("Dockerfile")
+	for _, content := range []string{script, dockerfile} {
+		if !strings.Contains(content, `apt-get install -y jq 'redis;touch$IFS/tmp/owned'`) {
+			t.Errorf("package names not quoted in\n%s", content)
+		}
+	}
+	if !strings.Contains(dockerfile, `ENV GREETING="say \"hi\" to \$USER \\o/"`+"\n") {
+		t.Errorf("GREETING not escaped for a Dockerfile in\n%s", dockerfile)
+	}
+	if strings.Contains(dockerfile, "ENV CERTIFICATE") || !strings.Contains(dockerfile, "# CERTIFICATE spans several lines") {
+		t.Errorf("CERTIFICATE written across lines in\n%s", dockerfile)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package utilities
+
+import "os"
+
+// Without flock only the writers of one process are serialized, by the
+// callers' own mutex.
+func lockFile(file *os.File) error {
+	return nil
+}
+
+func unlockFile(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package utilities
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile holds an exclusive advisory lock on the file until unlockFile,
+// blocking while another process holds it.
+func lockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+}
+
+func unlockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
@@ -1,8 +1,10 @@
 package utilities
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"scripter/entities"
 	"scripter/entities/versions"
 
@@ -19,40 +21,65 @@ var stringHandler = StringHandler{}
 //File reader
 
 func (fileReader FileReader) ReadAllYamls(path string) []*versions.YamlFile_Generic_01 {
+	yamlsArray, err := fileReader.LoadAllYamls(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return yamlsArray
+}
+
+// LoadAllYamls reads the template and its whole inheritance chain, oldest
+// ancestor first, reporting errors instead of exiting so long-running
+// processes survive a broken template.
+func (fileReader FileReader) LoadAllYamls(path string) ([]*versions.YamlFile_Generic_01, error) {
 
 	yamlsArray := make([]*versions.YamlFile_Generic_01, 0)
 
-	yaml := fileReader.ReadYaml(path)
+	yaml, err := fileReader.LoadYaml(path)
+	if err != nil {
+		return nil, err
+	}
 
 	if strings.TrimSpace(yaml.Header.Inherits) != "" {
 		parentPath, parentName := stringHandler.ExtractBeforeAndAfterValues(yaml.Header.Inherits)
 		importInherit := entities.ImportInherit{ParentPath: parentPath, ParentName: parentName}
-		yaml.Parent = fileReader.ReadYaml(importInherit.ParentPath)
-		newYamlArray := fileReader.ReadAllYamls(importInherit.ParentPath)
+		newYamlArray, err := fileReader.LoadAllYamls(importInherit.ParentPath)
+		if err != nil {
+			return nil, err
+		}
+		yaml.Parent = newYamlArray[len(newYamlArray)-1]
 		yamlsArray = append(yamlsArray, newYamlArray...)
 	}
 
 	yamlsArray = append(yamlsArray, yaml)
 
-	return yamlsArray
+	return yamlsArray, nil
 }
 
 //File reader
 
 func (fileReader FileReader) ReadYaml(filePath string) *versions.YamlFile_Generic_01 {
+	yamlFile, err := fileReader.LoadYaml(filePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return yamlFile
+}
+
+func (fileReader FileReader) LoadYaml(filePath string) (*versions.YamlFile_Generic_01, error) {
 
 	data, err := os.ReadFile(filePath)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	var yamlFile versions.YamlFile_Generic_01
 	err = yaml.Unmarshal(data, &yamlFile)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("%s: %w", filePath, err)
 	}
 
-	return &yamlFile
+	return &yamlFile, nil
 }
 
 func (fileReader FileReader) ObtainAllSourceAncestors(templateName string, yamls []*versions.YamlFile_Generic_01) []string {
@@ -81,3 +108,21 @@ func findYamlByName(yamls []*versions.YamlFile_Generic_01, templateName string)
 	}
 	return nil
 }
+
+// ResolveTemplatePath finds the template a reference points to, taken as is or
+// relative to the template that references it, with or without extension.
+func (fileReader FileReader) ResolveTemplatePath(reference string, sourcePath string) (string, error) {
+	directories := []string{""}
+	if sourcePath != "" && !filepath.IsAbs(reference) {
+		directories = append(directories, filepath.Dir(sourcePath))
+	}
+	for _, directory := range directories {
+		for _, name := range []string{reference, reference + ".yaml", reference + ".yml"} {
+			candidate := filepath.Join(directory, name)
+			if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+				return filepath.Clean(candidate), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no template found for %q", reference)
+}
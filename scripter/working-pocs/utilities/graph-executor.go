@@ -0,0 +1,112 @@
+package utilities
+
+import (
+	"fmt"
+	"log/slog"
+	"scripter/entities"
+	"sync"
+)
+
+// GraphExecutor runs the nodes of a dependency graph once the root completed.
+// A node starts as soon as every node depending on it succeeded, at most
+// Parallelism at a time; the descendants of a failed node are skipped.
+type GraphExecutor struct {
+	Parallelism int
+}
+
+type NodeRunner func(node entities.DependencyNode) (int, error)
+
+var graphHandler = DependencyGraphHandler{}
+
+func (graphExecutor GraphExecutor) Run(graph entities.DependencyGraph, run NodeRunner) map[string]entities.NodeResult {
+	results := map[string]entities.NodeResult{graph.Root: {Id: graph.Root, Status: StepSucceeded}}
+	remaining := graphHandler.IncomingCounts(graph)
+	blocked := map[string]bool{}
+
+	var mutex sync.Mutex
+	var running sync.WaitGroup
+	slots := make(chan struct{}, max(graphExecutor.Parallelism, 1))
+
+	// complete records a finished (or skipped) node and releases the
+	// dependencies whose last dependent it was. Callers hold the mutex.
+	var complete func(id string, result entities.NodeResult)
+	var start func(id string)
+
+	complete = func(id string, result entities.NodeResult) {
+		results[id] = result
+		for _, dependency := range graph.Nodes[id].Dependencies {
+			if result.Status != StepSucceeded {
+				blocked[dependency] = true
+			}
+			remaining[dependency]--
+			if remaining[dependency] > 0 {
+				continue
+			}
+			if blocked[dependency] {
+				complete(dependency, entities.NodeResult{Id: dependency, Status: StepSkipped, Error: "a node it depends on did not succeed"})
+				continue
+			}
+			start(dependency)
+		}
+	}
+
+	start = func(id string) {
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			slots <- struct{}{}
+			node := *graph.Nodes[id]
+			result := entities.NodeResult{Id: id, Status: StepSucceeded}
+			if node.Error != "" {
+				result.Status, result.ExitCode, result.Error = StepFailed, 1, node.Error
+			} else if exitCode, err := graphExecutor.runNode(node, run); err != nil || exitCode != 0 {
+				result.Status, result.ExitCode = StepFailed, max(exitCode, 1)
+				if err != nil {
+					result.Error = err.Error()
+				}
+			}
+			<-slots
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			complete(id, result)
+		}()
+	}
+
+	mutex.Lock()
+	complete(graph.Root, results[graph.Root])
+	mutex.Unlock()
+
+	running.Wait()
+	return results
+}
+
+// runNode turns a panic of the node into its failure, so the nodes left are
+// still run or skipped.
+func (graphExecutor GraphExecutor) runNode(node entities.DependencyNode, run NodeRunner) (exitCode int, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			exitCode, err = 1, fmt.Errorf("panicked: %v", recovered)
+		}
+	}()
+	return run(node)
+}
+
+// PrintReport prints a line per dependency and logs each of them.
+func (graphExecutor GraphExecutor) PrintReport(graph entities.DependencyGraph, results map[string]entities.NodeResult, logger *slog.Logger) {
+	for _, id := range graph.Order {
+		if id == graph.Root {
+			continue
+		}
+		result := results[id]
+		logger.Info("dependency finished", "dependency", graph.Nodes[id].Name, "template", id, "status", result.Status, "exit-code", result.ExitCode, "error", result.Error)
+		line := fmt.Sprintf("%s [%s]", graph.Nodes[id].Name, result.Status)
+		if result.Status == StepFailed {
+			line += fmt.Sprintf(" exit %d", result.ExitCode)
+		}
+		if result.Error != "" {
+			line += ": " + result.Error
+		}
+		fmt.Println(line)
+	}
+}
@@ -0,0 +1,243 @@
+package utilities
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"scripter/entities"
+	"strings"
+
+	xterm "golang.org/x/term"
+)
+
+const (
+	InstallActionNone      = "none"
+	InstallActionInstall   = "install"
+	InstallActionUpgrade   = "upgrade"
+	InstallActionDowngrade = "downgrade"
+	InstallActionBlocked   = "blocked"
+
+	InstallApprovalAuto   = "auto"   // Apply the plan as it is
+	InstallApprovalPrompt = "prompt" // Show the plan and ask before applying it
+)
+
+// InstallPlanner works out what installing the dependencies of a signal takes
+// without changing anything, then applies that plan. Every dependency goes
+// through the installer its prefix names ("pip:requests") or the platform
+// installer of the signal; one with a version constraint, or one the lock
+// file knows, is installed at that version, upgrading or downgrading it.
+type InstallPlanner struct {
+	Lock DependencyLock
+}
+
+func (installPlanner InstallPlanner) Plan(ctx context.Context, signal entities.Signal) entities.InstallPlan {
+	plan := entities.InstallPlan{Signal: signal.Sender, TemplatePath: signal.SourcePath, Containerized: signal.Containerize, Steps: []entities.InstallStep{}}
+	if signal.Containerize {
+		return plan
+	}
+	for _, dependency := range signal.InstallationDependencies {
+		plan.Steps = append(plan.Steps, installPlanner.PlanDependency(ctx, ResolveDependency(dependency, signal.PackageInstaller)))
+	}
+	return plan
+}
+
+func (installPlanner InstallPlanner) PlanDependency(ctx context.Context, dependency entities.Dependency) entities.InstallStep {
+	step := entities.InstallStep{Dependency: dependency.String(), Installer: dependency.Installer, Name: dependency.Name, Binary: dependency.Binary, Constraint: dependency.Version}
+	blocked := func(err error) entities.InstallStep {
+		step.Action, step.Error = InstallActionBlocked, err.Error()
+		return step
+	}
+
+	installer, err := GetPackageInstaller(dependency.Installer)
+	if err != nil {
+		return blocked(err)
+	}
+	step.Installer = installer.Name()
+
+	// The lock holds while the template asks for what it was picked under
+	locked, isLocked, err := installPlanner.Lock.Get(installer.Name(), dependency.Name)
+	if err != nil {
+		return blocked(err)
+	}
+	if isLocked && locked.Constraint == dependency.Version {
+		step.Locked, step.Target = true, locked.Version
+	}
+
+	if step.Installed, err = installer.Version(ctx, dependency.Name); err != nil {
+		return blocked(err)
+	}
+	satisfied, reason, err := CheckDependency(ctx, installer, wantedDependency(dependency, step))
+	if err != nil {
+		return blocked(err)
+	}
+	if satisfied {
+		step.Action, step.Target = InstallActionNone, ""
+		return step
+	}
+	step.Reason = reason
+
+	if !step.Locked && dependency.Version != "" {
+		if step.Target, err = ResolveVersion(ctx, installer, dependency.Name, dependency.Version); err != nil {
+			return blocked(err)
+		}
+	}
+	step.Action = InstallActionInstall
+	if step.Installed != "" && step.Target != "" {
+		switch comparison := CompareVersions(step.Target, step.Installed); {
+		case comparison > 0:
+			step.Action = InstallActionUpgrade
+		case comparison < 0:
+			step.Action = InstallActionDowngrade
+		}
+	}
+	step.Privileged = installer.NeedsPrivilege()
+	if step.Command, err = installer.InstallCommandLine(dependency.Name, step.Target); err != nil {
+		return blocked(err)
+	}
+	return step
+}
+
+// Apply carries the plan out under the installation policy, going on past
+// what fails, and locks the versions it leaves behind. It returns every
+// failure joined.
+func (installPlanner InstallPlanner) Apply(plan entities.InstallPlan, policy entities.ExecutionPolicy, logger *slog.Logger) error {
+	failures := []error{}
+	for _, step := range plan.Steps {
+		if err := installPlanner.applyStep(step, policy, logger); err != nil {
+			logger.Error("dependency not installed", "dependency", step.Dependency, "error", err)
+			failures = append(failures, err)
+		}
+	}
+	return errors.Join(failures...)
+}
+
+func (installPlanner InstallPlanner) applyStep(step entities.InstallStep, policy entities.ExecutionPolicy, logger *slog.Logger) error {
+	if step.Action == InstallActionBlocked {
+		return fmt.Errorf("cannot install %s: %s", step.Name, step.Error)
+	}
+	installer, err := GetPackageInstaller(step.Installer)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	dependency := entities.Dependency{Installer: step.Installer, Name: step.Name, Binary: step.Binary, Version: step.Constraint}
+
+	if step.Action != InstallActionNone {
+		logger.Info("installing dependency", "dependency", step.Dependency, "reason", step.Reason, "action", step.Action, "installer", installer.Name(), "target", step.Target)
+		err = installWithPolicy(step.Name, policy, logger, func(ctx context.Context) error {
+			if step.Target != "" {
+				return installer.InstallVersion(ctx, step.Name, step.Target)
+			}
+			return installer.Install(ctx, step.Name)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to install %s: %w", step.Name, err)
+		}
+		if satisfied, reason, _ := CheckDependency(ctx, installer, wantedDependency(dependency, step)); !satisfied {
+			return fmt.Errorf("%s: still %s after installation", step.Name, reason)
+		}
+	}
+
+	installed, err := installer.Version(ctx, step.Name)
+	if err != nil || installed == "" {
+		return err
+	}
+	return installPlanner.Lock.Record(entities.LockedDependency{
+		Installer:  installer.Name(),
+		Name:       step.Name,
+		Constraint: step.Constraint,
+		Version:    installed,
+	})
+}
+
+// A locked dependency is wanted at its locked version exactly.
+func wantedDependency(dependency entities.Dependency, step entities.InstallStep) entities.Dependency {
+	if step.Locked {
+		dependency.Version = "=" + step.Target
+	}
+	return dependency
+}
+
+// HasChanges tells whether applying the plan would install anything.
+func (installPlanner InstallPlanner) HasChanges(plan entities.InstallPlan) bool {
+	for _, step := range plan.Steps {
+		if step.Action != InstallActionNone && step.Action != InstallActionBlocked {
+			return true
+		}
+	}
+	return false
+}
+
+func (installPlanner InstallPlanner) PrintPlan(writer io.Writer, plan entities.InstallPlan) {
+	fmt.Fprintf(writer, "Installation plan of %s (%s)\n", plan.Signal, plan.TemplatePath)
+	if plan.Containerized {
+		fmt.Fprintln(writer, "  dependencies are installed in the container")
+		return
+	}
+	if len(plan.Steps) == 0 {
+		fmt.Fprintln(writer, "  no dependencies")
+		return
+	}
+	for _, step := range plan.Steps {
+		version := step.Installed
+		if version == "" {
+			version = "not installed"
+		}
+		if step.Target != "" {
+			version += " -> " + step.Target
+			if step.Locked {
+				version += " (locked)"
+			}
+		}
+		fmt.Fprintf(writer, "  %-9s %s:%s %s\n", step.Action, step.Installer, step.Name, version)
+		if step.Reason != "" {
+			fmt.Fprintf(writer, "            %s\n", step.Reason)
+		}
+		if step.Error != "" {
+			fmt.Fprintf(writer, "            %s\n", step.Error)
+		}
+		if len(step.Command) > 0 {
+			privileged := ""
+			if step.Privileged {
+				privileged = " (needs privileges)"
+			}
+			fmt.Fprintf(writer, "            $ %s%s\n", strings.Join(step.Command, " "), privileged)
+		}
+	}
+}
+
+// Approve shows the plan and asks for a yes on the terminal. Without a
+// terminal to ask on there is no approval.
+func (installPlanner InstallPlanner) Approve(plan entities.InstallPlan) bool {
+	installPlanner.PrintPlan(os.Stdout, plan)
+	if !xterm.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Println("No terminal to approve the plan on.")
+		return false
+	}
+	fmt.Print("Apply this plan? [y/N] ")
+	answer := strings.ToLower(strings.TrimSpace(readAnswer(os.Stdin)))
+	return answer == "y" || answer == "yes"
+}
+
+// readAnswer reads one line a byte at a time, so nothing past it is taken
+// from an action that reads the same stdin afterwards.
+func readAnswer(reader io.Reader) string {
+	var answer strings.Builder
+	character := make([]byte, 1)
+	for {
+		count, err := reader.Read(character)
+		if count == 1 {
+			if character[0] == '\n' {
+				break
+			}
+			answer.WriteByte(character[0])
+		}
+		if err != nil {
+			break
+		}
+	}
+	return answer.String()
+}
@@ -0,0 +1,140 @@
+package utilities
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// LabelExpression is a boolean expression over runner labels, such as
+// "linux && !arm64" or "(redis || rabbitmq) && dos-box". A bare label is true
+// when the runner advertises it.
+type LabelExpression struct{}
+
+// IsLabelExpression tells an expression apart from a plain label or runner name.
+func (labelExpression LabelExpression) IsLabelExpression(value string) bool {
+	return strings.ContainsAny(value, "&|!() ")
+}
+
+func (labelExpression LabelExpression) Evaluate(expression string, labels []string) (bool, error) {
+	tokens, err := tokenizeLabelExpression(expression)
+	if err != nil {
+		return false, err
+	}
+	parser := labelExpressionParser{tokens: tokens, labels: labels}
+	result, err := parser.parseOr()
+	if err != nil {
+		return false, err
+	}
+	if parser.position < len(parser.tokens) {
+		return false, fmt.Errorf("unexpected %q in label expression %q", parser.tokens[parser.position], expression)
+	}
+	return result, nil
+}
+
+// Grammar, lowest precedence first:
+//
+//	or    = and { "||" and }
+//	and   = unary { "&&" unary }
+//	unary = "!" unary | "(" or ")" | label
+type labelExpressionParser struct {
+	tokens   []string
+	position int
+	labels   []string
+}
+
+func (parser *labelExpressionParser) parseOr() (bool, error) {
+	result, err := parser.parseAnd()
+	if err != nil {
+		return false, err
+	}
+	for parser.peek() == "||" {
+		parser.position++
+		right, err := parser.parseAnd()
+		if err != nil {
+			return false, err
+		}
+		result = result || right
+	}
+	return result, nil
+}
+
+func (parser *labelExpressionParser) parseAnd() (bool, error) {
+	result, err := parser.parseUnary()
+	if err != nil {
+		return false, err
+	}
+	for parser.peek() == "&&" {
+		parser.position++
+		right, err := parser.parseUnary()
+		if err != nil {
+			return false, err
+		}
+		result = result && right
+	}
+	return result, nil
+}
+
+func (parser *labelExpressionParser) parseUnary() (bool, error) {
+	token := parser.peek()
+	switch token {
+	case "":
+		return false, fmt.Errorf("label expression ended unexpectedly")
+	case "!":
+		parser.position++
+		result, err := parser.parseUnary()
+		return !result, err
+	case "(":
+		parser.position++
+		result, err := parser.parseOr()
+		if err != nil {
+			return false, err
+		}
+		if parser.peek() != ")" {
+			return false, fmt.Errorf("missing closing parenthesis in label expression")
+		}
+		parser.position++
+		return result, nil
+	case ")", "&&", "||":
+		return false, fmt.Errorf("unexpected %q in label expression", token)
+	}
+	parser.position++
+	return stringHandler.ContainsString(parser.labels, token), nil
+}
+
+func (parser *labelExpressionParser) peek() string {
+	if parser.position >= len(parser.tokens) {
+		return ""
+	}
+	return parser.tokens[parser.position]
+}
+
+func tokenizeLabelExpression(expression string) ([]string, error) {
+	tokens := []string{}
+	for index := 0; index < len(expression); {
+		character := rune(expression[index])
+		switch {
+		case unicode.IsSpace(character):
+			index++
+		case strings.HasPrefix(expression[index:], "&&"), strings.HasPrefix(expression[index:], "||"):
+			tokens = append(tokens, expression[index:index+2])
+			index += 2
+		case character == '!' || character == '(' || character == ')':
+			tokens = append(tokens, string(character))
+			index++
+		case isLabelCharacter(character):
+			start := index
+			for index < len(expression) && isLabelCharacter(rune(expression[index])) {
+				index++
+			}
+			tokens = append(tokens, expression[start:index])
+		default:
+			return nil, fmt.Errorf("invalid character %q in label expression %q", character, expression)
+		}
+	}
+	return tokens, nil
+}
+
+func isLabelCharacter(character rune) bool {
+	return unicode.IsLetter(character) || unicode.IsDigit(character) || strings.ContainsRune("-_.=:/", character)
+}
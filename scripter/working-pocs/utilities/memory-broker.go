@@ -0,0 +1,177 @@
+package utilities
+
+import (
+	"context"
+	"fmt"
+	"scripter/entities"
+	"strconv"
+	"sync"
+)
+
+// MemoryBroker keeps every topic in process. It is meant for tests and for
+// single-process runs where publishing and consuming happen side by side.
+type MemoryBroker struct {
+	mutex     sync.Mutex
+	queues    map[string][]entities.BrokerMessage
+	inFlight  map[string]entities.BrokerMessage
+	available map[string]chan struct{}
+	nextTag   int
+	closed    bool
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		queues:    map[string][]entities.BrokerMessage{},
+		inFlight:  map[string]entities.BrokerMessage{},
+		available: map[string]chan struct{}{},
+	}
+}
+
+func (broker *MemoryBroker) Publish(ctx context.Context, topic string, message entities.BrokerMessage) error {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	if broker.closed {
+		return fmt.Errorf("memory broker is closed")
+	}
+	message.Topic = topic
+	broker.queues[topic] = insertByPriority(broker.queues[topic], message)
+	broker.notify(topic)
+	return nil
+}
+
+func (broker *MemoryBroker) Subscribe(ctx context.Context, topic string) (<-chan entities.BrokerMessage, error) {
+	deliveries := make(chan entities.BrokerMessage)
+
+	go func() {
+		defer close(deliveries)
+		for {
+			message, ok := broker.next(topic)
+			if !ok {
+				select {
+				case <-ctx.Done():
+					return
+				case <-broker.signal(topic):
+					continue
+				}
+			}
+			select {
+			case deliveries <- message:
+			case <-ctx.Done():
+				broker.Nack(context.Background(), message, true)
+				return
+			}
+		}
+	}()
+
+	return deliveries, nil
+}
+
+func (broker *MemoryBroker) Ack(ctx context.Context, message entities.BrokerMessage) error {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	if _, exists := broker.inFlight[message.DeliveryTag]; !exists {
+		return fmt.Errorf("unknown delivery %q", message.DeliveryTag)
+	}
+	delete(broker.inFlight, message.DeliveryTag)
+	return nil
+}
+
+func (broker *MemoryBroker) Nack(ctx context.Context, message entities.BrokerMessage, requeue bool) error {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	original, exists := broker.inFlight[message.DeliveryTag]
+	if !exists {
+		return fmt.Errorf("unknown delivery %q", message.DeliveryTag)
+	}
+	delete(broker.inFlight, message.DeliveryTag)
+	if requeue {
+		original.Redelivered = true
+		original.DeliveryTag = ""
+		broker.queues[original.Topic] = insertByPriority(broker.queues[original.Topic], original)
+		broker.notify(original.Topic)
+	}
+	return nil
+}
+
+func (broker *MemoryBroker) DeleteTopic(ctx context.Context, topic string) error {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	delete(broker.queues, topic)
+	return nil
+}
+
+func (broker *MemoryBroker) Close() error {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	broker.closed = true
+	return nil
+}
+
+// Pending reports how many messages of a topic are waiting to be delivered.
+func (broker *MemoryBroker) Pending(topic string) int {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	return len(broker.queues[topic])
+}
+
+func (broker *MemoryBroker) next(topic string) (entities.BrokerMessage, bool) {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	queue := broker.queues[topic]
+	if len(queue) == 0 {
+		return entities.BrokerMessage{}, false
+	}
+	message := queue[0]
+	broker.queues[topic] = queue[1:]
+
+	broker.nextTag++
+	message.DeliveryTag = strconv.Itoa(broker.nextTag)
+	broker.inFlight[message.DeliveryTag] = message
+	return message, true
+}
+
+func (broker *MemoryBroker) signal(topic string) <-chan struct{} {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	if len(broker.queues[topic]) > 0 {
+		ready := make(chan struct{})
+		close(ready)
+		return ready
+	}
+	if _, exists := broker.available[topic]; !exists {
+		broker.available[topic] = make(chan struct{})
+	}
+	return broker.available[topic]
+}
+
+// notify wakes every subscriber waiting on the topic. Callers hold the mutex.
+func (broker *MemoryBroker) notify(topic string) {
+	if waiting, exists := broker.available[topic]; exists {
+		close(waiting)
+		delete(broker.available, topic)
+	}
+}
+
+// insertByPriority keeps the queue ordered by descending priority and FIFO
+// among messages of the same priority.
+func insertByPriority(queue []entities.BrokerMessage, message entities.BrokerMessage) []entities.BrokerMessage {
+	position := len(queue)
+	for index, queued := range queue {
+		if message.Priority > queued.Priority {
+			position = index
+			break
+		}
+	}
+	queue = append(queue, entities.BrokerMessage{})
+	copy(queue[position+1:], queue[position:])
+	queue[position] = message
+	return queue
+}
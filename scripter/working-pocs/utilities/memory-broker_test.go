@@ -0,0 +1,124 @@
+package utilities
+
+import (
+	"context"
+	"scripter/entities"
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, deliveries <-chan entities.BrokerMessage) entities.BrokerMessage {
+	t.Helper()
+	select {
+	case message := <-deliveries:
+		return message
+	case <-time.After(time.Second):
+		t.Fatal("no message delivered")
+		return entities.BrokerMessage{}
+	}
+}
+
+func TestMemoryBrokerDeliversByPriorityThenInOrder(t *testing.T) {
+	broker := NewMemoryBroker()
+	ctx := context.Background()
+	for _, message := range []entities.BrokerMessage{
+		{Id: "low", Priority: 1},
+		{Id: "first-high", Priority: 9},
+		{Id: "second-high", Priority: 9},
+		{Id: "middle", Priority: 4},
+	} {
+		if err := broker.Publish(ctx, SignalTopic, message); err != nil {
+			t.Fatalf("publish %s: %v", message.Id, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	deliveries, err := broker.Subscribe(ctx, SignalTopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"first-high", "second-high", "middle", "low"} {
+		message := receive(t, deliveries)
+		if message.Id != want {
+			t.Fatalf("delivered %s, want %s", message.Id, want)
+		}
+		if message.Topic != SignalTopic {
+			t.Errorf("topic of %s is %q, want %q", message.Id, message.Topic, SignalTopic)
+		}
+		if err := broker.Ack(ctx, message); err != nil {
+			t.Fatalf("ack %s: %v", message.Id, err)
+		}
+	}
+}
+
+func TestMemoryBrokerAckSettlesADeliveryOnce(t *testing.T) {
+	broker := NewMemoryBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := broker.Publish(ctx, SignalTopic, entities.BrokerMessage{Id: "signal"}); err != nil {
+		t.Fatal(err)
+	}
+	deliveries, err := broker.Subscribe(ctx, SignalTopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := receive(t, deliveries)
+	if err := broker.Ack(ctx, message); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if err := broker.Ack(ctx, message); err == nil {
+		t.Error("second ack of the same delivery succeeded")
+	}
+	if err := broker.Nack(ctx, message, true); err == nil {
+		t.Error("nack of an acked delivery succeeded")
+	}
+	if pending := broker.Pending(SignalTopic); pending != 0 {
+		t.Errorf("%d messages pending after ack, want 0", pending)
+	}
+}
+
+func TestMemoryBrokerNackRequeuesForRedelivery(t *testing.T) {
+	broker := NewMemoryBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := broker.Publish(ctx, SignalTopic, entities.BrokerMessage{Id: "signal"}); err != nil {
+		t.Fatal(err)
+	}
+	deliveries, err := broker.Subscribe(ctx, SignalTopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := receive(t, deliveries)
+	if first.Redelivered {
+		t.Error("first delivery marked as redelivered")
+	}
+	if err := broker.Nack(ctx, first, true); err != nil {
+		t.Fatalf("nack: %v", err)
+	}
+	second := receive(t, deliveries)
+	if second.Id != first.Id || !second.Redelivered {
+		t.Errorf("got %+v, want %s redelivered", second, first.Id)
+	}
+	if second.DeliveryTag == first.DeliveryTag {
+		t.Errorf("redelivery reused delivery tag %q", first.DeliveryTag)
+	}
+	if err := broker.Nack(ctx, second, false); err != nil {
+		t.Fatalf("nack without requeue: %v", err)
+	}
+	if pending := broker.Pending(SignalTopic); pending != 0 {
+		t.Errorf("%d messages pending after a nack without requeue, want 0", pending)
+	}
+}
+
+func TestMemoryBrokerRefusesToPublishOnceClosed(t *testing.T) {
+	broker := NewMemoryBroker()
+	if err := broker.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := broker.Publish(context.Background(), SignalTopic, entities.BrokerMessage{Id: "signal"}); err == nil {
+		t.Error("publish on a closed broker succeeded")
+	}
+}
@@ -1,11 +1,17 @@
 package utilities
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"reflect"
 	"runtime"
 	"scripter/entities"
 	"scripter/entities/versions"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type ObjectHandler struct{}
@@ -14,7 +20,9 @@ var fileReader = FileReader{}
 
 //Object Array Generator - More context logic related
 
-func (objectHandler ObjectHandler) GenerateYamlProperties(yamls []*versions.YamlFile_Generic_01) ([]entities.YamlProperty, []entities.YamlContextProperty, []entities.SignalStep, []entities.Label) {
+// GenerateYamlProperties fails on settings that do not parse, such as a
+// timeout that is not a duration, rather than running without them.
+func (objectHandler ObjectHandler) GenerateYamlProperties(yamls []*versions.YamlFile_Generic_01) ([]entities.YamlProperty, []entities.YamlContextProperty, []entities.SignalStep, []entities.Label, error) {
 
 	yamlProperties := []entities.YamlProperty{}
 	yamlContextProperties := []entities.YamlContextProperty{}
@@ -38,19 +46,29 @@ func (objectHandler ObjectHandler) GenerateYamlProperties(yamls []*versions.Yaml
 		yamlProperties = append(yamlProperties, generateProperty("Configuration.Security.AuthorizationHub", yaml.Configuration.Security.AuthorizationHub, yaml.Header.Name, yaml.Configuration.CanOverwrite))
 
 		yamlProperties = append(yamlProperties, generateProperty("Action.Api", yaml.Action.Api, yaml.Header.Name, yaml.Action.CanOverwrite))
+		yamlProperties = append(yamlProperties, generateProperty("Action.Request.Method", yaml.Action.Request.Method, yaml.Header.Name, yaml.Action.CanOverwrite))
+		yamlProperties = append(yamlProperties, generateDictionaryProperty("Action.Request.Headers", stringHandler.StringListToMap(stringHandler.RemoveUnnecessaryStringInArray(yaml.Action.Request.Headers)), yaml.Header.Name, yaml.Action.CanOverwrite))
+		yamlProperties = append(yamlProperties, generateProperty("Action.Request.Body", yaml.Action.Request.Body, yaml.Header.Name, yaml.Action.CanOverwrite))
+		yamlProperties = append(yamlProperties, generateArrayProperty("Action.Request.ExpectedStatus", yaml.Action.Request.ExpectedStatus, yaml.Header.Name, yaml.Action.CanOverwrite))
 		yamlProperties = append(yamlProperties, generateProperty("Action.NameOrFullPath", yaml.Action.NameOrFullPath, yaml.Header.Name, yaml.Action.CanOverwrite))
 		yamlProperties = append(yamlProperties, generateProperty("Action.Type", yaml.Action.Type, yaml.Header.Name, yaml.Action.CanOverwrite))
 		yamlProperties = append(yamlProperties, generateProperty("Action.ShutdownSignal", yaml.Action.ShutdownSignal, yaml.Header.Name, yaml.Action.CanOverwrite))
+		yamlProperties = append(yamlProperties, generateProperty("Action.ShutdownGracePeriod", yaml.Action.ShutdownGracePeriod, yaml.Header.Name, yaml.Action.CanOverwrite))
+		yamlProperties = append(yamlProperties, generateProperty("Action.WorkingDirectory", yaml.Action.WorkingDirectory, yaml.Header.Name, yaml.Action.CanOverwrite))
+		yamlProperties = append(yamlProperties, generateProperty("Action.Stdin", yaml.Action.Stdin, yaml.Header.Name, yaml.Action.CanOverwrite))
 		yamlProperties = append(yamlProperties, generateProperty("Action.Platform.OsFamily", yaml.Action.Platform.OsFamily, yaml.Header.Name, yaml.Action.CanOverwrite))
 		yamlProperties = append(yamlProperties, generateProperty("Action.Platform.PackageInstaller", yaml.Action.Platform.PackageInstaller, yaml.Header.Name, yaml.Action.CanOverwrite))
-		yamlProperties = append(yamlProperties, generateArrayProperty("Action.Platform.InstallationDependencies", yaml.Action.InstallationDependencies, yaml.Header.Name, yaml.Action.CanOverwrite))
+		yamlProperties = append(yamlProperties, generateDependenciesProperty("Action.Platform.InstallationDependencies", yaml.Action.InstallationDependencies, yaml.Header.Name, yaml.Action.CanOverwrite))
+		yamlProperties = append(yamlProperties, generateExecutionDependenciesProperty("Action.ExecutionDependencies", yaml.Action.ExecutionDependencies, yaml.Header.Name, yaml.Action.CanOverwrite))
 		yamlProperties = append(yamlProperties, generateArrayProperty("Action.InitialInputs", yaml.Action.InitialInputs, yaml.Header.Name, yaml.Action.CanOverwrite))
+		yamlProperties = append(yamlProperties, generatePolicyProperties("Action.", yaml.Action.Retry, yaml.Action.Timeout, yaml.Header.Name, yaml.Action.CanOverwrite)...)
+		yamlProperties = append(yamlProperties, generatePolicyProperties("Action.Platform.", yaml.Action.Platform.Retry, yaml.Action.Platform.Timeout, yaml.Header.Name, yaml.Action.CanOverwrite)...)
 		labels = append(labels, generateLabels(yaml.Header.Labels, yaml.Header.Name)...)
 		yamlProperties = append(yamlProperties, generateDictionaryProperty("Action.EnvironmentVariables", stringHandler.StringListToMap(stringHandler.RemoveUnnecessaryStringInArray(yaml.Action.EnvironmentVariables)), yaml.Header.Name, yaml.Action.CanOverwrite))
 
 		for index, context := range yaml.Environment.Contexts {
 			yamlContextProperties = append(yamlContextProperties, generateContextProperty("Environment.Context.Context", context.Context, yaml.Header.Name, index, yaml.Environment.CanOverwrite))
-			yamlContextProperties = append(yamlContextProperties, generateContextArrayProperty("Environment.Context.Dependencies", context.Dependencies, yaml.Header.Name, index, yaml.Environment.CanOverwrite))
+			yamlContextProperties = append(yamlContextProperties, generateContextExecutionDependenciesProperty("Environment.Context.Dependencies", context.Dependencies, yaml.Header.Name, index, yaml.Environment.CanOverwrite))
 			yamlContextProperties = append(yamlContextProperties, generateContextArrayProperty("Environment.Context.ContextInitialInputs", context.ContextInitialInputs, yaml.Header.Name, index, yaml.Environment.CanOverwrite))
 			yamlContextProperties = append(yamlContextProperties, generateContextDictionaryProperty("Environment.Context.EnvironmentVariables", stringHandler.StringListToMap(stringHandler.RemoveUnnecessaryStringInArray(context.EnvironmentVariables)), yaml.Header.Name, index, yaml.Environment.CanOverwrite))
 		}
@@ -58,7 +76,11 @@ func (objectHandler ObjectHandler) GenerateYamlProperties(yamls []*versions.Yaml
 		if yaml.Steps.CanOverwrite != nil && (*yaml.Steps.CanOverwrite || len(yaml.Steps.List) == 0) {
 			overridableSteps = append(overridableSteps, yaml.Header.Name)
 		} else {
-			signalSteps = append(signalSteps, generateSignalSteps(yaml)...)
+			steps, err := generateSignalSteps(yaml)
+			if err != nil {
+				return nil, nil, nil, nil, err
+			}
+			signalSteps = append(signalSteps, steps...)
 		}
 
 	}
@@ -77,43 +99,66 @@ func (objectHandler ObjectHandler) GenerateYamlProperties(yamls []*versions.Yaml
 		}
 	}
 
-	return yamlProperties, yamlContextProperties, finalSignalSteps, labels
+	return yamlProperties, yamlContextProperties, finalSignalSteps, labels, nil
 }
 
+// A raw label is a plain name ("vikings"), a key/value pair ("os=linux"), a
+// removal of an ancestor's label ("-window-program" or "-os"), and may carry
+// the $(sealed) marker so no descendant can remove or change it.
 func generateLabels(rawlabels []string, templateName string) []entities.Label {
 	labels := []entities.Label{}
 	for _, rawLabel := range rawlabels {
+		value, _, sealed := stringHandler.ExtractMarker(rawLabel, "sealed")
 		label := entities.Label{
-			Label:    rawLabel,
+			Sealed:   sealed,
 			Template: templateName,
 		}
-		labels = append(labels, label)
+		if strings.HasPrefix(value, "-") {
+			label.Removal = true
+			value = strings.TrimSpace(strings.TrimPrefix(value, "-"))
+		}
+		if key, keyValue, isPair := strings.Cut(value, "="); isPair {
+			label.Key = strings.TrimSpace(key)
+			label.Value = strings.TrimSpace(keyValue)
+			value = label.Key + "=" + label.Value
+		}
+		label.Label = value
+		if label.Label != "" {
+			labels = append(labels, label)
+		}
 	}
 	return labels
 }
 
-func generateSignalSteps(yaml *versions.YamlFile_Generic_01) []entities.SignalStep {
+func generateSignalSteps(yaml *versions.YamlFile_Generic_01) ([]entities.SignalStep, error) {
 	signalSteps := []entities.SignalStep{}
 	for _, step := range yaml.Steps.List {
+		if strings.TrimSpace(step.Pointer) == "" {
+			continue
+		}
 		signalStep := entities.SignalStep{
-			Name:    step.Step,
-			Pointer: step.Pointer,
-			Source:  yaml.Header.Name,
+			Name:      step.Step,
+			Pointer:   step.Pointer,
+			Source:    yaml.Header.Name,
+			Priority:  step.Priority,
+			OnFailure: step.OnFailure,
+			When:      step.When,
+		}
+		if signalStep.OnFailure == "" {
+			signalStep.OnFailure = yaml.Steps.OnFailure
+		}
+		stepsPolicy, err := parseExecutionPolicy(yaml.Steps.Retry, yaml.Steps.Timeout, yaml.Header.Name)
+		if err != nil {
+			return nil, err
+		}
+		stepPolicy, err := parseExecutionPolicy(step.Retry, step.Timeout, yaml.Header.Name)
+		if err != nil {
+			return nil, fmt.Errorf("step %s: %w", step.Step, err)
 		}
+		signalStep.Policy = objectHandler.MergeExecutionPolicy(stepsPolicy, stepPolicy)
 		signalSteps = append(signalSteps, signalStep)
 	}
-	return signalSteps
-}
-
-func generateContextArrayProperty(name string, values []string, templateName string, index int, override *bool) entities.YamlContextProperty {
-	yamlProperty := entities.YamlContextProperty{Name: name, Values: values, TemplateName: templateName, Position: index}
-	if override != nil {
-		yamlProperty.Sealed = !*override
-	}
-	if stringHandler.ContainsString(values, "default") {
-		yamlProperty.Default = true
-	}
-	return yamlProperty
+	return signalSteps, nil
 }
 
 func appendNew(steps []entities.SignalStep, currentStep entities.SignalStep) []entities.SignalStep {
@@ -137,6 +182,25 @@ func containsObject(steps []entities.SignalStep, step entities.SignalStep) bool
 	return false
 }
 
+func generateContextArrayProperty(name string, values []string, templateName string, index int, override *bool) entities.YamlContextProperty {
+	yamlProperty := entities.YamlContextProperty{Name: name, Values: values, TemplateName: templateName, Position: index}
+	if override != nil {
+		yamlProperty.Sealed = !*override
+	}
+	if stringHandler.ContainsString(values, "default") {
+		yamlProperty.Default = true
+	}
+	return yamlProperty
+}
+
+func generateContextExecutionDependenciesProperty(name string, dependencies []entities.ExecutionDependency, templateName string, index int, override *bool) entities.YamlContextProperty {
+	yamlProperty := entities.YamlContextProperty{Name: name, ExecutionDependencies: dependencies, TemplateName: templateName, Position: index}
+	if override != nil {
+		yamlProperty.Sealed = !*override
+	}
+	return yamlProperty
+}
+
 func generateContextDictionaryProperty(name string, values map[string]string, templateName string, index int, override *bool) entities.YamlContextProperty {
 	yamlProperty := entities.YamlContextProperty{Name: name, DictValues: values, TemplateName: templateName, Position: index}
 	if override != nil {
@@ -168,6 +232,18 @@ func generateBoolProperty(name string, value *bool, templateName string, overrid
 	return yamlProperty
 }
 
+// Every retry and timeout setting is a property of its own, so a descendant can
+// change the timeout alone and keep the inherited retries.
+func generatePolicyProperties(prefix string, retry versions.YamlRetry_Generic_01, timeout string, templateName string, override *bool) []entities.YamlProperty {
+	return []entities.YamlProperty{
+		generateProperty(prefix+"Retry.MaxAttempts", retry.MaxAttempts, templateName, override),
+		generateProperty(prefix+"Retry.Backoff", retry.Backoff, templateName, override),
+		generateProperty(prefix+"Retry.BackoffFactor", retry.BackoffFactor, templateName, override),
+		generateArrayProperty(prefix+"Retry.RetryOn", retry.RetryOn, templateName, override),
+		generateProperty(prefix+"Timeout", timeout, templateName, override),
+	}
+}
+
 //Objectj generator - more context logic related
 
 func generateProperty(name string, value string, templateName string, override *bool) entities.YamlProperty {
@@ -196,6 +272,22 @@ func generateArrayProperty(name string, values []string, templateName string, ov
 	return yamlProperty
 }
 
+func generateDependenciesProperty(name string, dependencies []entities.Dependency, templateName string, override *bool) entities.YamlProperty {
+	yamlProperty := entities.YamlProperty{Name: name, Dependencies: dependencies, TemplateName: templateName}
+	if override != nil {
+		yamlProperty.Sealed = !*override
+	}
+	return yamlProperty
+}
+
+func generateExecutionDependenciesProperty(name string, dependencies []entities.ExecutionDependency, templateName string, override *bool) entities.YamlProperty {
+	yamlProperty := entities.YamlProperty{Name: name, ExecutionDependencies: dependencies, TemplateName: templateName}
+	if override != nil {
+		yamlProperty.Sealed = !*override
+	}
+	return yamlProperty
+}
+
 func generateContextProperty(name string, value string, templateName string, index int, override *bool) entities.YamlContextProperty {
 	yamlProperty := entities.YamlContextProperty{Name: name, Value: value, TemplateName: templateName, Position: index}
 
@@ -209,23 +301,51 @@ func generateContextProperty(name string, value string, templateName string, ind
 	return yamlProperty
 }
 
-func getDistinctLabels(labels []entities.Label) []string {
-	// Use a map to store unique labels encountered.
-	// The value (empty struct{}) is a common idiom for a set in Go,
-	// as it takes up no memory.
-	seenLabels := make(map[string]struct{})
-	var distinctLabels []string // This slice will store the distinct labels
+// resolveLabels applies the labels of the template chain from the oldest
+// ancestor down. Repeated labels collapse into one, a key/value label replaces
+// an inherited one with the same key, and removals drop inherited labels by
+// name or key, unless the inherited label was sealed.
+func resolveLabels(labels []entities.Label) []entities.Label {
+	resolved := []entities.Label{}
+
+	findLabel := func(label entities.Label) int {
+		for index, existing := range resolved {
+			if existing.Label == label.Label || (label.Key != "" && existing.Key == label.Key) {
+				return index
+			}
+			if label.Removal && label.Key == "" && existing.Key == label.Label {
+				return index
+			}
+		}
+		return -1
+	}
 
-	for _, l := range labels {
-		// Check if the label has already been added to our set
-		if _, exists := seenLabels[l.Label]; !exists {
-			// If not, add it to the map
-			seenLabels[l.Label] = struct{}{}
-			// And append it to our result slice
-			distinctLabels = append(distinctLabels, l.Label)
+	for _, label := range labels {
+		index := findLabel(label)
+		if index != -1 && resolved[index].Sealed && resolved[index].Template != label.Template {
+			continue
 		}
+		if label.Removal {
+			if index != -1 {
+				resolved = append(resolved[:index], resolved[index+1:]...)
+			}
+			continue
+		}
+		if index != -1 {
+			resolved[index] = label
+			continue
+		}
+		resolved = append(resolved, label)
 	}
 
+	return resolved
+}
+
+func getDistinctLabels(labels []entities.Label) []string {
+	distinctLabels := []string{}
+	for _, label := range labels {
+		distinctLabels = append(distinctLabels, label.Label)
+	}
 	return distinctLabels
 }
 
@@ -243,7 +363,7 @@ func generateDictionaryProperty(name string, values map[string]string, templateN
 	return yamlProperty
 }
 
-func (objectHandler ObjectHandler) GenerateSignal(generalProperties []entities.YamlProperty, contextProperties []entities.YamlContextProperty, steps []entities.SignalStep, labels []entities.Label, originatorPath string, nickname string, requireAcknowledge string) entities.Signal {
+func (objectHandler ObjectHandler) GenerateSignal(generalProperties []entities.YamlProperty, contextProperties []entities.YamlContextProperty, steps []entities.SignalStep, labels []entities.Label, originatorPath string, nickname string, requireAcknowledge string) (entities.Signal, error) {
 	sealedProperties := []string{}
 	signal := entities.Signal{}
 	signal.Sender = generalProperties[len(generalProperties)-1].TemplateName
@@ -252,7 +372,11 @@ func (objectHandler ObjectHandler) GenerateSignal(generalProperties []entities.Y
 		if stringHandler.ContainsString(sealedProperties, prop.Name) {
 			continue
 		}
-		signal = updateSignalGeneralProperties(signal, prop)
+		var err error
+		signal, err = updateSignalGeneralProperties(signal, prop)
+		if err != nil {
+			return entities.Signal{}, err
+		}
 		if prop.Sealed {
 			sealedProperties = append(sealedProperties, prop.Name)
 		}
@@ -265,39 +389,140 @@ func (objectHandler ObjectHandler) GenerateSignal(generalProperties []entities.Y
 		signal.OriginatorQuay.RequireAcknowledge = stringHandler.InterpretStringAsBool(requireAcknowledge)
 	}
 
-	signal.Labels = getDistinctLabels(labels)
+	signal.LabelSet = resolveLabels(labels)
+	signal.Labels = getDistinctLabels(signal.LabelSet)
+
+	signal.Steps = steps
 
 	if signal.Environment == "default" {
-		return signal
+		return signal, nil
 	}
 
 	signal = updateSignalContextProperties(signal, contextProperties)
 
 	signal.EmitQuays = generateEmitQuays(signal, steps)
 
+	return signal, nil
+}
+
+// InterpolateSignal fills the "${{ steps.<name>.outputs.<key> }}" references
+// in what the signal runs with the outputs it received.
+func (objectHandler ObjectHandler) InterpolateSignal(signal entities.Signal, outputs map[string]string) (entities.Signal, error) {
+	var err error
+	interpolate := func(value string) string {
+		interpolated, interpolationErr := stringHandler.Interpolate(value, outputs)
+		if interpolationErr != nil && err == nil {
+			err = fmt.Errorf("%s: %w", signal.Sender, interpolationErr)
+		}
+		return interpolated
+	}
+
+	signal.ExecutablePath = interpolate(signal.ExecutablePath)
+	signal.WorkingDirectory = interpolate(signal.WorkingDirectory)
+	arguments := []string{}
+	for _, argument := range signal.Arguments {
+		arguments = append(arguments, interpolate(argument))
+	}
+	signal.Arguments = arguments
+	if signal.EnvironmentVariables != nil {
+		environmentVariables := map[string]string{}
+		for key, value := range signal.EnvironmentVariables {
+			environmentVariables[key] = interpolate(value)
+		}
+		signal.EnvironmentVariables = environmentVariables
+	}
+	signal.Outputs = outputs
+
+	// An api call is also templated from the fields of the signal, as
+	// "${{ signal.id }}" or "${{ env.TOKEN }}"
+	variables := conditionExpression.SignalVariables(signal)
+	interpolateRequest := func(value string) string {
+		interpolated, interpolationErr := stringHandler.Interpolate(value, variables)
+		if interpolationErr != nil && err == nil {
+			err = fmt.Errorf("%s: %w", signal.Sender, interpolationErr)
+		}
+		return interpolated
+	}
+	signal.Api = interpolateRequest(signal.Api)
+	signal.ApiRequest.Body = interpolateRequest(signal.ApiRequest.Body)
+	if signal.ApiRequest.Headers != nil {
+		headers := map[string]string{}
+		for name, value := range signal.ApiRequest.Headers {
+			headers[name] = interpolateRequest(value)
+		}
+		signal.ApiRequest.Headers = headers
+	}
+
+	return signal, err
+}
+
+// RedactSignal returns a copy of the signal fit to print: request header
+// values, which usually carry credentials, and its password and token are
+// masked.
+func (objectHandler ObjectHandler) RedactSignal(signal entities.Signal) entities.Signal {
+	const redacted = "[redacted]"
+	if signal.ApiRequest.Headers != nil {
+		headers := map[string]string{}
+		for name := range signal.ApiRequest.Headers {
+			headers[name] = redacted
+		}
+		signal.ApiRequest.Headers = headers
+	}
+	if signal.Password != "" {
+		signal.Password = redacted
+	}
+	if signal.Token != "" {
+		signal.Token = redacted
+	}
 	return signal
 }
 
+func (objectHandler ObjectHandler) GenerateSignalId() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+// Steps run as part of the action, so they are ordered ahead of the flow
+// dependencies that run once it completes. The step runner runs them in place
+// rather than queueing them, their quays only hold their place in the order. An
+// explicit "priority:" on a step or an execution dependency moves a quay
+// within that single global order, and the final positions become the
+// priorities, so no two quays share one. A "when:" condition is kept on the
+// quay and evaluated when it is dispatched.
 func generateEmitQuays(signal entities.Signal, steps []entities.SignalStep) []entities.EmitQuay {
 	emitQuays := make([]entities.EmitQuay, 0)
 
-	for index, executionDependency := range signal.ExecutionDependencies {
-		emitQuay := entities.EmitQuay{Name: stringHandler.GetFilenameWithoutExtension(executionDependency), Path: executionDependency, Relationship: entities.FlowDependency, Priority: index}
+	for _, step := range steps {
+		emitQuay := entities.EmitQuay{Name: stringHandler.GetFilenameWithoutExtension(step.Pointer), Path: step.Pointer, Relationship: entities.StepDependency, Priority: len(emitQuays), When: step.When}
+		if step.Priority != nil {
+			emitQuay.Priority = *step.Priority
+		}
 		emitQuays = append(emitQuays, emitQuay)
 	}
 
-	for index, step := range steps {
-		emitQuay := entities.EmitQuay{Name: stringHandler.GetFilenameWithoutExtension(step.Pointer), Path: step.Pointer, Relationship: entities.StepDependency, Priority: index}
+	for _, dependency := range signal.ExecutionDependencies {
+		emitQuay := entities.EmitQuay{Name: stringHandler.GetFilenameWithoutExtension(dependency.Path), Path: dependency.Path, Relationship: entities.FlowDependency, Priority: len(emitQuays), When: dependency.When}
+		if dependency.Priority != nil {
+			emitQuay.Priority = *dependency.Priority
+		}
 		emitQuays = append(emitQuays, emitQuay)
 	}
 
+	sort.SliceStable(emitQuays, func(i, j int) bool {
+		return emitQuays[i].Priority < emitQuays[j].Priority
+	})
+	for index := range emitQuays {
+		emitQuays[index].Priority = index
+	}
+
 	return emitQuays
 }
 
 //	if prop.Name == "Header.Labels" {
 //		signal.Labels = prop.Values
 //	}
-func updateSignalGeneralProperties(signal entities.Signal, prop entities.YamlProperty) entities.Signal {
+func updateSignalGeneralProperties(signal entities.Signal, prop entities.YamlProperty) (entities.Signal, error) {
 	if prop.Name == "Configuration.Containerize" {
 		signal.Containerize = *prop.BoolValue
 	}
@@ -331,17 +556,46 @@ func updateSignalGeneralProperties(signal entities.Signal, prop entities.YamlPro
 	if prop.Name == "Action.Type" && prop.Value != "" {
 		signal.Type = stringHandler.RemoveUnnecessaryString(prop.Value)
 	}
+	if prop.Name == "Action.Request.Method" && prop.Value != "" {
+		signal.ApiRequest.Method = strings.ToUpper(stringHandler.RemoveUnnecessaryString(prop.Value))
+	}
+	if prop.Name == "Action.Request.Headers" && len(prop.DictValues) > 0 {
+		signal.ApiRequest.Headers = prop.DictValues
+	}
+	if prop.Name == "Action.Request.Body" && prop.Value != "" {
+		signal.ApiRequest.Body = stringHandler.RemoveUnnecessaryString(prop.Value)
+	}
+	if prop.Name == "Action.Request.ExpectedStatus" && len(prop.Values) > 0 {
+		statusCodes, err := parseStatusCodes(prop.Values, prop.TemplateName)
+		if err != nil {
+			return signal, err
+		}
+		signal.ApiRequest.ExpectedStatus = statusCodes
+	}
 	if prop.Name == "Action.ShutdownSignal" && prop.Value != "" {
 		signal.ShutdownSignal = stringHandler.RemoveUnnecessaryString(prop.Value)
 	}
+	if prop.Name == "Action.ShutdownGracePeriod" && prop.Value != "" {
+		gracePeriod, err := time.ParseDuration(stringHandler.RemoveUnnecessaryString(prop.Value))
+		if err != nil {
+			return signal, fmt.Errorf("invalid shutdown grace period of %s: %w", prop.TemplateName, err)
+		}
+		signal.ShutdownGracePeriod = gracePeriod
+	}
+	if prop.Name == "Action.WorkingDirectory" && prop.Value != "" {
+		signal.WorkingDirectory = stringHandler.RemoveUnnecessaryString(prop.Value)
+	}
+	if prop.Name == "Action.Stdin" && prop.Value != "" {
+		signal.Stdin = stringHandler.RemoveUnnecessaryString(prop.Value)
+	}
 	if prop.Name == "Action.Platform.OsFamily" && prop.Value != "" {
 		signal.SignalOs = stringHandler.RemoveUnnecessaryString(prop.Value)
 	}
 	if prop.Name == "Action.Platform.PackageInstaller" && prop.Value != "" {
 		signal.PackageInstaller = stringHandler.RemoveUnnecessaryString(prop.Value)
 	}
-	if prop.Name == "Action.Platform.InstallationDependencies" && prop.Values != nil && len(prop.Values) > 0 {
-		signal.InstallationDependencies = stringHandler.RemoveUnnecessaryStringInArray(prop.Values)
+	if prop.Name == "Action.Platform.InstallationDependencies" && len(prop.Dependencies) > 0 {
+		signal.InstallationDependencies = prop.Dependencies
 	}
 	if prop.Name == "Action.InitialInputs" && prop.Values != nil && len(prop.Values) > 0 {
 		signal.Arguments = stringHandler.RemoveUnnecessaryStringInArray(prop.Values)
@@ -349,18 +603,26 @@ func updateSignalGeneralProperties(signal entities.Signal, prop entities.YamlPro
 	if prop.Name == "Action.EnvironmentVariables" && prop.DictValues != nil && len(prop.DictValues) > 0 {
 		signal.EnvironmentVariables = prop.DictValues
 	}
-	if prop.Name == "Action.ExecutionDependencies" && prop.Values != nil && len(prop.Values) > 0 {
-		signal.ExecutionDependencies = prop.Values
+	if prop.Name == "Action.ExecutionDependencies" && len(prop.ExecutionDependencies) > 0 {
+		signal.ExecutionDependencies = prop.ExecutionDependencies
+	}
+	var err error
+	if field, isPolicy := strings.CutPrefix(prop.Name, "Action.Platform."); isPolicy && (strings.HasPrefix(field, "Retry.") || field == "Timeout") {
+		signal.InstallationPolicy, err = updateExecutionPolicy(signal.InstallationPolicy, field, prop.Value, prop.Values, prop.TemplateName)
+	} else if field, isPolicy := strings.CutPrefix(prop.Name, "Action."); isPolicy && (strings.HasPrefix(field, "Retry.") || field == "Timeout") {
+		signal.ExecutionPolicy, err = updateExecutionPolicy(signal.ExecutionPolicy, field, prop.Value, prop.Values, prop.TemplateName)
 	}
 
-	return signal
+	return signal, err
 }
 
+// The context properties are read under the names GenerateSignal gives them,
+// "Environment.Context.*"; empty values leave the action ones in place.
 func updateSignalContextProperties(signal entities.Signal, props []entities.YamlContextProperty) entities.Signal {
 	chosenContextIndex := 0
 
 	for _, item := range props {
-		if item.Name == "Context.Context" && item.Value == signal.Environment {
+		if item.Name == "Environment.Context.Context" && item.Value == signal.Environment {
 			chosenContextIndex = item.Position
 			break
 		}
@@ -370,15 +632,15 @@ func updateSignalContextProperties(signal entities.Signal, props []entities.Yaml
 		if item.Position != chosenContextIndex {
 			continue
 		}
-		if item.Name == "Context.Dependencies" {
-			signal.ExecutionDependencies = item.Values
+		if item.Name == "Environment.Context.Dependencies" && len(item.ExecutionDependencies) > 0 {
+			signal.ExecutionDependencies = item.ExecutionDependencies
 			continue
 		}
-		if item.Name == "Context.EnvironmentVariables" {
+		if item.Name == "Environment.Context.EnvironmentVariables" && len(item.DictValues) > 0 {
 			signal.EnvironmentVariables = item.DictValues
 			continue
 		}
-		if item.Name == "Context.ContextInitialInputs" {
+		if item.Name == "Environment.Context.ContextInitialInputs" && len(item.Values) > 0 {
 			signal.Arguments = item.Values
 			continue
 		}
@@ -386,3 +648,107 @@ func updateSignalContextProperties(signal entities.Signal, props []entities.Yaml
 
 	return signal
 }
+
+// MergeExecutionPolicy returns the base policy with whatever the override sets.
+func (objectHandler ObjectHandler) MergeExecutionPolicy(base entities.ExecutionPolicy, override entities.ExecutionPolicy) entities.ExecutionPolicy {
+	if override.Retry.MaxAttempts != 0 {
+		base.Retry.MaxAttempts = override.Retry.MaxAttempts
+	}
+	if override.Retry.Backoff != 0 {
+		base.Retry.Backoff = override.Retry.Backoff
+	}
+	if override.Retry.BackoffFactor != 0 {
+		base.Retry.BackoffFactor = override.Retry.BackoffFactor
+	}
+	if len(override.Retry.RetryOn) > 0 {
+		base.Retry.RetryOn = override.Retry.RetryOn
+	}
+	if override.Timeout != 0 {
+		base.Timeout = override.Timeout
+	}
+	return base
+}
+
+func parseExecutionPolicy(retry versions.YamlRetry_Generic_01, timeout string, templateName string) (entities.ExecutionPolicy, error) {
+	policy := entities.ExecutionPolicy{}
+	fields := []struct {
+		name   string
+		value  string
+		values []string
+	}{
+		{"Retry.MaxAttempts", retry.MaxAttempts, nil},
+		{"Retry.Backoff", retry.Backoff, nil},
+		{"Retry.BackoffFactor", retry.BackoffFactor, nil},
+		{"Retry.RetryOn", "", retry.RetryOn},
+		{"Timeout", timeout, nil},
+	}
+	for _, field := range fields {
+		var err error
+		if policy, err = updateExecutionPolicy(policy, field.name, field.value, field.values, templateName); err != nil {
+			return policy, err
+		}
+	}
+	return policy, nil
+}
+
+func parseStatusCodes(values []string, templateName string) ([]int, error) {
+	statusCodes := []int{}
+	for _, rawStatusCode := range stringHandler.RemoveUnnecessaryStringInArray(values) {
+		statusCode, err := strconv.Atoi(rawStatusCode)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expected status of %s: %w", templateName, err)
+		}
+		statusCodes = append(statusCodes, statusCode)
+	}
+	return statusCodes, nil
+}
+
+// updateExecutionPolicy fails on an invalid setting, naming the field and the
+// template it is set in.
+func updateExecutionPolicy(policy entities.ExecutionPolicy, field string, value string, values []string, templateName string) (entities.ExecutionPolicy, error) {
+	value = stringHandler.RemoveUnnecessaryString(value)
+	if value == "" && len(values) == 0 {
+		return policy, nil
+	}
+	invalid := func(err error) (entities.ExecutionPolicy, error) {
+		return policy, fmt.Errorf("invalid %s of %s: %w", field, templateName, err)
+	}
+
+	switch field {
+	case "Retry.MaxAttempts":
+		attempts, err := strconv.Atoi(value)
+		if err != nil {
+			return invalid(err)
+		}
+		policy.Retry.MaxAttempts = attempts
+	case "Retry.Backoff":
+		backoff, err := time.ParseDuration(value)
+		if err != nil {
+			return invalid(err)
+		}
+		policy.Retry.Backoff = backoff
+	case "Retry.BackoffFactor":
+		factor, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return invalid(err)
+		}
+		policy.Retry.BackoffFactor = factor
+	case "Retry.RetryOn":
+		exitCodes := []int{}
+		for _, rawExitCode := range stringHandler.RemoveUnnecessaryStringInArray(values) {
+			exitCode, err := strconv.Atoi(rawExitCode)
+			if err != nil {
+				return invalid(err)
+			}
+			exitCodes = append(exitCodes, exitCode)
+		}
+		policy.Retry.RetryOn = exitCodes
+	case "Timeout":
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return invalid(err)
+		}
+		policy.Timeout = timeout
+	}
+	return policy, nil
+}
@@ -0,0 +1,136 @@
+package utilities
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"scripter/entities"
+	"strings"
+	"testing"
+)
+
+// chainLabels generates the labels of a template chain, oldest ancestor first,
+// each template named after its position.
+func chainLabels(chain ...[]string) []entities.Label {
+	labels := []entities.Label{}
+	for index, rawLabels := range chain {
+		labels = append(labels, generateLabels(rawLabels, string(rune('a'+index)))...)
+	}
+	return labels
+}
+
+func TestGenerateLabels(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want entities.Label
+	}{
+		{"vikings", entities.Label{Label: "vikings", Template: "t"}},
+		{"os = linux", entities.Label{Label: "os=linux", Key: "os", Value: "linux", Template: "t"}},
+		{"-window-program", entities.Label{Label: "window-program", Removal: true, Template: "t"}},
+		{"- os", entities.Label{Label: "os", Removal: true, Template: "t"}},
+		{"region=eu $(sealed)", entities.Label{Label: "region=eu", Key: "region", Value: "eu", Sealed: true, Template: "t"}},
+	}
+	for _, test := range tests {
+		labels := generateLabels([]string{test.raw}, "t")
+		if len(labels) != 1 || labels[0] != test.want {
+			t.Errorf("generateLabels(%q) = %+v, want %+v", test.raw, labels, test.want)
+		}
+	}
+	if labels := generateLabels([]string{"", "  ", "$(sealed)"}, "t"); len(labels) != 0 {
+		t.Errorf("empty labels generated %+v", labels)
+	}
+}
+
+func TestResolveLabels(t *testing.T) {
+	tests := []struct {
+		name  string
+		chain [][]string
+		want  string
+	}{
+		{"labels add up", [][]string{{"linux"}, {"redis"}}, "linux redis"},
+		{"repeated labels collapse", [][]string{{"linux"}, {"linux", "redis"}}, "linux redis"},
+		{"a descendant removes a label", [][]string{{"linux", "window-program"}, {"-window-program"}}, "linux"},
+		{"a removal by key drops the pair", [][]string{{"os=linux", "redis"}, {"-os"}}, "redis"},
+		{"a removal by pair drops it", [][]string{{"os=linux"}, {"-os=linux"}}, ""},
+		{"removing a missing label does nothing", [][]string{{"linux"}, {"-arm64"}}, "linux"},
+		{"a pair replaces the inherited value", [][]string{{"os=linux", "redis"}, {"os=windows"}}, "os=windows redis"},
+		{"replacement runs down the chain", [][]string{{"stage=dev"}, {"stage=test"}, {"stage=prod"}}, "stage=prod"},
+		{"a grandchild removes what a child replaced", [][]string{{"stage=dev"}, {"stage=test"}, {"-stage"}}, ""},
+		{"a sealed label cannot be removed", [][]string{{"linux $(sealed)"}, {"-linux"}}, "linux"},
+		{"a sealed pair cannot be replaced", [][]string{{"os=linux $(sealed)"}, {"os=windows"}, {"-os"}}, "os=linux"},
+		{"the sealing template may still change it", [][]string{{"os=linux $(sealed)", "os=windows"}}, "os=windows"},
+		{"a label sealed by a descendant is sealed below it", [][]string{{"os=linux"}, {"os=mac $(sealed)"}, {"os=windows"}}, "os=mac"},
+		{"a removed label can be added back", [][]string{{"linux"}, {"-linux"}, {"linux"}}, "linux"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := strings.Join(getDistinctLabels(resolveLabels(chainLabels(test.chain...))), " ")
+			if got != test.want {
+				t.Errorf("labels %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGenerateSignalRefusesSettingsThatDoNotParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"Action.Timeout", "ten minutes", "invalid Timeout of deploy"},
+		{"Action.Retry.MaxAttempts", "three", "invalid Retry.MaxAttempts of deploy"},
+		{"Action.Platform.Retry.Backoff", "5", "invalid Retry.Backoff of deploy"},
+		{"Action.ShutdownGracePeriod", "soon", "invalid shutdown grace period of deploy"},
+	}
+	for _, test := range tests {
+		properties := []entities.YamlProperty{generateProperty(test.name, test.value, "deploy", nil)}
+		_, err := ObjectHandler{}.GenerateSignal(properties, nil, nil, nil, "", "", "")
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s %q: error %v, want %s", test.name, test.value, err, test.want)
+		}
+	}
+
+	properties := []entities.YamlProperty{generateProperty("Action.Timeout", "10m", "deploy", nil)}
+	signal, err := ObjectHandler{}.GenerateSignal(properties, nil, nil, nil, "", "", "")
+	if err != nil || signal.ExecutionPolicy.Timeout.Minutes() != 10 {
+		t.Errorf("timeout %v, %v, want 10m", signal.ExecutionPolicy.Timeout, err)
+	}
+}
+
+func TestGenerateSignalKeepsDependenciesAsWritten(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deploy.yaml")
+	template := `header:
+  name: deploy
+action:
+  name-or-full-path: echo
+  installation-dependencies:
+    - dosbox>=0.74
+    - {name: typescript, installer: npm, binary: tsc, version: ">=5, <6"}
+  execution-dependencies:
+    - {path: "release notes.yaml", when: 'context == "a when=b"'}
+    - notify team.yaml
+`
+	if err := os.WriteFile(path, []byte(template), 0644); err != nil {
+		t.Fatal(err)
+	}
+	signal, err := loadSignal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantInstallation := []entities.Dependency{{Name: "dosbox>=0.74"}, {Installer: "npm", Name: "typescript", Binary: "tsc", Version: ">=5, <6"}}
+	if !reflect.DeepEqual(signal.InstallationDependencies, wantInstallation) {
+		t.Errorf("installation dependencies %+v, want %+v", signal.InstallationDependencies, wantInstallation)
+	}
+	if len(signal.EmitQuays) != 2 {
+		t.Fatalf("emit quays %+v, want both execution dependencies", signal.EmitQuays)
+	}
+	first, second := signal.EmitQuays[0], signal.EmitQuays[1]
+	if first.Path != "release notes.yaml" || first.When != `context == "a when=b"` {
+		t.Errorf("first emit quay %+v, want release notes.yaml with its condition whole", first)
+	}
+	if second.Path != "notify team.yaml" || second.When != "" {
+		t.Errorf("second emit quay %+v, want notify team.yaml", second)
+	}
+}
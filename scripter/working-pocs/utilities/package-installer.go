@@ -0,0 +1,587 @@
+package utilities
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"scripter/entities"
+	"sort"
+	"strings"
+)
+
+// PackagePlaceholder marks where a package manager command takes the package,
+// when it is not the last argument.
+const PackagePlaceholder = "{package}"
+
+// PackageInstaller installs the dependencies of an action through one package
+// manager. A package that is not installed has an empty version.
+type PackageInstaller interface {
+	Name() string
+	RunsOn(hostOs string) bool
+	IsInstalled(ctx context.Context, pkg string) (bool, error)
+	Install(ctx context.Context, pkg string) error
+	Version(ctx context.Context, pkg string) (string, error)
+	Available(ctx context.Context, pkg string) ([]string, error)
+	InstallVersion(ctx context.Context, pkg string, version string) error
+	Uninstall(ctx context.Context, pkg string) error
+	// InstallCommandLine is what installing runs, for the latest version when
+	// version is empty, privilege escalation included. Building it runs
+	// nothing; whether the privileges can be had without interaction is
+	// asked when it runs.
+	InstallCommandLine(pkg string, version string) ([]string, error)
+	NeedsPrivilege() bool
+}
+
+// CommandPackageInstaller drives a package manager through its command line.
+// The query command asks the package manager about one package, without ever
+// running the package itself, and ParseVersion reads its version from the
+// answer, empty when it is not installed. The available command lists the
+// versions the package manager can install.
+type CommandPackageInstaller struct {
+	InstallerName    string
+	Platforms        []string // Host operating systems it runs on
+	Privileged       bool     // Changes system packages, run as root through the privilege escalation
+	InstallCommand   []string
+	UninstallCommand []string
+	QueryCommand     []string
+	ParseVersion     func(pkg string, output string) string
+	AvailableCommand []string
+	ParseAvailable   func(pkg string, output string) []string
+	PinnedPackage    func(pkg string, version string) []string // What to install for one version of the package
+}
+
+func (installer CommandPackageInstaller) Name() string {
+	return installer.InstallerName
+}
+
+func (installer CommandPackageInstaller) IsInstalled(ctx context.Context, pkg string) (bool, error) {
+	version, err := installer.Version(ctx, pkg)
+	return version != "", err
+}
+
+// Version fails only when the package manager cannot be asked; a query the
+// package manager refuses means the package is not installed.
+func (installer CommandPackageInstaller) Version(ctx context.Context, pkg string) (string, error) {
+	command := withPackage(installer.QueryCommand, pkg)
+	output, err := exec.CommandContext(ctx, command[0], command[1:]...).Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return "", fmt.Errorf("%s is not available: %w", installer.InstallerName, err)
+	}
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if err != nil {
+		return "", nil
+	}
+	return strings.TrimSpace(installer.ParseVersion(pkg, string(output))), nil
+}
+
+func (installer CommandPackageInstaller) Install(ctx context.Context, pkg string) error {
+	command, err := installer.InstallCommandLine(pkg, "")
+	if err == nil {
+		err = installer.allowed(withPackage(installer.InstallCommand, pkg))
+	}
+	if err != nil {
+		return fmt.Errorf("cannot install %s with %s: %w", pkg, installer.InstallerName, err)
+	}
+	fmt.Printf("Installing %s with %s...\n", pkg, installer.InstallerName)
+	if err := installer.run(ctx, command); err != nil {
+		return fmt.Errorf("failed to install %s with %s: %w", pkg, installer.InstallerName, err)
+	}
+	fmt.Printf("%s installation finished.\n", pkg)
+	return nil
+}
+
+func (installer CommandPackageInstaller) Available(ctx context.Context, pkg string) ([]string, error) {
+	command := withPackage(installer.AvailableCommand, pkg)
+	output, err := exec.CommandContext(ctx, command[0], command[1:]...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list versions of %s with %s: %w", pkg, installer.InstallerName, err)
+	}
+	return installer.ParseAvailable(pkg, string(output)), nil
+}
+
+// InstallVersion installs one version of the package, downgrading it when a
+// later one is installed.
+func (installer CommandPackageInstaller) InstallVersion(ctx context.Context, pkg string, version string) error {
+	command, err := installer.InstallCommandLine(pkg, version)
+	if err == nil {
+		err = installer.allowed(withPackage(installer.InstallCommand, installer.PinnedPackage(pkg, version)...))
+	}
+	if err != nil {
+		return fmt.Errorf("cannot install %s %s with %s: %w", pkg, version, installer.InstallerName, err)
+	}
+	fmt.Printf("Installing %s %s with %s...\n", pkg, version, installer.InstallerName)
+	if err := installer.run(ctx, command); err != nil {
+		return fmt.Errorf("failed to install %s %s with %s: %w", pkg, version, installer.InstallerName, err)
+	}
+	fmt.Printf("%s %s installation finished.\n", pkg, version)
+	return nil
+}
+
+func (installer CommandPackageInstaller) Uninstall(ctx context.Context, pkg string) error {
+	command, err := installer.commandLine(withPackage(installer.UninstallCommand, pkg))
+	if err == nil {
+		err = installer.allowed(withPackage(installer.UninstallCommand, pkg))
+	}
+	if err != nil {
+		return fmt.Errorf("cannot uninstall %s with %s: %w", pkg, installer.InstallerName, err)
+	}
+	fmt.Printf("Uninstalling %s with %s...\n", pkg, installer.InstallerName)
+	if err := installer.run(ctx, command); err != nil {
+		return fmt.Errorf("failed to uninstall %s with %s: %w", pkg, installer.InstallerName, err)
+	}
+	return nil
+}
+
+func (installer CommandPackageInstaller) InstallCommandLine(pkg string, version string) ([]string, error) {
+	if version == "" {
+		return installer.commandLine(withPackage(installer.InstallCommand, pkg))
+	}
+	return installer.commandLine(withPackage(installer.InstallCommand, installer.PinnedPackage(pkg, version)...))
+}
+
+// NeedsPrivilege tells whether installing goes through the privilege
+// escalation.
+func (installer CommandPackageInstaller) NeedsPrivilege() bool {
+	return installer.Privileged && privilegeEscalation.Needed()
+}
+
+func (installer CommandPackageInstaller) commandLine(command []string) ([]string, error) {
+	if !installer.Privileged {
+		return command, nil
+	}
+	return privilegeEscalation.Command(command)
+}
+
+func (installer CommandPackageInstaller) allowed(command []string) error {
+	if !installer.Privileged {
+		return nil
+	}
+	return privilegeEscalation.Allowed(command)
+}
+
+// withPackage puts the package where the command has the placeholder, or
+// last.
+func withPackage(command []string, pkg ...string) []string {
+	result := []string{}
+	for _, argument := range command {
+		if argument == PackagePlaceholder {
+			result = append(result, pkg...)
+			pkg = nil
+		} else {
+			result = append(result, argument)
+		}
+	}
+	return append(result, pkg...)
+}
+
+// The package manager's output streams to the terminal as it installs.
+func (installer CommandPackageInstaller) run(ctx context.Context, command []string) error {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// splitApkPackage splits "redis-cli-7.2.4-r0" into its name and the
+// "<version>-r<release>" apk appends to it.
+func splitApkPackage(pkg string) (string, string) {
+	release := strings.LastIndex(pkg, "-")
+	if release <= 0 || !strings.HasPrefix(pkg[release+1:], "r") {
+		return pkg, ""
+	}
+	version := strings.LastIndex(pkg[:release], "-")
+	if version <= 0 {
+		return pkg, ""
+	}
+	return pkg[:version], pkg[version+1:]
+}
+
+func (installer CommandPackageInstaller) RunsOn(hostOs string) bool {
+	return stringHandler.ContainsString(installer.Platforms, hostOs)
+}
+
+var linuxPlatforms = []string{"linux"}
+var allPlatforms = []string{"linux", "darwin", "windows"}
+
+var packageInstallers = map[string]PackageInstaller{
+	"apt": CommandPackageInstaller{
+		InstallerName:    "apt",
+		Platforms:        linuxPlatforms,
+		Privileged:       true,
+		InstallCommand:   []string{"apt-get", "install", "-y"},
+		UninstallCommand: []string{"apt-get", "remove", "-y"},
+		QueryCommand:     []string{"dpkg-query", "-W", "-f=${Status}|${Version}"},
+		ParseVersion: func(pkg string, output string) string {
+			// A removed package keeps its entry with a "deinstall ... config-files" status
+			status, version, _ := strings.Cut(output, "|")
+			if !strings.HasSuffix(status, " installed") {
+				return ""
+			}
+			return version
+		},
+		AvailableCommand: []string{"apt-cache", "madison"},
+		ParseAvailable: func(pkg string, output string) []string {
+			// " redis-server | 5:7.0.15-1~deb12u1 | http://deb.debian.org/debian bookworm/main amd64 Packages"
+			return parseColumn(output, "|", 1, func(columns []string) bool { return strings.TrimSpace(columns[0]) == pkg })
+		},
+		PinnedPackage: func(pkg string, version string) []string {
+			return []string{"--allow-downgrades", pkg + "=" + version}
+		},
+	},
+	"dnf": CommandPackageInstaller{
+		InstallerName:    "dnf",
+		Platforms:        linuxPlatforms,
+		Privileged:       true,
+		InstallCommand:   []string{"dnf", "install", "-y"},
+		UninstallCommand: []string{"dnf", "remove", "-y"},
+		QueryCommand:     []string{"rpm", "-q", "--qf", "%{VERSION}-%{RELEASE}"},
+		ParseVersion:     parseWholeOutput,
+		AvailableCommand: []string{"dnf", "list", "--showduplicates", "--quiet"},
+		ParseAvailable: func(pkg string, output string) []string {
+			// "redis.x86_64    7.0.15-1.fc39    updates"
+			return parseColumn(output, "", 1, func(columns []string) bool { return strings.HasPrefix(columns[0], pkg+".") })
+		},
+		PinnedPackage: func(pkg string, version string) []string {
+			return []string{pkg + "-" + version}
+		},
+	},
+	"yum": CommandPackageInstaller{
+		InstallerName:    "yum",
+		Platforms:        linuxPlatforms,
+		Privileged:       true,
+		InstallCommand:   []string{"yum", "install", "-y"},
+		UninstallCommand: []string{"yum", "remove", "-y"},
+		QueryCommand:     []string{"rpm", "-q", "--qf", "%{VERSION}-%{RELEASE}"},
+		ParseVersion:     parseWholeOutput,
+		AvailableCommand: []string{"yum", "list", "--showduplicates", "--quiet"},
+		ParseAvailable: func(pkg string, output string) []string {
+			// "redis.x86_64    7.0.15-1.fc39    updates"
+			return parseColumn(output, "", 1, func(columns []string) bool { return strings.HasPrefix(columns[0], pkg+".") })
+		},
+		PinnedPackage: func(pkg string, version string) []string {
+			return []string{pkg + "-" + version}
+		},
+	},
+	"apk": CommandPackageInstaller{
+		InstallerName:    "apk",
+		Platforms:        linuxPlatforms,
+		Privileged:       true,
+		InstallCommand:   []string{"apk", "add", "--no-cache"},
+		UninstallCommand: []string{"apk", "del"},
+		QueryCommand:     []string{"apk", "list", "--installed"},
+		ParseVersion: func(pkg string, output string) string {
+			// "redis-7.2.4-r0 x86_64 {redis} (BSD-3-Clause) [installed]", next
+			// to which redis-cli-7.2.4-r0 must not pass for redis
+			for _, line := range strings.Split(output, "\n") {
+				fields := strings.Fields(line)
+				if len(fields) == 0 {
+					continue
+				}
+				if name, version := splitApkPackage(fields[0]); name == pkg {
+					return version
+				}
+			}
+			return ""
+		},
+		AvailableCommand: []string{"apk", "policy"},
+		ParseAvailable: func(pkg string, output string) []string {
+			// "redis policy:\n  7.2.4-r0:\n    lib/apk/db/installed"
+			versions := []string{}
+			for _, line := range strings.Split(output, "\n") {
+				if strings.HasPrefix(line, "  ") && !strings.HasPrefix(line, "   ") && strings.HasSuffix(line, ":") {
+					versions = append(versions, strings.TrimSuffix(strings.TrimSpace(line), ":"))
+				}
+			}
+			return versions
+		},
+		PinnedPackage: func(pkg string, version string) []string {
+			return []string{pkg + "=" + version}
+		},
+	},
+	"pacman": CommandPackageInstaller{
+		InstallerName:    "pacman",
+		Platforms:        linuxPlatforms,
+		Privileged:       true,
+		InstallCommand:   []string{"pacman", "-S", "--noconfirm"},
+		UninstallCommand: []string{"pacman", "-R", "--noconfirm"},
+		QueryCommand:     []string{"pacman", "-Q"},
+		ParseVersion:     parseNameAndVersion,
+		AvailableCommand: []string{"pacman", "-Si"},
+		ParseAvailable:   parseVersionField,
+		// pacman only has the version of its repositories, the one listed as available
+		PinnedPackage: func(pkg string, version string) []string {
+			return []string{pkg}
+		},
+	},
+	"pip": CommandPackageInstaller{
+		InstallerName:    "pip",
+		Platforms:        allPlatforms,
+		InstallCommand:   []string{pythonCommand(), "-m", "pip", "install"},
+		UninstallCommand: []string{pythonCommand(), "-m", "pip", "uninstall", "-y"},
+		QueryCommand:     []string{pythonCommand(), "-m", "pip", "show"},
+		ParseVersion: func(pkg string, output string) string {
+			for _, line := range strings.Split(output, "\n") {
+				if version, isVersion := strings.CutPrefix(strings.TrimSpace(line), "Version:"); isVersion {
+					return version
+				}
+			}
+			return ""
+		},
+		AvailableCommand: []string{pythonCommand(), "-m", "pip", "index", "versions"},
+		ParseAvailable: func(pkg string, output string) []string {
+			// "Available versions: 2.31.0, 2.30.0"
+			for _, line := range strings.Split(output, "\n") {
+				if versions, isList := strings.CutPrefix(strings.TrimSpace(line), "Available versions:"); isList {
+					return strings.Split(strings.ReplaceAll(versions, " ", ""), ",")
+				}
+			}
+			return nil
+		},
+		PinnedPackage: func(pkg string, version string) []string {
+			return []string{pkg + "==" + version}
+		},
+	},
+	"npm": CommandPackageInstaller{
+		InstallerName:    "npm",
+		Platforms:        allPlatforms,
+		InstallCommand:   []string{"npm", "install", "--global"},
+		UninstallCommand: []string{"npm", "uninstall", "--global"},
+		QueryCommand:     []string{"npm", "ls", "--global", "--depth=0", "--json"},
+		ParseVersion: func(pkg string, output string) string {
+			listing := struct {
+				Dependencies map[string]struct {
+					Version string `json:"version"`
+				} `json:"dependencies"`
+			}{}
+			if json.Unmarshal([]byte(output), &listing) != nil {
+				return ""
+			}
+			return listing.Dependencies[pkg].Version
+		},
+		AvailableCommand: []string{"npm", "view", "--json", PackagePlaceholder, "versions"},
+		ParseAvailable: func(pkg string, output string) []string {
+			versions := []string{}
+			json.Unmarshal([]byte(output), &versions)
+			return versions
+		},
+		PinnedPackage: func(pkg string, version string) []string {
+			return []string{pkg + "@" + version}
+		},
+	},
+	"homebrew": CommandPackageInstaller{
+		InstallerName:    "homebrew",
+		Platforms:        []string{"darwin", "linux"},
+		InstallCommand:   []string{"brew", "install"},
+		UninstallCommand: []string{"brew", "uninstall"},
+		QueryCommand:     []string{"brew", "list", "--versions"},
+		ParseVersion:     parseNameAndVersion,
+		AvailableCommand: []string{"brew", "info"},
+		ParseAvailable: func(pkg string, output string) []string {
+			// "==> redis: stable 7.2.4 (bottled), HEAD"
+			fields := strings.Fields(strings.SplitN(output, "\n", 2)[0])
+			for index, field := range fields {
+				if field == "stable" && index+1 < len(fields) {
+					return []string{strings.TrimSuffix(fields[index+1], ",")}
+				}
+			}
+			return nil
+		},
+		// Homebrew only has its stable version, the one listed as available
+		PinnedPackage: func(pkg string, version string) []string {
+			return []string{pkg}
+		},
+	},
+	"chocolatey": CommandPackageInstaller{
+		InstallerName:    "chocolatey",
+		Platforms:        []string{"windows"},
+		InstallCommand:   []string{"choco", "install", "-y"},
+		UninstallCommand: []string{"choco", "uninstall", "-y"},
+		QueryCommand:     []string{"choco", "list", "--exact", "--limit-output"},
+		ParseVersion: func(pkg string, output string) string {
+			// "git|2.44.0"
+			for _, line := range strings.Split(output, "\n") {
+				if name, version, isPair := strings.Cut(strings.TrimSpace(line), "|"); isPair && strings.EqualFold(name, pkg) {
+					return version
+				}
+			}
+			return ""
+		},
+		AvailableCommand: []string{"choco", "search", "--exact", "--all-versions", "--limit-output"},
+		ParseAvailable: func(pkg string, output string) []string {
+			return parseColumn(output, "|", 1, func(columns []string) bool { return strings.EqualFold(columns[0], pkg) })
+		},
+		PinnedPackage: func(pkg string, version string) []string {
+			return []string{pkg, "--version", version, "--allow-downgrade"}
+		},
+	},
+}
+
+var packageInstallerAliases = map[string]string{
+	"apt-get": "apt",
+	"brew":    "homebrew",
+	"choco":   "chocolatey",
+	"pip3":    "pip",
+}
+
+// GetPackageInstaller returns the package installer called name, or one of
+// its aliases (brew, choco).
+func GetPackageInstaller(name string) (PackageInstaller, error) {
+	if alias, exists := packageInstallerAliases[name]; exists {
+		name = alias
+	}
+	installer, exists := packageInstallers[name]
+	if !exists {
+		return nil, fmt.Errorf("unsupported package installer %q: choose %s", name, strings.Join(PackageInstallerNames(), ", "))
+	}
+	return installer, nil
+}
+
+// RegisterPackageInstaller adds a package installer, or replaces a built-in
+// one. It is meant for start up, before any signal installs.
+func RegisterPackageInstaller(installer PackageInstaller) {
+	packageInstallers[installer.Name()] = installer
+}
+
+func PackageInstallerNames() []string {
+	names := []string{}
+	for name := range packageInstallers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveDependency reads what the name of a dependency carries and gives it
+// the default installer unless it names one. A prefix naming a known
+// installer, as in "pip:requests", installs it through that installer whatever
+// the platform installer is; only a known installer counts, so "libc6:i386"
+// stays a package of the default one. A constraint after the name, as in
+// "dosbox>=0.74", applies unless the dependency sets a version.
+func ResolveDependency(dependency entities.Dependency, defaultInstaller string) entities.Dependency {
+	if dependency.Installer == "" {
+		dependency.Installer = defaultInstaller
+		if prefix, name, hasPrefix := strings.Cut(dependency.Name, ":"); hasPrefix {
+			if _, err := GetPackageInstaller(prefix); err == nil {
+				dependency.Installer, dependency.Name = prefix, name
+			}
+		}
+	}
+	name, version := SplitVersionConstraint(dependency.Name)
+	dependency.Name = name
+	if dependency.Version == "" {
+		dependency.Version = version
+	}
+	return dependency
+}
+
+// CheckDependency tells whether a dependency is there, going by the database
+// of its package manager and never by running anything it installed. When it
+// is not, the reason says what is missing.
+func CheckDependency(ctx context.Context, installer PackageInstaller, dependency entities.Dependency) (bool, string, error) {
+	version, err := installer.Version(ctx, dependency.Name)
+	if err != nil {
+		return false, "", err
+	}
+	if version == "" {
+		return false, "not installed", nil
+	}
+	if dependency.Version != "" {
+		satisfied, err := VersionSatisfies(version, dependency.Version)
+		if err != nil {
+			return false, "", fmt.Errorf("%s: %w", dependency.Name, err)
+		}
+		if !satisfied {
+			return false, fmt.Sprintf("version %s installed, %s wanted", version, dependency.Version), nil
+		}
+	}
+	if dependency.Binary != "" {
+		if _, err := exec.LookPath(dependency.Binary); err != nil {
+			return false, fmt.Sprintf("installed without %s in PATH", dependency.Binary), nil
+		}
+	}
+	return true, "", nil
+}
+
+// ResolveVersion picks the latest version the installer has that meets the
+// constraint.
+func ResolveVersion(ctx context.Context, installer PackageInstaller, name string, constraint string) (string, error) {
+	available, err := installer.Available(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	picked := ""
+	for _, version := range available {
+		satisfied, err := VersionSatisfies(version, constraint)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", name, err)
+		}
+		if satisfied && (picked == "" || CompareVersions(version, picked) > 0) {
+			picked = version
+		}
+	}
+	if picked == "" {
+		return "", fmt.Errorf("no version of %s available through %s meets %s", name, installer.Name(), constraint)
+	}
+	return picked, nil
+}
+
+// DependencyNames lists the packages alone, for what cannot tell installers apart.
+func DependencyNames(dependencies []entities.Dependency) []string {
+	names := []string{}
+	for _, dependency := range dependencies {
+		names = append(names, ResolveDependency(dependency, "").Name)
+	}
+	return names
+}
+
+// parseColumn returns one column of the lines the filter keeps, splitting on
+// the separator, or on blanks when it is empty.
+func parseColumn(output string, separator string, column int, keep func(columns []string) bool) []string {
+	values := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		columns := strings.Fields(line)
+		if separator != "" {
+			columns = strings.Split(line, separator)
+		}
+		if len(columns) > column && keep(columns) {
+			values = append(values, strings.TrimSpace(columns[column]))
+		}
+	}
+	return values
+}
+
+// "Version         : 7.2.4-1", as pacman describes a package.
+func parseVersionField(pkg string, output string) []string {
+	for _, line := range strings.Split(output, "\n") {
+		if key, value, isField := strings.Cut(line, ":"); isField && strings.TrimSpace(key) == "Version" {
+			return []string{strings.TrimSpace(value)}
+		}
+	}
+	return nil
+}
+
+func parseWholeOutput(pkg string, output string) string {
+	return output
+}
+
+// "redis 7.2.4-1", as pacman and brew list a package.
+func parseNameAndVersion(pkg string, output string) string {
+	fields := strings.Fields(output)
+	if len(fields) < 2 || fields[0] != pkg {
+		return ""
+	}
+	return fields[len(fields)-1]
+}
+
+func pythonCommand() string {
+	if runtime.GOOS == "windows" {
+		return "python"
+	}
+	return "python3"
+}
@@ -0,0 +1,173 @@
+package utilities
+
+import (
+	"context"
+	"os/exec"
+	"scripter/entities"
+	"strings"
+	"testing"
+)
+
+func commandInstaller(t *testing.T, name string) CommandPackageInstaller {
+	t.Helper()
+	installer, err := GetPackageInstaller(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return installer.(CommandPackageInstaller)
+}
+
+func TestGetPackageInstallerTakesAliases(t *testing.T) {
+	for alias, name := range map[string]string{"apt-get": "apt", "brew": "homebrew", "choco": "chocolatey", "pip3": "pip", "dnf": "dnf"} {
+		installer, err := GetPackageInstaller(alias)
+		if err != nil || installer.Name() != name {
+			t.Errorf("GetPackageInstaller(%s) = %v, %v, want %s", alias, installer, err, name)
+		}
+	}
+	if _, err := GetPackageInstaller("emerge"); err == nil || !strings.Contains(err.Error(), "apk") {
+		t.Errorf("error %v, want the installers on offer", err)
+	}
+}
+
+func TestWithPackage(t *testing.T) {
+	tests := []struct {
+		command []string
+		pkg     []string
+		want    string
+	}{
+		{[]string{"apt-get", "install", "-y"}, []string{"redis-server"}, "apt-get install -y redis-server"},
+		{[]string{"npm", "view", "--json", PackagePlaceholder, "versions"}, []string{"typescript"}, "npm view --json typescript versions"},
+		{[]string{"choco", "install", "-y"}, []string{"git", "--version", "2.44.0"}, "choco install -y git --version 2.44.0"},
+	}
+	for _, test := range tests {
+		if got := strings.Join(withPackage(test.command, test.pkg...), " "); got != test.want {
+			t.Errorf("withPackage(%v, %v) = %s, want %s", test.command, test.pkg, got, test.want)
+		}
+	}
+}
+
+func TestParseAvailable(t *testing.T) {
+	tests := []struct {
+		installer string
+		pkg       string
+		output    string
+		want      string
+	}{
+		{"apt", "redis-server", " redis-server | 5:7.0.15-1~deb12u1 | http://deb.debian.org/debian bookworm/main amd64 Packages\n redis-server | 5:7.0.11-1 | http://deb.debian.org/debian bookworm/main amd64 Packages\n redis-tools | 5:7.0.15-1 | http://deb.debian.org/debian bookworm/main amd64 Packages\n", "5:7.0.15-1~deb12u1 5:7.0.11-1"},
+		{"dnf", "redis", "redis.x86_64    7.0.15-1.fc39    updates\nredis-doc.noarch    7.0.15-1.fc39    updates\n", "7.0.15-1.fc39"},
+		{"apk", "redis", "redis policy:\n  7.2.4-r0:\n    lib/apk/db/installed\n  7.2.3-r0:\n    https://dl-cdn.alpinelinux.org/alpine/v3.19/main\n", "7.2.4-r0 7.2.3-r0"},
+		{"pacman", "redis", "Repository      : extra\nName            : redis\nVersion         : 7.2.4-1\n", "7.2.4-1"},
+		{"pip", "requests", "requests (2.31.0)\nAvailable versions: 2.31.0, 2.30.0\n", "2.31.0 2.30.0"},
+		{"npm", "typescript", `["5.3.3", "5.4.2"]`, "5.3.3 5.4.2"},
+		{"homebrew", "redis", "==> redis: stable 7.2.4 (bottled), HEAD\nPersistent key-value database\n", "7.2.4"},
+		{"chocolatey", "git", "git|2.44.0\ngit|2.43.0\ngit.install|2.44.0\n", "2.44.0 2.43.0"},
+	}
+	for _, test := range tests {
+		installer := commandInstaller(t, test.installer)
+		if got := strings.Join(installer.ParseAvailable(test.pkg, test.output), " "); got != test.want {
+			t.Errorf("%s available %s = %q, want %q", test.installer, test.pkg, got, test.want)
+		}
+	}
+}
+
+func TestPinnedPackage(t *testing.T) {
+	tests := map[string]string{
+		"apt":        "--allow-downgrades redis=7.0.15-1",
+		"dnf":        "redis-7.0.15-1",
+		"apk":        "redis=7.0.15-1",
+		"pip":        "redis==7.0.15-1",
+		"npm":        "redis@7.0.15-1",
+		"chocolatey": "redis --version 7.0.15-1 --allow-downgrade",
+		"pacman":     "redis",
+	}
+	for name, want := range tests {
+		if got := strings.Join(commandInstaller(t, name).PinnedPackage("redis", "7.0.15-1"), " "); got != want {
+			t.Errorf("%s pins %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		installer string
+		pkg       string
+		output    string
+		want      string
+	}{
+		{"apt", "redis-server", "install ok installed|5:7.0.15-1~deb12u1", "5:7.0.15-1~deb12u1"},
+		{"apt", "redis-server", "deinstall ok config-files|5:7.0.15-1~deb12u1", ""},
+		{"apt", "redis-server", "", ""},
+		{"dnf", "redis", "7.0.15-1.fc39", "7.0.15-1.fc39"},
+		{"apk", "redis", "redis-cli-7.2.4-r0 x86_64 {redis} (BSD-3-Clause) [installed]\nredis-7.2.4-r0 x86_64 {redis} (BSD-3-Clause) [installed]\n", "7.2.4-r0"},
+		{"apk", "redis", "redis-cli-7.2.4-r0 x86_64 {redis} (BSD-3-Clause) [installed]\n", ""},
+		{"pacman", "redis", "redis 7.2.4-1", "7.2.4-1"},
+		{"pacman", "redis", "redis-cli 7.2.4-1", ""},
+		{"pip", "requests", "Name: requests\nVersion: 2.31.0\nSummary: Python HTTP for Humans.\n", "2.31.0"},
+		{"npm", "typescript", `{"dependencies": {"typescript": {"version": "5.4.2"}}}`, "5.4.2"},
+		{"npm", "typescript", `{}`, ""},
+		{"homebrew", "redis", "redis 7.2.3 7.2.4", "7.2.4"},
+		{"chocolatey", "git", "Git|2.44.0\n", "2.44.0"},
+		{"chocolatey", "git", "git.install|2.44.0\n", ""},
+	}
+	for _, test := range tests {
+		installer := commandInstaller(t, test.installer)
+		if got := strings.TrimSpace(installer.ParseVersion(test.pkg, test.output)); got != test.want {
+			t.Errorf("%s version of %s in %q = %q, want %q", test.installer, test.pkg, test.output, got, test.want)
+		}
+	}
+}
+
+func TestSplitApkPackage(t *testing.T) {
+	tests := map[string][2]string{
+		"redis-7.2.4-r0":     {"redis", "7.2.4-r0"},
+		"redis-cli-7.2.4-r0": {"redis-cli", "7.2.4-r0"},
+		"py3-pip-23.3.1-r0":  {"py3-pip", "23.3.1-r0"},
+		"redis":              {"redis", ""},
+		"redis-7.2.4":        {"redis-7.2.4", ""},
+	}
+	for pkg, want := range tests {
+		if name, version := splitApkPackage(pkg); name != want[0] || version != want[1] {
+			t.Errorf("splitApkPackage(%s) = %s, %s, want %s, %s", pkg, name, version, want[0], want[1])
+		}
+	}
+}
+
+func TestCheckDependency(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh to stand for a package manager")
+	}
+	installed := CommandPackageInstaller{InstallerName: "fake", QueryCommand: []string{"sh", "-c", "echo 7.0.15-1"}, ParseVersion: parseWholeOutput}
+	missing := CommandPackageInstaller{InstallerName: "fake", QueryCommand: []string{"false"}, ParseVersion: parseWholeOutput}
+	tests := []struct {
+		name       string
+		installer  PackageInstaller
+		dependency entities.Dependency
+		want       bool
+		reason     string
+	}{
+		{"installed", installed, entities.Dependency{Name: "redis"}, true, ""},
+		{"version met", installed, entities.Dependency{Name: "redis", Version: "7.0.*"}, true, ""},
+		{"version not met", installed, entities.Dependency{Name: "redis", Version: ">=7.2"}, false, "version 7.0.15-1 installed, >=7.2 wanted"},
+		{"binary in path", installed, entities.Dependency{Name: "redis", Binary: "sh"}, true, ""},
+		{"binary not in path", installed, entities.Dependency{Name: "redis", Binary: "scripter-no-such-binary"}, false, "installed without scripter-no-such-binary in PATH"},
+		{"not installed", missing, entities.Dependency{Name: "redis", Version: "7.0.*"}, false, "not installed"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, reason, err := CheckDependency(context.Background(), test.installer, test.dependency)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want || reason != test.reason {
+				t.Errorf("CheckDependency = %v, %q, want %v, %q", got, reason, test.want, test.reason)
+			}
+		})
+	}
+}
+
+func TestCheckDependencyFailsWithoutThePackageManager(t *testing.T) {
+	installer := CommandPackageInstaller{InstallerName: "fake", QueryCommand: []string{"scripter-no-such-package-manager"}, ParseVersion: parseWholeOutput}
+	if _, _, err := CheckDependency(context.Background(), installer, entities.Dependency{Name: "redis"}); err == nil {
+		t.Error("check without the package manager succeeded")
+	}
+}
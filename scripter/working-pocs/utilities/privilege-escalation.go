@@ -0,0 +1,105 @@
+package utilities
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	PrivilegeEscalationSudo      = "sudo"       // sudo -n, the default
+	PrivilegeEscalationDoas      = "doas"       // doas -n
+	PrivilegeEscalationNone      = "none"       // Run the command as it is
+	PrivilegeEscalationRootCheck = "root-check" // Refuse unless scripter runs as root
+)
+
+// PrivilegeEscalation runs the commands that change the system as root.
+// Nothing is escalated when scripter already runs as root, as in most
+// containers. sudo and doas never ask for a password: when they would, the
+// command is refused with an error instead of hanging on a prompt nobody
+// answers. Whether they would is asked for the very command, right before it
+// runs, so planning never runs anything as root.
+type PrivilegeEscalation struct {
+	Mode string
+}
+
+// SCRIPTER_PRIVILEGE_ESCALATION picks the mode.
+var privilegeEscalation = PrivilegeEscalation{Mode: os.Getenv("SCRIPTER_PRIVILEGE_ESCALATION")}
+
+// Needed tells whether commands get escalated. Windows has no uid, there
+// packages are installed with the rights scripter has.
+func (escalation PrivilegeEscalation) Needed() bool {
+	return escalation.Mode != PrivilegeEscalationNone && os.Geteuid() > 0
+}
+
+// Command returns the command to run as root, or an error telling why it
+// cannot be. It runs nothing; Allowed tells whether the command would get
+// through without a password.
+func (escalation PrivilegeEscalation) Command(command []string) ([]string, error) {
+	if len(command) == 0 {
+		return nil, errEmptyCommand
+	}
+	prefix, err := escalation.prefix()
+	if err != nil {
+		return nil, err
+	}
+	if !escalation.Needed() {
+		return command, nil
+	}
+	if escalation.Mode == PrivilegeEscalationRootCheck {
+		return nil, fmt.Errorf("%s needs root but scripter runs as uid %d", command[0], os.Geteuid())
+	}
+
+	if _, err := exec.LookPath(prefix[0]); err != nil {
+		return nil, fmt.Errorf("%s needs root but %s is not installed: run scripter as root or pick another SCRIPTER_PRIVILEGE_ESCALATION", command[0], prefix[0])
+	}
+	return append(prefix, command...), nil
+}
+
+// Allowed asks sudo or doas whether they would run this very command as root
+// without a password, which runs nothing as root: sudoers may well allow the
+// package manager and nothing else.
+func (escalation PrivilegeEscalation) Allowed(command []string) error {
+	if len(command) == 0 {
+		return errEmptyCommand
+	}
+	prefix, err := escalation.prefix()
+	if err != nil || len(prefix) == 0 || !escalation.Needed() {
+		return err
+	}
+
+	refused := fmt.Errorf("%s needs root but %s would ask for a password: allow it without one for uid %d or run scripter as root", command[0], prefix[0], os.Geteuid())
+	if escalation.Mode == PrivilegeEscalationDoas {
+		// doas -C only matches the command against the rules, printing
+		// "permit nopass" when it would run without a password
+		output, err := exec.Command("doas", append([]string{"-C", doasConfiguration}, command...)...).Output()
+		if err != nil || !strings.HasPrefix(strings.TrimSpace(string(output)), "permit nopass") {
+			return refused
+		}
+		return nil
+	}
+	// sudo -l lists the command instead of running it, and fails when it is
+	// not allowed or would need a password
+	if err := exec.Command("sudo", append([]string{"-n", "-l"}, command...)...).Run(); err != nil {
+		return refused
+	}
+	return nil
+}
+
+var errEmptyCommand = errors.New("no command to run as root")
+
+const doasConfiguration = "/etc/doas.conf"
+
+func (escalation PrivilegeEscalation) prefix() ([]string, error) {
+	switch escalation.Mode {
+	case "", PrivilegeEscalationSudo:
+		return []string{"sudo", "-n"}, nil
+	case PrivilegeEscalationDoas:
+		return []string{"doas", "-n"}, nil
+	case PrivilegeEscalationNone, PrivilegeEscalationRootCheck:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown SCRIPTER_PRIVILEGE_ESCALATION %q: choose sudo, doas, none or root-check", escalation.Mode)
+}
@@ -0,0 +1,58 @@
+package utilities
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPrivilegeEscalationPrefix(t *testing.T) {
+	tests := map[string]string{
+		"":                           "sudo -n",
+		PrivilegeEscalationSudo:      "sudo -n",
+		PrivilegeEscalationDoas:      "doas -n",
+		PrivilegeEscalationNone:      "",
+		PrivilegeEscalationRootCheck: "",
+	}
+	for mode, want := range tests {
+		prefix, err := PrivilegeEscalation{Mode: mode}.prefix()
+		if err != nil || strings.Join(prefix, " ") != want {
+			t.Errorf("prefix of %q = %v, %v, want %s", mode, prefix, err, want)
+		}
+	}
+	if _, err := (PrivilegeEscalation{Mode: "su"}).prefix(); err == nil {
+		t.Error("unknown mode su accepted")
+	}
+}
+
+func TestPrivilegeEscalationCommand(t *testing.T) {
+	command := []string{"apt-get", "install", "-y", "redis-server"}
+	escalated, err := PrivilegeEscalation{Mode: PrivilegeEscalationNone}.Command(command)
+	if err != nil || strings.Join(escalated, " ") != strings.Join(command, " ") {
+		t.Errorf("none escalated to %v, %v, want the command as it is", escalated, err)
+	}
+	if _, err := (PrivilegeEscalation{Mode: "su"}).Command(command); err == nil {
+		t.Error("unknown mode su accepted")
+	}
+
+	escalated, err = PrivilegeEscalation{Mode: PrivilegeEscalationRootCheck}.Command(command)
+	if os.Geteuid() == 0 {
+		if err != nil || len(escalated) != len(command) {
+			t.Errorf("root-check as root = %v, %v, want the command as it is", escalated, err)
+		}
+	} else if err == nil {
+		t.Errorf("root-check as uid %d = %v, want an error", os.Geteuid(), escalated)
+	}
+}
+
+func TestPrivilegeEscalationRefusesAnEmptyCommand(t *testing.T) {
+	for _, mode := range []string{"", PrivilegeEscalationDoas, PrivilegeEscalationNone, PrivilegeEscalationRootCheck} {
+		escalation := PrivilegeEscalation{Mode: mode}
+		if _, err := escalation.Command(nil); err == nil {
+			t.Errorf("%q escalated an empty command", mode)
+		}
+		if err := escalation.Allowed([]string{}); err == nil {
+			t.Errorf("%q allowed an empty command", mode)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !unix
+
+package utilities
+
+import (
+	"os"
+	"os/exec"
+)
+
+// Without process groups and SIGTERM, every shutdown mode that stops the
+// process kills it right away, and only the process itself.
+func prepareProcessGroup(cmd *exec.Cmd, shutdown string) {}
+
+func terminateProcess(process *os.Process, shutdown string) error {
+	return process.Kill()
+}
+
+func killProcess(process *os.Process, shutdown string) error {
+	return process.Kill()
+}
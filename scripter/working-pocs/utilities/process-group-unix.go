@@ -0,0 +1,33 @@
+//go:build unix
+
+package utilities
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Cascade and none start the process in a group of its own: cascade to reach
+// its children through the group, none to keep a terminal interrupt meant for
+// scripter away from it.
+func prepareProcessGroup(cmd *exec.Cmd, shutdown string) {
+	if shutdown == ShutdownCascade || shutdown == ShutdownNone {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
+}
+
+func terminateProcess(process *os.Process, shutdown string) error {
+	return signalProcess(process, shutdown, syscall.SIGTERM)
+}
+
+func killProcess(process *os.Process, shutdown string) error {
+	return signalProcess(process, shutdown, syscall.SIGKILL)
+}
+
+func signalProcess(process *os.Process, shutdown string, signal syscall.Signal) error {
+	if shutdown == ShutdownCascade {
+		return syscall.Kill(-process.Pid, signal)
+	}
+	return process.Signal(signal)
+}
@@ -0,0 +1,229 @@
+//go:build unix
+
+package utilities
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestProcessRunnerRun(t *testing.T) {
+	directory := t.TempDir()
+	var stdout, stderr bytes.Buffer
+	result, err := ProcessRunner{}.Run(context.Background(), ProcessSpec{
+		Path:             "/bin/sh",
+		Arguments:        []string{"-c", `echo "$GREETING from $(pwd)"; echo oops >&2; read line; echo "read $line"; exit 3`},
+		Environment:      map[string]string{"GREETING": "hello"},
+		WorkingDirectory: directory,
+		Stdin:            strings.NewReader("input\n"),
+		Stdout:           &stdout,
+		Stderr:           &stderr,
+	})
+	if err == nil || result.ExitCode != 3 {
+		t.Errorf("exit code %d, error %v, want 3 and an error", result.ExitCode, err)
+	}
+	if want := "hello from " + directory + "\nread input\n"; stdout.String() != want {
+		t.Errorf("stdout %q, want %q", stdout.String(), want)
+	}
+	if stderr.String() != "oops\n" {
+		t.Errorf("stderr %q, want oops", stderr.String())
+	}
+	if result.Pid == 0 || result.FinishTime.Before(result.StartTime) {
+		t.Errorf("result %+v, want the pid and the run times", result)
+	}
+}
+
+func TestProcessRunnerRunSucceeds(t *testing.T) {
+	result, err := ProcessRunner{}.Run(context.Background(), ProcessSpec{Path: "/bin/sh", Arguments: []string{"-c", "true"}})
+	if err != nil || result.ExitCode != 0 {
+		t.Errorf("exit code %d, error %v, want 0", result.ExitCode, err)
+	}
+}
+
+func TestProcessRunnerRunReportsWhatCannotStart(t *testing.T) {
+	result, err := ProcessRunner{}.Run(context.Background(), ProcessSpec{Path: "/nonexistent/program"})
+	if err == nil || !strings.Contains(err.Error(), "failed to start") || result.ExitCode != 1 {
+		t.Errorf("exit code %d, error %v, want 1 and a start failure", result.ExitCode, err)
+	}
+}
+
+func TestProcessRunnerRunReturnsOnceTheProcessExits(t *testing.T) {
+	// A child left behind holds the output pipe, the run still ends
+	var stdout bytes.Buffer
+	result, err := ProcessRunner{}.Run(context.Background(), ProcessSpec{
+		Path:      "/bin/sh",
+		Arguments: []string{"-c", "sleep 5 & echo started"},
+		Stdout:    &stdout,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := result.FinishTime.Sub(result.StartTime); elapsed.Seconds() > 2 {
+		t.Errorf("run took %s, want it over once the shell exited", elapsed)
+	}
+	if !strings.Contains(stdout.String(), "started") {
+		t.Errorf("stdout %q, want started", stdout.String())
+	}
+}
+
+// processAlive tells whether the process still runs, a zombie being over.
+func processAlive(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return true
+	}
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	return len(fields) == 0 || fields[0] != "Z"
+}
+
+// survives tells whether the process still runs after a while, longer when it
+// is expected to exit so that a slow exit is not taken for survival.
+func survives(pid int, expected bool) bool {
+	wait := 2 * time.Second
+	if expected {
+		wait = 200 * time.Millisecond
+	}
+	for deadline := time.Now().Add(wait); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if !processAlive(pid) {
+			return false
+		}
+	}
+	return true
+}
+
+// runWithChild runs a shell that starts a child and waits on it, stops it as
+// shutdown says once both run, and returns the pids of the shell and of the
+// child along with how the run ended.
+func runWithChild(t *testing.T, shutdown string, cancelCause error) (int, int, error) {
+	t.Helper()
+	childFile := filepath.Join(t.TempDir(), "child")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	go func() {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if content, _ := os.ReadFile(childFile); strings.HasSuffix(string(content), "\n") {
+				break
+			}
+		}
+		cancel(cancelCause)
+	}()
+	result, err := ProcessRunner{}.Run(ctx, ProcessSpec{
+		Path:        "/bin/sh",
+		Arguments:   []string{"-c", `sleep 30 & echo $! > "$0"; wait`, childFile},
+		Shutdown:    shutdown,
+		GracePeriod: time.Second,
+	})
+
+	content, readErr := os.ReadFile(childFile)
+	child, convErr := strconv.Atoi(strings.TrimSpace(string(content)))
+	if readErr != nil || convErr != nil {
+		t.Fatalf("child pid not written: %v %v", readErr, convErr)
+	}
+	t.Cleanup(func() {
+		syscall.Kill(child, syscall.SIGKILL)
+		syscall.Kill(result.Pid, syscall.SIGKILL)
+	})
+	return result.Pid, child, err
+}
+
+func TestProcessRunnerShutdown(t *testing.T) {
+	tests := []struct {
+		shutdown      string
+		cause         error
+		shellSurvives bool
+		childSurvives bool
+		leftRunning   bool
+	}{
+		{ShutdownCascade, nil, false, false, false},
+		{ShutdownSingle, nil, false, true, false},
+		{"", nil, false, true, false},
+		{ShutdownNone, nil, true, true, true},
+		// None spares a process from a shutdown, not from its timeout
+		{ShutdownNone, ErrAttemptTimedOut, false, true, false},
+	}
+	for _, test := range tests {
+		name := test.shutdown
+		if name == "" {
+			name = "default"
+		}
+		if test.cause != nil {
+			name += " timed out"
+		}
+		t.Run(name, func(t *testing.T) {
+			shell, child, err := runWithChild(t, test.shutdown, test.cause)
+			if errors.Is(err, ErrLeftRunning) != test.leftRunning {
+				t.Errorf("error %v, want left running %v", err, test.leftRunning)
+			}
+			if survived := survives(shell, test.shellSurvives); survived != test.shellSurvives {
+				t.Errorf("shell survives %v, want %v", survived, test.shellSurvives)
+			}
+			if survived := survives(child, test.childSurvives); survived != test.childSurvives {
+				t.Errorf("child survives %v, want %v", survived, test.childSurvives)
+			}
+		})
+	}
+}
+
+func TestProcessRunnerKillsWhatOutlivesItsGracePeriod(t *testing.T) {
+	for _, shutdown := range []string{ShutdownSingle, ShutdownCascade} {
+		t.Run(shutdown, func(t *testing.T) {
+			ready := filepath.Join(t.TempDir(), "ready")
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+					if _, err := os.Stat(ready); err == nil {
+						break
+					}
+				}
+				cancel()
+			}()
+			gracePeriod := 300 * time.Millisecond
+			result, err := ProcessRunner{}.Run(ctx, ProcessSpec{
+				Path:        "/bin/sh",
+				Arguments:   []string{"-c", `trap "" TERM; touch "$0"; while :; do sleep 0.05; done`, ready},
+				Shutdown:    shutdown,
+				GracePeriod: gracePeriod,
+			})
+			if err == nil {
+				t.Error("a killed process ended without error")
+			}
+			if stopped := result.FinishTime.Sub(result.StartTime); stopped < gracePeriod || stopped > gracePeriod+3*time.Second {
+				t.Errorf("stopped after %s, want right after the %s grace period", stopped, gracePeriod)
+			}
+			if processAlive(result.Pid) {
+				t.Error("process still running")
+			}
+		})
+	}
+}
+
+func TestProcessRunnerEndsWithinItsGracePeriod(t *testing.T) {
+	ready := filepath.Join(t.TempDir(), "ready")
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if _, err := os.Stat(ready); err == nil {
+				break
+			}
+		}
+		cancel()
+	}()
+	result, _ := ProcessRunner{}.Run(ctx, ProcessSpec{
+		Path:        "/bin/sh",
+		Arguments:   []string{"-c", `trap "exit 7" TERM; touch "$0"; while :; do sleep 0.05; done`, ready},
+		GracePeriod: time.Minute,
+	})
+	if result.ExitCode != 7 {
+		t.Errorf("exit code %d, want the 7 the process exited with on SIGTERM", result.ExitCode)
+	}
+}
@@ -0,0 +1,257 @@
+package utilities
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"scripter/entities"
+	"sort"
+	"time"
+)
+
+const (
+	ShutdownCascade = "cascade" // Stop the process along with its children
+	ShutdownSingle  = "single"  // Stop the process alone
+	ShutdownNone    = "none"    // Leave the process running
+
+	DefaultGracePeriod = 10 * time.Second
+)
+
+// ErrLeftRunning is returned for a process its shutdown left running past the
+// end of its context.
+var ErrLeftRunning = errors.New("left running")
+
+// ProcessSpec describes one process to start. Environment is added on top of
+// the environment of scripter itself; nil streams are discarded.
+type ProcessSpec struct {
+	Path             string
+	Arguments        []string
+	Environment      map[string]string
+	WorkingDirectory string
+	Stdin            io.Reader
+	Stdout           io.Writer
+	Stderr           io.Writer
+	Shutdown         string        // What stopping the process reaches, single when empty
+	GracePeriod      time.Duration // Between SIGTERM and SIGKILL
+	Logger           *slog.Logger  // Where stopping the process is logged, nowhere when nil
+}
+
+// ProcessRunner starts an executable, streams its output while it runs and
+// reports how it ended and what it used. When the context ends first, the
+// process is shut down as its spec says: terminated, then killed once the
+// grace period is over, or left running unless its attempt timed out.
+type ProcessRunner struct{}
+
+func (processRunner ProcessRunner) Run(ctx context.Context, spec ProcessSpec) (entities.ProcessResult, error) {
+	result := entities.ProcessResult{ExitCode: 1}
+	if spec.GracePeriod <= 0 {
+		spec.GracePeriod = DefaultGracePeriod
+	}
+
+	cmd := exec.Command(spec.Path, spec.Arguments...)
+	cmd.Dir = spec.WorkingDirectory
+	cmd.Env = append(os.Environ(), environmentList(spec.Environment)...)
+	cmd.Stdin = spec.Stdin
+	prepareProcessGroup(cmd, spec.Shutdown)
+
+	stdout, err := openStream(spec.Stdout)
+	if err != nil {
+		return result, err
+	}
+	stderr, err := openStream(spec.Stderr)
+	if err != nil {
+		stdout.close()
+		return result, err
+	}
+	if stdout.writer != nil {
+		cmd.Stdout = stdout.writer
+	}
+	if stderr.writer != nil {
+		cmd.Stderr = stderr.writer
+	}
+
+	result.StartTime = time.Now()
+	err = cmd.Start()
+	stdout.started()
+	stderr.started()
+	if err != nil {
+		stdout.close()
+		stderr.close()
+		result.FinishTime = time.Now()
+		return result, fmt.Errorf("failed to start %s: %w", spec.Path, err)
+	}
+	result.Pid = cmd.Process.Pid
+	defer stdout.drain()
+	defer stderr.drain()
+
+	waited := make(chan error, 1)
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				waited <- fmt.Errorf("waiting for %s panicked: %v", spec.Path, recovered)
+			}
+		}()
+		waited <- cmd.Wait()
+	}()
+
+	select {
+	case err = <-waited:
+	case <-ctx.Done():
+		stopping := spec
+		if spec.Shutdown == ShutdownNone {
+			// None only spares the process from scripter shutting down. A timed
+			// out attempt is stopped, or it would keep running next to the one
+			// retrying it.
+			if !errors.Is(context.Cause(ctx), ErrAttemptTimedOut) {
+				result.Detached = true
+				result.FinishTime = time.Now()
+				return result, fmt.Errorf("%s as pid %d: %w", spec.Path, result.Pid, ErrLeftRunning)
+			}
+			stopping.Shutdown = ShutdownSingle
+		}
+		processRunner.shutdown(cmd.Process, stopping, waited)
+		err = <-waited
+	}
+	result.FinishTime = time.Now()
+
+	if cmd.ProcessState != nil {
+		result.ExitCode = exitCode(cmd.ProcessState)
+		result.UserTime = cmd.ProcessState.UserTime()
+		result.SystemTime = cmd.ProcessState.SystemTime()
+		result.MaxRss = maxRss(cmd.ProcessState)
+	}
+
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		return result, fmt.Errorf("%s exited with %d", spec.Path, result.ExitCode)
+	}
+	if err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// shutdown asks the process to terminate and kills it once the grace period
+// is over. The caller still receives the outcome from waited.
+func (processRunner ProcessRunner) shutdown(process *os.Process, spec ProcessSpec, waited chan error) {
+	logger := spec.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+	logger.Info("stopping process", "path", spec.Path, "pid", process.Pid, "shutdown", shutdownMode(spec.Shutdown))
+	if err := terminateProcess(process, spec.Shutdown); err != nil {
+		killProcess(process, spec.Shutdown)
+		return
+	}
+
+	select {
+	case err := <-waited:
+		// Hand the outcome back, the process ended within its grace period
+		waited <- err
+		if spec.Shutdown == ShutdownCascade {
+			// Children that outlived the process do not get more time
+			killProcess(process, spec.Shutdown)
+		}
+	case <-time.After(spec.GracePeriod):
+		logger.Warn("process did not stop within its grace period, killing it", "path", spec.Path, "pid", process.Pid, "grace-period", spec.GracePeriod.String())
+		killProcess(process, spec.Shutdown)
+	}
+}
+
+func shutdownMode(shutdown string) string {
+	if shutdown == "" {
+		return ShutdownSingle
+	}
+	return shutdown
+}
+
+func (processRunner ProcessRunner) Describe(result entities.ProcessResult) string {
+	if result.Detached && result.Container != "" {
+		return fmt.Sprintf("container %s left running", result.Container)
+	}
+	if result.Detached {
+		return fmt.Sprintf("pid %d left running", result.Pid)
+	}
+	description := fmt.Sprintf("exit code %d in %s (user %s, system %s", result.ExitCode, result.FinishTime.Sub(result.StartTime).Round(time.Millisecond), result.UserTime.Round(time.Millisecond), result.SystemTime.Round(time.Millisecond))
+	if result.MaxRss > 0 {
+		description += fmt.Sprintf(", max rss %.1f MB", float64(result.MaxRss)/(1024*1024))
+	}
+	return description + ")"
+}
+
+func environmentList(environment map[string]string) []string {
+	keys := []string{}
+	for key := range environment {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	list := []string{}
+	for _, key := range keys {
+		list = append(list, key+"="+environment[key])
+	}
+	return list
+}
+
+// processStream hands a process its own end of a pipe and copies the other end
+// to the destination. Wait then returns as soon as the process exits, even
+// when children it left behind still hold the pipe.
+type processStream struct {
+	reader *os.File
+	writer *os.File
+	copied chan struct{}
+}
+
+// A nil destination leaves the stream unconnected.
+func openStream(destination io.Writer) (*processStream, error) {
+	if destination == nil {
+		return &processStream{}, nil
+	}
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output pipe: %w", err)
+	}
+	stream := &processStream{reader: reader, writer: writer, copied: make(chan struct{})}
+	go func() {
+		defer close(stream.copied)
+		// A destination that panics loses the rest of the output, not the run
+		defer func() {
+			if recover() != nil {
+				io.Copy(io.Discard, reader)
+			}
+		}()
+		io.Copy(destination, reader)
+	}()
+	return stream, nil
+}
+
+// started closes the copy of the writing end the process inherited.
+func (stream *processStream) started() {
+	if stream.writer != nil {
+		stream.writer.Close()
+	}
+}
+
+// drain waits briefly for what the process wrote last, then stops copying
+// whatever its children may still write.
+func (stream *processStream) drain() {
+	if stream.reader == nil {
+		return
+	}
+	select {
+	case <-stream.copied:
+	case <-time.After(time.Second):
+		stream.reader.Close()
+		<-stream.copied
+	}
+	stream.reader.Close()
+}
+
+func (stream *processStream) close() {
+	stream.started()
+	stream.drain()
+}
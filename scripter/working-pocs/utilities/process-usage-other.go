@@ -0,0 +1,14 @@
+//go:build !unix
+
+package utilities
+
+import "os"
+
+func exitCode(state *os.ProcessState) int {
+	return state.ExitCode()
+}
+
+// Peak memory is only read from the rusage of unix systems.
+func maxRss(state *os.ProcessState) int64 {
+	return 0
+}
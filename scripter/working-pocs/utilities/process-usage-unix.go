@@ -0,0 +1,29 @@
+//go:build unix
+
+package utilities
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// A process killed by a signal reports 128 plus the signal, as shells do.
+func exitCode(state *os.ProcessState) int {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return state.ExitCode()
+}
+
+func maxRss(state *os.ProcessState) int64 {
+	usage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+	// Darwin reports bytes, the other systems kilobytes
+	if runtime.GOOS == "darwin" {
+		return int64(usage.Maxrss)
+	}
+	return int64(usage.Maxrss) * 1024
+}
@@ -1,9 +1,94 @@
 package utilities
 
-import "scripter/entities"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"scripter/entities"
+	"sort"
+)
 
-type QueueHandler struct{}
+type QueueHandler struct {
+	Broker Broker
+}
+
+var objectHandler = ObjectHandler{}
+
+// QueueQuaySignals publishes one downstream signal per resolved emit quay of
+// the given relationship, with the current signal as their originator. Flow
+// dependencies are queued once the action completed; steps are run in place by
+// the step runner. Quays go out in their global priority order, spread over
+// the broker priorities. Quays whose "when" condition does not hold for the
+// signal are left out, and so are those whose condition cannot be evaluated;
+// the others are still queued and the bad conditions are returned after.
+func (queueHandler QueueHandler) QueueQuaySignals(signal entities.Signal, relationship entities.Relationship) error {
+	emitQuays := []entities.EmitQuay{}
+	conditionErrs := []error{}
+	variables := conditionExpression.SignalVariables(signal)
+	for _, emitQuay := range signal.EmitQuays {
+		if emitQuay.Relationship != relationship {
+			continue
+		}
+		holds, err := conditionExpression.Holds(emitQuay.When, variables)
+		if err != nil {
+			conditionErrs = append(conditionErrs, fmt.Errorf("quay %s not queued: %w", emitQuay.Name, err))
+			continue
+		}
+		if holds {
+			emitQuays = append(emitQuays, emitQuay)
+		}
+	}
+	if len(emitQuays) == 0 {
+		return errors.Join(conditionErrs...)
+	}
+	if queueHandler.Broker == nil {
+		return fmt.Errorf("no broker configured to queue %d quay signals: set SCRIPTER_BROKER", len(emitQuays))
+	}
+
+	sort.SliceStable(emitQuays, func(i, j int) bool {
+		return emitQuays[i].Priority < emitQuays[j].Priority
+	})
+
+	for index, emitQuay := range emitQuays {
+		request := entities.SignalRequest{
+			Id:             objectHandler.GenerateSignalId(),
+			TemplatePath:   emitQuay.Path,
+			OriginatorPath: signal.SourcePath,
+			Nickname:       emitQuay.Name,
+			ParentSignalId: signal.Id,
+			Relationship:   emitQuay.Relationship,
+			Priority:       emitQuay.Priority,
+			Outputs:        signal.Outputs,
+		}
+		if signal.ShutdownSignal == ShutdownCascade {
+			request.ShutdownSignal, request.ShutdownGracePeriod = signal.ShutdownSignal, signal.ShutdownGracePeriod
+		}
+		body, err := json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("failed to encode signal for quay %s: %w", emitQuay.Name, err)
+		}
+
+		message := entities.BrokerMessage{
+			Id:       request.Id,
+			Body:     body,
+			Priority: BrokerPriority(index, len(emitQuays)),
+			Headers: map[string]string{
+				"sender":        signal.Sender,
+				"parent-signal": signal.Id,
+				"relationship":  relationshipName(emitQuay.Relationship),
+			},
+		}
+		if err := queueHandler.Broker.Publish(context.Background(), SignalTopic, message); err != nil {
+			return fmt.Errorf("failed to queue signal for quay %s: %w", emitQuay.Name, err)
+		}
+	}
+	return errors.Join(conditionErrs...)
+}
 
-func (queueHandler QueueHandler) QueueQuaySignals(signal entities.Signal) {
-	panic("unimplemented")
+func relationshipName(relationship entities.Relationship) string {
+	if relationship == entities.StepDependency {
+		return "step"
+	}
+	return "flow"
 }
@@ -0,0 +1,162 @@
+package utilities
+
+import (
+	"context"
+	"fmt"
+	"scripter/entities"
+	"strconv"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// RabbitMqBroker maps every topic to a durable AMQP 0-9-1 queue declared with
+// priority support, and with an expiry for the topics that have one. Unacked
+// deliveries are redelivered by the server when the consumer connection drops.
+type RabbitMqBroker struct {
+	connection *amqp.Connection
+	channel    *amqp.Channel
+	mutex      sync.Mutex
+	declared   map[string]bool
+}
+
+// NewRabbitMqBroker limits every consumer to prefetch unacked deliveries, so
+// the server keeps the rest for other consumers; 0 or less lifts the limit.
+func NewRabbitMqBroker(url string, prefetch int) (*RabbitMqBroker, error) {
+	connection, err := amqp.Dial(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+	channel, err := connection.Channel()
+	if err != nil {
+		connection.Close()
+		return nil, fmt.Errorf("failed to open RabbitMQ channel: %w", err)
+	}
+	if err := channel.Qos(max(prefetch, 0), 0, false); err != nil {
+		connection.Close()
+		return nil, fmt.Errorf("failed to set RabbitMQ prefetch: %w", err)
+	}
+	return &RabbitMqBroker{connection: connection, channel: channel, declared: map[string]bool{}}, nil
+}
+
+func (broker *RabbitMqBroker) Publish(ctx context.Context, topic string, message entities.BrokerMessage) error {
+	if err := broker.declare(topic); err != nil {
+		return err
+	}
+
+	headers := amqp.Table{}
+	for key, value := range message.Headers {
+		headers[key] = value
+	}
+
+	err := broker.channel.PublishWithContext(ctx, "", topic, false, false, amqp.Publishing{
+		MessageId:    message.Id,
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Priority:     uint8(min(max(message.Priority, 0), MaxBrokerPriority)),
+		Headers:      headers,
+		Body:         message.Body,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", topic, err)
+	}
+	return nil
+}
+
+func (broker *RabbitMqBroker) Subscribe(ctx context.Context, topic string) (<-chan entities.BrokerMessage, error) {
+	if err := broker.declare(topic); err != nil {
+		return nil, err
+	}
+
+	consumer, err := broker.channel.ConsumeWithContext(ctx, topic, "", false, false, false, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume %s: %w", topic, err)
+	}
+
+	deliveries := make(chan entities.BrokerMessage)
+	go func() {
+		defer close(deliveries)
+		for delivery := range consumer {
+			headers := map[string]string{}
+			for key, value := range delivery.Headers {
+				headers[key] = fmt.Sprint(value)
+			}
+			message := entities.BrokerMessage{
+				Id:          delivery.MessageId,
+				Topic:       topic,
+				Body:        delivery.Body,
+				Priority:    int(delivery.Priority),
+				Headers:     headers,
+				Redelivered: delivery.Redelivered,
+				DeliveryTag: strconv.FormatUint(delivery.DeliveryTag, 10),
+			}
+			select {
+			case deliveries <- message:
+			case <-ctx.Done():
+				// What the consumer was handed up to its cancellation goes
+				// back to the queue, not only the delivery in hand
+				broker.channel.Nack(delivery.DeliveryTag, false, true)
+				for buffered := range consumer {
+					broker.channel.Nack(buffered.DeliveryTag, false, true)
+				}
+				return
+			}
+		}
+	}()
+
+	return deliveries, nil
+}
+
+func (broker *RabbitMqBroker) Ack(ctx context.Context, message entities.BrokerMessage) error {
+	tag, err := strconv.ParseUint(message.DeliveryTag, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid delivery tag %q: %w", message.DeliveryTag, err)
+	}
+	return broker.channel.Ack(tag, false)
+}
+
+func (broker *RabbitMqBroker) Nack(ctx context.Context, message entities.BrokerMessage, requeue bool) error {
+	tag, err := strconv.ParseUint(message.DeliveryTag, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid delivery tag %q: %w", message.DeliveryTag, err)
+	}
+	return broker.channel.Nack(tag, false, requeue)
+}
+
+func (broker *RabbitMqBroker) DeleteTopic(ctx context.Context, topic string) error {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	if _, err := broker.channel.QueueDelete(topic, false, false, false); err != nil {
+		return fmt.Errorf("failed to delete queue %s: %w", topic, err)
+	}
+	delete(broker.declared, topic)
+	return nil
+}
+
+func (broker *RabbitMqBroker) Close() error {
+	broker.channel.Close()
+	return broker.connection.Close()
+}
+
+func (broker *RabbitMqBroker) declare(topic string) error {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	if broker.declared[topic] {
+		return nil
+	}
+	arguments := amqp.Table{"x-max-priority": int32(MaxBrokerPriority)}
+	expiry := topicExpiry(topic)
+	if expiry > 0 {
+		// The server deletes the queue once it has gone unused that long,
+		// so it is declared again every time, which also counts as a use
+		arguments["x-expires"] = int32(expiry.Milliseconds())
+	}
+	_, err := broker.channel.QueueDeclare(topic, true, false, false, false, arguments)
+	if err != nil {
+		return fmt.Errorf("failed to declare queue %s: %w", topic, err)
+	}
+	broker.declared[topic] = expiry == 0
+	return nil
+}
@@ -0,0 +1,339 @@
+package utilities
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"scripter/entities"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisConsumerGroup = "scripter"
+
+// Entries pending longer than this belong to a consumer that crashed and are
+// claimed by whoever subscribes next. A live consumer claims the entries it is
+// still working on again every redisHeartbeat, so however long a signal runs
+// it is never taken for a crashed one.
+const redisClaimIdle = 5 * time.Minute
+const redisHeartbeat = redisClaimIdle / 5
+
+// RedisBroker maps every topic to one Redis stream per priority level, read
+// through a consumer group so each message is handed to one consumer and stays
+// pending until it is acknowledged. Higher priority streams are drained first.
+type RedisBroker struct {
+	client   *redis.Client
+	consumer string
+	mutex    sync.Mutex
+	inFlight map[string]bool // Delivery tags not acknowledged yet
+	beating  sync.Once
+	closed   chan struct{}
+}
+
+func NewRedisBroker(url string) (*RedisBroker, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	client := redis.NewClient(options)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	hostname, _ := os.Hostname()
+	return &RedisBroker{client: client, consumer: fmt.Sprintf("%s-%d", hostname, os.Getpid()), inFlight: map[string]bool{}, closed: make(chan struct{})}, nil
+}
+
+func (broker *RedisBroker) Publish(ctx context.Context, topic string, message entities.BrokerMessage) error {
+	headers, err := json.Marshal(message.Headers)
+	if err != nil {
+		return fmt.Errorf("failed to encode headers: %w", err)
+	}
+
+	err = broker.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: redisPriorityStream(topic, message.Priority),
+		Values: map[string]any{
+			"id":       message.Id,
+			"priority": message.Priority,
+			"headers":  string(headers),
+			"body":     string(message.Body),
+		},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", topic, err)
+	}
+	broker.expire(ctx, redisPriorityStream(topic, message.Priority), topic)
+	return nil
+}
+
+func (broker *RedisBroker) Subscribe(ctx context.Context, topic string) (<-chan entities.BrokerMessage, error) {
+	streams := []string{}
+	for priority := MaxBrokerPriority; priority >= 0; priority-- {
+		stream := redisPriorityStream(topic, priority)
+		err := broker.client.XGroupCreateMkStream(ctx, stream, redisConsumerGroup, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return nil, fmt.Errorf("failed to create consumer group on %s: %w", stream, err)
+		}
+		broker.expire(ctx, stream, topic)
+		streams = append(streams, stream)
+	}
+
+	// Deliveries outlive their subscription until they are acknowledged
+	broker.beating.Do(func() { go broker.heartbeat() })
+
+	deliveries := make(chan entities.BrokerMessage)
+	go func() {
+		defer close(deliveries)
+		lastClaim := time.Time{}
+		for ctx.Err() == nil {
+			var entries []entities.BrokerMessage
+			var err error
+			if time.Since(lastClaim) > time.Minute {
+				entries, err = broker.claimStale(ctx, streams)
+				lastClaim = time.Now()
+			}
+			if err == nil && len(entries) == 0 {
+				entries, err = broker.readByPriority(ctx, streams)
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					time.Sleep(time.Second)
+				}
+				continue
+			}
+			for _, entry := range entries {
+				broker.track(entry.DeliveryTag, true)
+				select {
+				case deliveries <- entry:
+				case <-ctx.Done():
+					// Left pending, to be claimed once it is idle
+					broker.track(entry.DeliveryTag, false)
+					return
+				}
+			}
+		}
+	}()
+
+	return deliveries, nil
+}
+
+// readByPriority polls the streams from the highest priority down without
+// blocking and only blocks, on all of them at once, when every one is empty.
+func (broker *RedisBroker) readByPriority(ctx context.Context, streams []string) ([]entities.BrokerMessage, error) {
+	for _, stream := range streams {
+		entries, err := broker.readGroup(ctx, []string{stream, ">"}, -1)
+		if err != nil || len(entries) > 0 {
+			return entries, err
+		}
+	}
+
+	arguments := append([]string{}, streams...)
+	for range streams {
+		arguments = append(arguments, ">")
+	}
+	return broker.readGroup(ctx, arguments, 5*time.Second)
+}
+
+func (broker *RedisBroker) claimStale(ctx context.Context, streams []string) ([]entities.BrokerMessage, error) {
+	messages := []entities.BrokerMessage{}
+	for _, stream := range streams {
+		entries, _, err := broker.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   stream,
+			Group:    redisConsumerGroup,
+			Consumer: broker.consumer,
+			MinIdle:  redisClaimIdle,
+			Start:    "0",
+			Count:    10,
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			messages = append(messages, redisEntryToMessage(stream, entry, true))
+		}
+	}
+	return messages, nil
+}
+
+func (broker *RedisBroker) readGroup(ctx context.Context, streams []string, block time.Duration) ([]entities.BrokerMessage, error) {
+	result, err := broker.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    redisConsumerGroup,
+		Consumer: broker.consumer,
+		Streams:  streams,
+		Count:    1,
+		Block:    block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []entities.BrokerMessage{}
+	for _, stream := range result {
+		for _, entry := range stream.Messages {
+			messages = append(messages, redisEntryToMessage(stream.Stream, entry, false))
+		}
+	}
+	return messages, nil
+}
+
+// heartbeat claims the entries in flight again until the broker is closed,
+// which resets their idle time.
+func (broker *RedisBroker) heartbeat() {
+	ticker := time.NewTicker(redisHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-broker.closed:
+			return
+		case <-ticker.C:
+		}
+		broker.mutex.Lock()
+		tags := make([]string, 0, len(broker.inFlight))
+		for tag := range broker.inFlight {
+			tags = append(tags, tag)
+		}
+		broker.mutex.Unlock()
+		for _, tag := range tags {
+			stream, id := redisDeliveryTag(tag)
+			broker.client.XClaimJustID(context.Background(), &redis.XClaimArgs{
+				Stream:   stream,
+				Group:    redisConsumerGroup,
+				Consumer: broker.consumer,
+				Messages: []string{id},
+			})
+		}
+	}
+}
+
+func (broker *RedisBroker) track(tag string, inFlight bool) {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+	if inFlight {
+		broker.inFlight[tag] = true
+	} else {
+		delete(broker.inFlight, tag)
+	}
+}
+
+func (broker *RedisBroker) Ack(ctx context.Context, message entities.BrokerMessage) error {
+	broker.track(message.DeliveryTag, false)
+	stream, id := redisDeliveryTag(message.DeliveryTag)
+	return broker.client.XAck(ctx, stream, redisConsumerGroup, id).Err()
+}
+
+// Nack has no native Redis counterpart: a requeued message is appended to the
+// stream again and the original entry is acknowledged.
+func (broker *RedisBroker) Nack(ctx context.Context, message entities.BrokerMessage, requeue bool) error {
+	if requeue {
+		if err := broker.Publish(ctx, message.Topic, message); err != nil {
+			return err
+		}
+	}
+	return broker.Ack(ctx, message)
+}
+
+// DeleteTopic deletes the stream of every priority, consumer group included.
+func (broker *RedisBroker) DeleteTopic(ctx context.Context, topic string) error {
+	streams := []string{}
+	for priority := MaxBrokerPriority; priority >= 0; priority-- {
+		streams = append(streams, redisPriorityStream(topic, priority))
+	}
+	if err := broker.client.Del(ctx, streams...).Err(); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", topic, err)
+	}
+	return nil
+}
+
+// expire pushes the expiry of a stream of a topic that has one back, every
+// time it is used.
+func (broker *RedisBroker) expire(ctx context.Context, stream string, topic string) {
+	if expiry := topicExpiry(topic); expiry > 0 {
+		broker.client.Expire(ctx, stream, expiry)
+	}
+}
+
+// Put, Delete and List make the broker a RegistryStore, so runners register
+// where every worker already connects.
+func (broker *RedisBroker) Put(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := broker.client.Set(ctx, key, value, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store %s: %w", key, err)
+	}
+	return nil
+}
+
+func (broker *RedisBroker) Delete(ctx context.Context, key string) error {
+	if err := broker.client.Del(ctx, key).Err(); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func (broker *RedisBroker) List(ctx context.Context, prefix string) (map[string][]byte, error) {
+	values := map[string][]byte{}
+	iterator := broker.client.Scan(ctx, 0, prefix+"*", 100).Iterator()
+	for iterator.Next(ctx) {
+		value, err := broker.client.Get(ctx, iterator.Val()).Bytes()
+		if errors.Is(err, redis.Nil) {
+			// Expired between the scan and the read
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", iterator.Val(), err)
+		}
+		values[iterator.Val()] = value
+	}
+	if err := iterator.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", prefix, err)
+	}
+	return values, nil
+}
+
+func (broker *RedisBroker) Close() error {
+	close(broker.closed)
+	return broker.client.Close()
+}
+
+func redisPriorityStream(topic string, priority int) string {
+	return fmt.Sprintf("%s:p%d", topic, min(max(priority, 0), MaxBrokerPriority))
+}
+
+// The delivery tag carries the stream name next to the entry id, since a
+// topic spans one stream per priority level.
+func redisDeliveryTag(tag string) (string, string) {
+	separator := strings.LastIndex(tag, " ")
+	if separator == -1 {
+		return "", tag
+	}
+	return tag[:separator], tag[separator+1:]
+}
+
+func redisEntryToMessage(stream string, entry redis.XMessage, redelivered bool) entities.BrokerMessage {
+	message := entities.BrokerMessage{
+		Topic:       stream[:strings.LastIndex(stream, ":p")],
+		Headers:     map[string]string{},
+		Redelivered: redelivered,
+		DeliveryTag: stream + " " + entry.ID,
+	}
+	if value, ok := entry.Values["id"].(string); ok {
+		message.Id = value
+	}
+	if value, ok := entry.Values["priority"].(string); ok {
+		message.Priority, _ = strconv.Atoi(value)
+	}
+	if value, ok := entry.Values["headers"].(string); ok {
+		json.Unmarshal([]byte(value), &message.Headers)
+	}
+	if value, ok := entry.Values["body"].(string); ok {
+		message.Body = []byte(value)
+	}
+	return message
+}
@@ -0,0 +1,97 @@
+package utilities
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os/exec"
+	"scripter/entities"
+	"time"
+)
+
+// TimeoutExitCode is reported for an attempt stopped by its timeout, as the
+// timeout utility does.
+const TimeoutExitCode = 124
+
+// ErrAttemptTimedOut is the cause of the context of an attempt its timeout
+// stopped, telling it apart from scripter shutting down.
+var ErrAttemptTimedOut = errors.New("attempt timed out")
+
+// RetryRunner runs something under an execution policy: every attempt gets
+// its own timeout, and a failed attempt is retried after a growing delay while
+// attempts remain and its exit code is one worth retrying.
+type RetryRunner struct{}
+
+type AttemptFunc func(ctx context.Context) (int, error)
+
+// Run stops retrying once the parent context is done.
+func (retryRunner RetryRunner) Run(parent context.Context, policy entities.ExecutionPolicy, logger *slog.Logger, run AttemptFunc, onAttempt func(entities.Attempt)) (int, error) {
+	maxAttempts := max(policy.Retry.MaxAttempts, 1)
+	delay := policy.Retry.Backoff
+
+	exitCode, err := 0, error(nil)
+	for number := 1; number <= maxAttempts; number++ {
+		attempt := entities.Attempt{Number: number, StartTime: time.Now()}
+
+		ctx, cancel := context.WithCancel(parent)
+		if policy.Timeout > 0 {
+			ctx, cancel = context.WithTimeoutCause(parent, policy.Timeout, ErrAttemptTimedOut)
+		}
+		exitCode, err = run(ctx)
+		if parent.Err() == nil && errors.Is(context.Cause(ctx), ErrAttemptTimedOut) {
+			attempt.TimedOut = true
+			exitCode, err = TimeoutExitCode, fmt.Errorf("timed out after %s", policy.Timeout)
+		}
+		cancel()
+
+		attempt.FinishTime = time.Now()
+		attempt.ExitCode = exitCode
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+		if onAttempt != nil {
+			onAttempt(attempt)
+		}
+
+		if (err == nil && exitCode == 0) || number == maxAttempts || !shouldRetry(policy.Retry, exitCode) || parent.Err() != nil {
+			break
+		}
+		logger.Warn("attempt failed, retrying", "attempt", number, "max-attempts", maxAttempts, "exit-code", exitCode, "delay", delay.String())
+		select {
+		case <-time.After(delay):
+		case <-parent.Done():
+			return exitCode, err
+		}
+		if policy.Retry.BackoffFactor > 0 {
+			delay = time.Duration(math.Round(float64(delay) * policy.Retry.BackoffFactor))
+		}
+	}
+	return exitCode, err
+}
+
+func shouldRetry(retry entities.RetryPolicy, exitCode int) bool {
+	if len(retry.RetryOn) == 0 {
+		return true
+	}
+	for _, retryOn := range retry.RetryOn {
+		if retryOn == exitCode {
+			return true
+		}
+	}
+	return false
+}
+
+// ExitCodeOf reads the exit code of a finished command, 1 when it could not
+// run at all.
+func ExitCodeOf(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) && exitError.ExitCode() >= 0 {
+		return exitError.ExitCode()
+	}
+	return 1
+}
@@ -0,0 +1,134 @@
+package utilities
+
+import (
+	"context"
+	"errors"
+	"scripter/entities"
+	"testing"
+	"time"
+)
+
+// exitCodes returns an attempt that exits with each code in turn, the last one
+// from then on.
+func exitCodes(codes ...int) AttemptFunc {
+	attempt := 0
+	return func(ctx context.Context) (int, error) {
+		code := codes[min(attempt, len(codes)-1)]
+		attempt++
+		if code != 0 {
+			return code, errors.New("failed")
+		}
+		return 0, nil
+	}
+}
+
+func TestRetryRunnerRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		retry    entities.RetryPolicy
+		codes    []int
+		attempts int
+		exitCode int
+	}{
+		{"a success is not retried", entities.RetryPolicy{MaxAttempts: 3}, []int{0}, 1, 0},
+		{"no policy runs once", entities.RetryPolicy{}, []int{1, 0}, 1, 1},
+		{"retried until it succeeds", entities.RetryPolicy{MaxAttempts: 5}, []int{1, 1, 0}, 3, 0},
+		{"retried up to the maximum", entities.RetryPolicy{MaxAttempts: 3}, []int{2}, 3, 2},
+		{"retried on a listed exit code", entities.RetryPolicy{MaxAttempts: 3, RetryOn: []int{75}}, []int{75, 0}, 2, 0},
+		{"not retried on another exit code", entities.RetryPolicy{MaxAttempts: 3, RetryOn: []int{75}}, []int{1, 0}, 1, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attempts := []entities.Attempt{}
+			exitCode, err := RetryRunner{}.Run(context.Background(), entities.ExecutionPolicy{Retry: test.retry}, testLogger, exitCodes(test.codes...), func(attempt entities.Attempt) {
+				attempts = append(attempts, attempt)
+			})
+			if exitCode != test.exitCode || (err != nil) != (test.exitCode != 0) {
+				t.Errorf("exit code %d, error %v, want %d", exitCode, err, test.exitCode)
+			}
+			if len(attempts) != test.attempts {
+				t.Fatalf("%d attempts, want %d", len(attempts), test.attempts)
+			}
+			for index, attempt := range attempts {
+				if attempt.Number != index+1 {
+					t.Errorf("attempt %d numbered %d", index+1, attempt.Number)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryRunnerBacksOff(t *testing.T) {
+	policy := entities.ExecutionPolicy{Retry: entities.RetryPolicy{MaxAttempts: 4, Backoff: 20 * time.Millisecond, BackoffFactor: 2}}
+	attempts := []entities.Attempt{}
+	RetryRunner{}.Run(context.Background(), policy, testLogger, exitCodes(1), func(attempt entities.Attempt) {
+		attempts = append(attempts, attempt)
+	})
+	if len(attempts) != 4 {
+		t.Fatalf("%d attempts, want 4", len(attempts))
+	}
+	for index, want := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond, 80 * time.Millisecond} {
+		delay := attempts[index+1].StartTime.Sub(attempts[index].FinishTime)
+		if delay < want || delay > want+200*time.Millisecond {
+			t.Errorf("delay before attempt %d %s, want %s", index+2, delay, want)
+		}
+	}
+}
+
+func TestRetryRunnerTimesAttemptsOut(t *testing.T) {
+	policy := entities.ExecutionPolicy{Timeout: 20 * time.Millisecond, Retry: entities.RetryPolicy{MaxAttempts: 2}}
+	attempts := []entities.Attempt{}
+	exitCode, err := RetryRunner{}.Run(context.Background(), policy, testLogger, func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		if !errors.Is(context.Cause(ctx), ErrAttemptTimedOut) {
+			t.Errorf("cause %v, want ErrAttemptTimedOut", context.Cause(ctx))
+		}
+		return 1, ctx.Err()
+	}, func(attempt entities.Attempt) {
+		attempts = append(attempts, attempt)
+	})
+	if exitCode != TimeoutExitCode || err == nil {
+		t.Errorf("exit code %d, error %v, want %d", exitCode, err, TimeoutExitCode)
+	}
+	if len(attempts) != 2 || !attempts[0].TimedOut || !attempts[1].TimedOut {
+		t.Errorf("attempts %+v, want two timed out", attempts)
+	}
+}
+
+func TestRetryRunnerStopsWhenItsParentEnds(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	policy := entities.ExecutionPolicy{Retry: entities.RetryPolicy{MaxAttempts: 5, Backoff: time.Hour}}
+	attempts := 0
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		RetryRunner{}.Run(parent, policy, testLogger, exitCodes(1), func(attempt entities.Attempt) {
+			attempts++
+		})
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("still waiting to retry after the parent ended")
+	}
+	if attempts != 1 {
+		t.Errorf("%d attempts, want 1", attempts)
+	}
+}
+
+func TestRetryRunnerTellsAShutdownFromATimeout(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	cancel()
+	policy := entities.ExecutionPolicy{Timeout: time.Hour}
+	var timedOut bool
+	exitCode, _ := RetryRunner{}.Run(parent, policy, testLogger, func(ctx context.Context) (int, error) {
+		return 143, errors.New("terminated")
+	}, func(attempt entities.Attempt) {
+		timedOut = attempt.TimedOut
+	})
+	if timedOut || exitCode != 143 {
+		t.Errorf("timed out %v, exit code %d, want the exit code of the shutdown", timedOut, exitCode)
+	}
+}
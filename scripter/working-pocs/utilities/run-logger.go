@@ -0,0 +1,62 @@
+package utilities
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"scripter/entities"
+)
+
+const (
+	LogFormatText = "text"
+	LogFormatJson = "json"
+)
+
+// RunLogger gives every run a log of its own, next to what else the run
+// leaves behind, every record carrying the signal it belongs to. Records are
+// written as text or as JSON lines, from the level up ("debug", "info",
+// "warn" or "error").
+type RunLogger struct {
+	Store  RunStore
+	Format string
+	Level  string
+}
+
+// Open returns the logger of the run, along with its file to close once the
+// run is over.
+func (runLogger RunLogger) Open(signal entities.Signal) (*slog.Logger, io.Closer, error) {
+	if err := runLogger.Store.Prepare(signal.Id); err != nil {
+		return nil, nil, err
+	}
+	path := runLogger.Store.LogPath(signal.Id)
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open log %s: %w", path, err)
+	}
+	handler, err := runLogger.Handler(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return slog.New(handler).With("signal-id", signal.Id, "sender", signal.Sender), file, nil
+}
+
+// Handler writes records the way the run logs are written, to any writer.
+func (runLogger RunLogger) Handler(writer io.Writer) (slog.Handler, error) {
+	var level slog.Level
+	if runLogger.Level != "" {
+		if err := level.UnmarshalText([]byte(runLogger.Level)); err != nil {
+			return nil, fmt.Errorf("unknown log level %q: choose debug, info, warn or error", runLogger.Level)
+		}
+	}
+	options := &slog.HandlerOptions{Level: level}
+
+	switch runLogger.Format {
+	case "", LogFormatText:
+		return slog.NewTextHandler(writer, options), nil
+	case LogFormatJson:
+		return slog.NewJSONHandler(writer, options), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q: choose text or json", runLogger.Format)
+}
@@ -0,0 +1,80 @@
+package utilities
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"scripter/entities"
+	"strings"
+	"testing"
+)
+
+func TestRunLoggerHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		logger RunLogger
+		want   string // What the info record starts with, empty when it is filtered
+		err    bool
+	}{
+		{"defaults", RunLogger{}, "time=", false},
+		{"text", RunLogger{Format: LogFormatText, Level: "debug"}, "time=", false},
+		{"json", RunLogger{Format: LogFormatJson}, `{"time":`, false},
+		{"level filters what is below it", RunLogger{Level: "warn"}, "", false},
+		{"unknown format", RunLogger{Format: "xml"}, "", true},
+		{"unknown level", RunLogger{Level: "loud"}, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var output bytes.Buffer
+			handler, err := test.logger.Handler(&output)
+			if test.err {
+				if err == nil {
+					t.Error("handler made, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			slog.New(handler).Info("installed", "package", "redis")
+			if test.want == "" {
+				if output.Len() > 0 {
+					t.Errorf("record %q written, want it filtered", output.String())
+				}
+				return
+			}
+			if !strings.HasPrefix(output.String(), test.want) || !strings.Contains(output.String(), "redis") {
+				t.Errorf("record %q, want it to start with %s", output.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestRunLoggerOpenWritesTheRunLog(t *testing.T) {
+	runLogger := RunLogger{Store: RunStore{Directory: t.TempDir()}, Format: LogFormatJson}
+	signal := entities.Signal{Id: "run-1", Sender: "deploy"}
+	logger, closer, err := runLogger.Open(signal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Debug("filtered")
+	logger.Info("started")
+	closer.Close()
+
+	content, err := os.ReadFile(runLogger.Store.LogPath(signal.Id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("log %q, want the info record alone", content)
+	}
+	record := map[string]any{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["signal-id"] != "run-1" || record["sender"] != "deploy" || record["msg"] != "started" {
+		t.Errorf("record %v, want started for run-1 of deploy", record)
+	}
+}
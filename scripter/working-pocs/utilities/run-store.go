@@ -0,0 +1,120 @@
+package utilities
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"scripter/entities"
+	"strings"
+	"sync"
+)
+
+// RunStore keeps what a run leaves behind in one directory per signal id:
+// the outputs it published, how its process ended, its log and, for a signal
+// with steps, the pipeline result.
+type RunStore struct {
+	Directory string
+}
+
+var runStoreMutex sync.Mutex
+
+func (runStore RunStore) RunDirectory(signalId string) string {
+	return filepath.Join(runStore.Directory, signalId)
+}
+
+// OutputsPath is the file a process publishes outputs through, handed to it
+// as SCRIPTER_OUTPUTS: one "key=value" line per output. Outputs are never read
+// from stdout, where the tools an action runs print whatever they like.
+func (runStore RunStore) OutputsPath(signalId string) string {
+	return filepath.Join(runStore.RunDirectory(signalId), "outputs")
+}
+
+// LogPath is the log of the run, see RunLogger.
+func (runStore RunStore) LogPath(signalId string) string {
+	return filepath.Join(runStore.RunDirectory(signalId), "scripter.log")
+}
+
+func (runStore RunStore) Prepare(signalId string) error {
+	if err := os.MkdirAll(runStore.RunDirectory(signalId), 0755); err != nil {
+		return fmt.Errorf("failed to create run directory: %w", err)
+	}
+	return nil
+}
+
+func (runStore RunStore) WriteOutput(signalId string, key string, value string) error {
+	return WriteOutput(runStore.OutputsPath(signalId), key, value)
+}
+
+// ResetOutputs drops what an earlier attempt published, so the outputs of a
+// run are those of its last attempt.
+func (runStore RunStore) ResetOutputs(signalId string) error {
+	runStoreMutex.Lock()
+	defer runStoreMutex.Unlock()
+
+	if err := os.Remove(runStore.OutputsPath(signalId)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to reset outputs of %s: %w", signalId, err)
+	}
+	return nil
+}
+
+// WriteOutput appends an output to an outputs file, for actions that run in
+// scripter rather than as a process.
+func WriteOutput(outputsPath string, key string, value string) error {
+	runStoreMutex.Lock()
+	defer runStoreMutex.Unlock()
+
+	file, err := os.OpenFile(outputsPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open outputs %s: %w", outputsPath, err)
+	}
+	defer file.Close()
+	_, err = fmt.Fprintf(file, "%s=%s\n", key, value)
+	return err
+}
+
+// ReadOutputs returns the outputs a run published, a later value replacing an
+// earlier one with the same key.
+func (runStore RunStore) ReadOutputs(signalId string) (map[string]string, error) {
+	outputs := map[string]string{}
+
+	data, err := os.ReadFile(runStore.OutputsPath(signalId))
+	if os.IsNotExist(err) {
+		return outputs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outputs of %s: %w", signalId, err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if key, value, isPair := strings.Cut(scanner.Text(), "="); isPair && strings.TrimSpace(key) != "" {
+			outputs[strings.TrimSpace(key)] = value
+		}
+	}
+	return outputs, scanner.Err()
+}
+
+func (runStore RunStore) SavePipeline(signalId string, pipeline entities.PipelineResult) error {
+	if err := runStore.Prepare(signalId); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(pipeline, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(runStore.RunDirectory(signalId), "pipeline.json"), data, 0644)
+}
+
+func (runStore RunStore) SaveProcess(signalId string, result entities.ProcessResult) error {
+	if err := runStore.Prepare(signalId); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(runStore.RunDirectory(signalId), "process.json"), data, 0644)
+}
@@ -0,0 +1,95 @@
+package utilities
+
+import (
+	"fmt"
+	"scripter/entities"
+	"strings"
+)
+
+// RunnerMatcher decides which runners may pick a signal and records why each
+// one was accepted or refused, so a mismatch can be explained.
+type RunnerMatcher struct{}
+
+var labelExpression = LabelExpression{}
+
+func (runnerMatcher RunnerMatcher) Match(signal entities.Signal, runners []entities.Runner) []entities.RunnerMatch {
+	matches := []entities.RunnerMatch{}
+	for _, runner := range runners {
+		matches = append(matches, runnerMatcher.MatchRunner(signal, runner))
+	}
+	return matches
+}
+
+func (runnerMatcher RunnerMatcher) Eligible(signal entities.Signal, runners []entities.Runner) []entities.Runner {
+	eligible := []entities.Runner{}
+	for _, match := range runnerMatcher.Match(signal, runners) {
+		if match.Eligible {
+			eligible = append(eligible, match.Runner)
+		}
+	}
+	return eligible
+}
+
+func (runnerMatcher RunnerMatcher) MatchRunner(signal entities.Signal, runner entities.Runner) entities.RunnerMatch {
+	match := entities.RunnerMatch{Runner: runner, Eligible: true}
+	refuse := func(reason string, arguments ...any) {
+		match.Eligible = false
+		match.Reasons = append(match.Reasons, fmt.Sprintf(reason, arguments...))
+	}
+
+	runnerValues := map[string]string{}
+	for _, runnerLabel := range runner.Labels {
+		if key, value, isPair := strings.Cut(runnerLabel, "="); isPair {
+			runnerValues[key] = value
+		}
+	}
+
+	missing := []string{}
+	for _, label := range signal.LabelSet {
+		if stringHandler.ContainsString(runner.Labels, label.Label) {
+			continue
+		}
+		if value, exists := runnerValues[label.Key]; label.Key != "" && exists {
+			missing = append(missing, fmt.Sprintf("%s (runner has %s=%s)", label.Label, label.Key, value))
+			continue
+		}
+		missing = append(missing, label.Label)
+	}
+	if len(missing) > 0 {
+		refuse("missing labels %s", strings.Join(missing, ", "))
+	} else if len(signal.Labels) > 0 {
+		match.Reasons = append(match.Reasons, fmt.Sprintf("has all labels %s", strings.Join(signal.Labels, ", ")))
+	}
+
+	// agent-or-label names a runner, a single label or a label expression
+	if signal.Executor != "" {
+		if labelExpression.IsLabelExpression(signal.Executor) {
+			result, err := labelExpression.Evaluate(signal.Executor, runner.Labels)
+			if err != nil {
+				refuse("invalid executor expression: %v", err)
+			} else if !result {
+				refuse("executor expression %q is false", signal.Executor)
+			} else {
+				match.Reasons = append(match.Reasons, fmt.Sprintf("executor expression %q holds", signal.Executor))
+			}
+		} else if signal.Executor != runner.Name && !stringHandler.ContainsString(runner.Labels, signal.Executor) {
+			refuse("executor %q is neither its name nor one of its labels", signal.Executor)
+		}
+	}
+
+	// A containerized signal brings its own OS and installer
+	if !signal.Containerize {
+		if signal.SignalOs != "" && runner.Os != "" && signal.SignalOs != runner.Os {
+			refuse("signal needs os %s, runner is %s", signal.SignalOs, runner.Os)
+		}
+		if signal.PackageInstaller != "" && runner.PackageInstaller != "" && signal.PackageInstaller != runner.PackageInstaller {
+			refuse("signal needs package installer %s, runner has %s", signal.PackageInstaller, runner.PackageInstaller)
+		}
+	}
+
+	if runner.Capacity <= 0 {
+		refuse("runner has no capacity")
+	}
+
+	return match
+}
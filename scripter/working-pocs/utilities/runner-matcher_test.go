@@ -0,0 +1,91 @@
+package utilities
+
+import (
+	"scripter/entities"
+	"strings"
+	"testing"
+)
+
+func TestLabelExpressionEvaluate(t *testing.T) {
+	labels := []string{"linux", "redis", "dos-box", "os=linux"}
+	tests := []struct {
+		expression string
+		want       bool
+	}{
+		{"linux && !arm64", true},
+		{"linux && arm64", false},
+		{"(redis || rabbitmq) && dos-box", true},
+		{"rabbitmq || redis && arm64", false},
+		{"(rabbitmq || redis) && !arm64", true},
+		{"!linux || dos-box", true},
+		{"!(linux && redis)", false},
+		{"os=linux && !os=windows", true},
+	}
+	for _, test := range tests {
+		got, err := LabelExpression{}.Evaluate(test.expression, labels)
+		if err != nil {
+			t.Errorf("Evaluate(%s): %v", test.expression, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Evaluate(%s) = %v, want %v", test.expression, got, test.want)
+		}
+	}
+
+	for _, expression := range []string{"linux &&", "(linux", "linux)", "&& linux", "linux & redis", "!"} {
+		if _, err := (LabelExpression{}).Evaluate(expression, labels); err == nil {
+			t.Errorf("Evaluate(%s) accepted a malformed expression", expression)
+		}
+	}
+}
+
+func TestRunnerMatcherMatchRunner(t *testing.T) {
+	runner := entities.Runner{Name: "builder-1", Os: "linux", PackageInstaller: "apt", Capacity: 2, Labels: []string{"linux", "redis", "os=linux"}}
+	labels := func(raw ...string) []entities.Label { return resolveLabels(generateLabels(raw, "t")) }
+
+	tests := []struct {
+		name     string
+		signal   entities.Signal
+		runner   entities.Runner
+		eligible bool
+		reason   string
+	}{
+		{"no requirement", entities.Signal{}, runner, true, ""},
+		{"has every label", entities.Signal{LabelSet: labels("linux", "os=linux")}, runner, true, ""},
+		{"misses a label", entities.Signal{LabelSet: labels("linux", "gpu")}, runner, false, "missing labels gpu"},
+		{"has another value for the key", entities.Signal{LabelSet: labels("os=windows")}, runner, false, "os=windows (runner has os=linux)"},
+		{"executor names the runner", entities.Signal{Executor: "builder-1"}, runner, true, ""},
+		{"executor is one of its labels", entities.Signal{Executor: "redis"}, runner, true, ""},
+		{"executor names another runner", entities.Signal{Executor: "builder-2"}, runner, false, "neither its name nor one of its labels"},
+		{"executor expression holds", entities.Signal{Executor: "linux && (redis || rabbitmq)"}, runner, true, "holds"},
+		{"executor expression is false", entities.Signal{Executor: "linux && !redis"}, runner, false, "is false"},
+		{"executor expression is malformed", entities.Signal{Executor: "linux &&"}, runner, false, "invalid executor expression"},
+		{"another os", entities.Signal{SignalOs: "windows"}, runner, false, "needs os windows"},
+		{"another package installer", entities.Signal{PackageInstaller: "dnf"}, runner, false, "needs package installer dnf"},
+		{"a container brings its os and installer", entities.Signal{SignalOs: "linux", PackageInstaller: "apk", Containerize: true}, entities.Runner{Name: "mac", Os: "darwin", PackageInstaller: "homebrew", Capacity: 1}, true, ""},
+		{"no capacity", entities.Signal{}, entities.Runner{Name: "busy", Labels: []string{"linux"}}, false, "no capacity"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			match := RunnerMatcher{}.MatchRunner(test.signal, test.runner)
+			if match.Eligible != test.eligible {
+				t.Errorf("eligible %v, want %v: %v", match.Eligible, test.eligible, match.Reasons)
+			}
+			if test.reason != "" && !strings.Contains(strings.Join(match.Reasons, "; "), test.reason) {
+				t.Errorf("reasons %v, want one with %q", match.Reasons, test.reason)
+			}
+		})
+	}
+}
+
+func TestRunnerMatcherEligible(t *testing.T) {
+	runners := []entities.Runner{
+		{Name: "linux-1", Os: "linux", Capacity: 1, Labels: []string{"linux", "redis"}},
+		{Name: "linux-2", Os: "linux", Capacity: 1, Labels: []string{"linux"}},
+		{Name: "windows-1", Os: "windows", Capacity: 1, Labels: []string{"windows", "redis"}},
+	}
+	eligible := RunnerMatcher{}.Eligible(entities.Signal{SignalOs: "linux", Executor: "redis || rabbitmq"}, runners)
+	if len(eligible) != 1 || eligible[0].Name != "linux-1" {
+		t.Errorf("eligible %+v, want linux-1 alone", eligible)
+	}
+}
@@ -0,0 +1,199 @@
+package utilities
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"scripter/entities"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRunnerTtl is how long a runner stays registered after its last
+// heartbeat, so a worker that crashed drops out of the registry on its own.
+const DefaultRunnerTtl = 30 * time.Second
+
+const runnerKeyPrefix = "scripter:runner:"
+
+// RegistryStore holds registered runners, each under a key of its own that
+// expires once its time to live runs out. A broker that can hold state, as
+// Redis, is one; FileRegistryStore serves the others.
+type RegistryStore interface {
+	Put(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) (map[string][]byte, error)
+}
+
+// RunnerRegistry keeps the runners workers registered and keep alive with
+// heartbeats, so every worker and command sharing the store sees the same set.
+type RunnerRegistry struct {
+	Store RegistryStore
+	Ttl   time.Duration
+}
+
+func (runnerRegistry RunnerRegistry) Register(runner entities.Runner) error {
+	runner.LastSeen = time.Now().UTC()
+	data, err := json.Marshal(runner)
+	if err != nil {
+		return fmt.Errorf("failed to encode runner %s: %w", runner.Name, err)
+	}
+	return runnerRegistry.Store.Put(context.Background(), runnerKeyPrefix+runner.Name, data, runnerRegistry.ttl())
+}
+
+// Heartbeat registers the runner again every third of its time to live until
+// ctx is done.
+func (runnerRegistry RunnerRegistry) Heartbeat(ctx context.Context, runner entities.Runner) {
+	ticker := time.NewTicker(runnerRegistry.ttl() / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := runnerRegistry.Register(runner); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to renew registration of %s: %v\n", runner.Name, err)
+			}
+		}
+	}
+}
+
+func (runnerRegistry RunnerRegistry) Unregister(name string) error {
+	return runnerRegistry.Store.Delete(context.Background(), runnerKeyPrefix+name)
+}
+
+func (runnerRegistry RunnerRegistry) List() ([]entities.Runner, error) {
+	values, err := runnerRegistry.Store.List(context.Background(), runnerKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	list := []entities.Runner{}
+	for key, value := range values {
+		var runner entities.Runner
+		if err := json.Unmarshal(value, &runner); err != nil {
+			return nil, fmt.Errorf("malformed runner %s: %w", strings.TrimPrefix(key, runnerKeyPrefix), err)
+		}
+		list = append(list, runner)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list, nil
+}
+
+func (runnerRegistry RunnerRegistry) ttl() time.Duration {
+	if runnerRegistry.Ttl <= 0 {
+		return DefaultRunnerTtl
+	}
+	return runnerRegistry.Ttl
+}
+
+// FileRegistryStore keeps the entries in a JSON file, locked while it is
+// rewritten so the worker processes of a host never lose each other's
+// updates. It is shared by the processes of one host only.
+type FileRegistryStore struct {
+	Path string
+}
+
+type fileRegistryEntry struct {
+	Value   json.RawMessage `json:"value"`
+	Expires time.Time       `json:"expires"`
+}
+
+var fileRegistryMutex sync.Mutex
+
+func (store FileRegistryStore) Put(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return store.update(func(entries map[string]fileRegistryEntry) {
+		entries[key] = fileRegistryEntry{Value: value, Expires: time.Now().Add(ttl).UTC()}
+	})
+}
+
+func (store FileRegistryStore) Delete(ctx context.Context, key string) error {
+	return store.update(func(entries map[string]fileRegistryEntry) {
+		delete(entries, key)
+	})
+}
+
+func (store FileRegistryStore) List(ctx context.Context, prefix string) (map[string][]byte, error) {
+	values := map[string][]byte{}
+	err := store.update(func(entries map[string]fileRegistryEntry) {
+		for key, entry := range entries {
+			if strings.HasPrefix(key, prefix) {
+				values[key] = entry.Value
+			}
+		}
+	})
+	return values, err
+}
+
+// update runs change on the live entries under the lock and writes them back,
+// dropping the expired ones.
+func (store FileRegistryStore) update(change func(entries map[string]fileRegistryEntry)) error {
+	fileRegistryMutex.Lock()
+	defer fileRegistryMutex.Unlock()
+
+	// The registry itself is replaced on every write, the lock lives beside it
+	lock, err := os.OpenFile(store.Path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to lock runner registry %s: %w", store.Path, err)
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return fmt.Errorf("failed to lock runner registry %s: %w", store.Path, err)
+	}
+	defer unlockFile(lock)
+
+	entries, err := store.load()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for key, entry := range entries {
+		if entry.Expires.Before(now) {
+			delete(entries, key)
+		}
+	}
+	change(entries)
+	return store.save(entries)
+}
+
+func (store FileRegistryStore) load() (map[string]fileRegistryEntry, error) {
+	entries := map[string]fileRegistryEntry{}
+
+	data, err := os.ReadFile(store.Path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read runner registry %s: %w", store.Path, err)
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("malformed runner registry %s: %w", store.Path, err)
+	}
+	return entries, nil
+}
+
+// save writes through a temporary file so readers never see a partial registry.
+func (store FileRegistryStore) save(entries map[string]fileRegistryEntry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode runner registry: %w", err)
+	}
+	temporary, err := os.CreateTemp(filepath.Dir(store.Path), ".runners-*")
+	if err != nil {
+		return fmt.Errorf("failed to write runner registry: %w", err)
+	}
+	defer os.Remove(temporary.Name())
+
+	if _, err := temporary.Write(data); err != nil {
+		temporary.Close()
+		return fmt.Errorf("failed to write runner registry: %w", err)
+	}
+	if err := temporary.Close(); err != nil {
+		return fmt.Errorf("failed to write runner registry: %w", err)
+	}
+	return os.Rename(temporary.Name(), store.Path)
+}
@@ -0,0 +1,201 @@
+package utilities
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"scripter/entities"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	StepSucceeded = "succeeded"
+	StepFailed    = "failed"
+	StepSkipped   = "skipped"
+
+	StepSkippedExitCode = "-1"
+)
+
+// StepRunner executes the steps of a signal one after the other. Each step
+// pointer names another template, which is resolved and run as part of the
+// action through the execute function. A step with a "when" condition only
+// runs when it holds; besides the signal variables it can read previous.status
+// and previous.exit-code of the last step that ran, and steps.<name>.status and
+// steps.<name>.exit-code of any earlier one. A skipped step has the exit code
+// StepSkippedExitCode, as it never ran.
+//
+// Outputs a step publishes become steps.<name>.outputs.<key>, for the
+// conditions and the "${{ }}" references of the steps after it.
+type StepRunner struct {
+	LibraryPaths []string // Extra directories searched for step templates
+}
+
+// StepExecutor runs a step with the outputs published so far and returns the
+// outputs the step published itself.
+type StepExecutor func(step entities.SignalStep, templatePath string, outputs map[string]string) (int, map[string]string, error)
+
+var conditionExpression = ConditionExpression{}
+
+func (stepRunner StepRunner) Run(signal entities.Signal, execute StepExecutor) entities.PipelineResult {
+	result := entities.PipelineResult{Succeeded: true, Outputs: map[string]string{}}
+	for key, value := range signal.Outputs {
+		result.Outputs[key] = value
+	}
+	stopped := false
+	variables := conditionExpression.SignalVariables(signal)
+	variables["previous.status"] = ""
+	variables["previous.exit-code"] = "0"
+
+	for _, step := range orderSteps(signal.Steps) {
+		stepResult := entities.StepResult{Name: step.Name, Pointer: step.Pointer}
+
+		if stopped {
+			stepResult.Status, stepResult.Reason = StepSkipped, "an earlier step failed"
+			variables["steps."+step.Name+".status"] = StepSkipped
+			variables["steps."+step.Name+".exit-code"] = StepSkippedExitCode
+			result.Steps = append(result.Steps, stepResult)
+			continue
+		}
+
+		holds, err := conditionExpression.Holds(step.When, variables)
+		if err == nil && !holds {
+			stepResult.Status, stepResult.Reason = StepSkipped, fmt.Sprintf("condition %q does not hold", step.When)
+			variables["steps."+step.Name+".status"] = StepSkipped
+			variables["steps."+step.Name+".exit-code"] = StepSkippedExitCode
+			result.Steps = append(result.Steps, stepResult)
+			continue
+		}
+
+		stepResult.StartTime = time.Now()
+		templatePath := ""
+		if err == nil {
+			templatePath, err = stepRunner.ResolvePointer(step.Pointer, signal.SourcePath)
+		}
+		if err == nil {
+			stepResult.TemplatePath = templatePath
+			stepResult.ExitCode, stepResult.Outputs, err = execute(step, templatePath, result.Outputs)
+		}
+		for key, value := range stepResult.Outputs {
+			name := "steps." + step.Name + ".outputs." + key
+			result.Outputs[name] = value
+			variables[name] = value
+		}
+		stepResult.FinishTime = time.Now()
+
+		stepResult.Status = StepSucceeded
+		if err != nil || stepResult.ExitCode != 0 {
+			stepResult.Status = StepFailed
+			if err != nil {
+				stepResult.Error = err.Error()
+			}
+			if stepResult.ExitCode == 0 {
+				stepResult.ExitCode = 1
+			}
+			// A step allowed to continue is reported as failed without
+			// failing the pipeline
+			if step.OnFailure != "continue" {
+				result.Succeeded = false
+				result.ExitCode = stepResult.ExitCode
+				stopped = true
+			}
+		}
+		variables["previous.status"] = stepResult.Status
+		variables["previous.exit-code"] = strconv.Itoa(stepResult.ExitCode)
+		variables["steps."+step.Name+".status"] = stepResult.Status
+		variables["steps."+step.Name+".exit-code"] = strconv.Itoa(stepResult.ExitCode)
+		result.Steps = append(result.Steps, stepResult)
+	}
+
+	return result
+}
+
+// ResolvePointer looks for the step template as given, next to the template
+// that declared it, in its steps directory and in the library paths. Step
+// libraries name their files either after the pointer or "step-<pointer>".
+func (stepRunner StepRunner) ResolvePointer(pointer string, sourcePath string) (string, error) {
+	directories := []string{""}
+	if sourcePath != "" {
+		directories = append(directories, filepath.Dir(sourcePath), filepath.Join(filepath.Dir(sourcePath), "steps"))
+	}
+	directories = append(directories, stepRunner.LibraryPaths...)
+
+	names := []string{pointer, pointer + ".yaml", "step-" + pointer + ".yaml"}
+
+	for _, directory := range directories {
+		for _, name := range names {
+			candidate := filepath.Join(directory, name)
+			if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+				return candidate, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no template found for step pointer %q", pointer)
+}
+
+// StepChain is the chain of templates a step of the signal runs in, ending
+// with the template of the signal. A step whose template is already running
+// further up that chain would recurse forever, so it is refused.
+func (stepRunner StepRunner) StepChain(signal entities.Signal, templatePath string) ([]string, error) {
+	chain := append(append([]string{}, signal.StepChain...), signal.SourcePath)
+	step := absolutePath(templatePath)
+	for index, template := range chain {
+		if absolutePath(template) == step {
+			return nil, fmt.Errorf("step cycle: %s -> %s", strings.Join(chain[index:], " -> "), templatePath)
+		}
+	}
+	return chain, nil
+}
+
+// PrintReport prints a line per step and logs each of them.
+func (stepRunner StepRunner) PrintReport(result entities.PipelineResult, logger *slog.Logger) {
+	for index, step := range result.Steps {
+		logger.Info("step finished", "step", step.Name, "status", step.Status, "exit-code", step.ExitCode, "error", step.Error, "reason", step.Reason)
+		line := fmt.Sprintf("%d. %s [%s]", index+1, step.Name, step.Status)
+		if step.Status != StepSkipped {
+			line += fmt.Sprintf(" exit %d in %s", step.ExitCode, step.FinishTime.Sub(step.StartTime).Round(time.Millisecond))
+		}
+		if step.Error != "" {
+			line += ": " + step.Error
+		}
+		if step.Reason != "" {
+			line += ": " + step.Reason
+		}
+		fmt.Println(line)
+	}
+}
+
+func absolutePath(path string) string {
+	if absolute, err := filepath.Abs(path); err == nil {
+		return absolute
+	}
+	return filepath.Clean(path)
+}
+
+// Steps keep their declared order unless they give an explicit priority.
+func orderSteps(steps []entities.SignalStep) []entities.SignalStep {
+	type orderedStep struct {
+		step     entities.SignalStep
+		priority int
+	}
+	ordered := []orderedStep{}
+	for index, step := range steps {
+		priority := index
+		if step.Priority != nil {
+			priority = *step.Priority
+		}
+		ordered = append(ordered, orderedStep{step: step, priority: priority})
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].priority < ordered[j].priority
+	})
+
+	result := []entities.SignalStep{}
+	for _, item := range ordered {
+		result = append(result, item.step)
+	}
+	return result
+}
@@ -1,7 +1,9 @@
 package utilities
 
 import (
+	"fmt"
 	"path/filepath"
+	"regexp"
 	"strings"
 )
 
@@ -88,3 +90,58 @@ func (stringHandler StringHandler) InterpretStringAsBool(requireAcknowledge stri
 	}
 	return false
 }
+
+// ExtractMarker finds a "$(name argument)" marker in the value and returns the
+// value without it, the marker argument and whether the marker was present.
+// Parentheses inside the argument are allowed as long as they are balanced.
+func (stringHandler StringHandler) ExtractMarker(rawString string, name string) (string, string, bool) {
+	start := strings.Index(rawString, "$("+name)
+	if start == -1 {
+		return strings.TrimSpace(rawString), "", false
+	}
+
+	depth := 0
+	quoted := false
+	for index := start + 1; index < len(rawString); index++ {
+		switch rawString[index] {
+		case '"':
+			quoted = !quoted
+		case '(':
+			if !quoted {
+				depth++
+			}
+		case ')':
+			if quoted {
+				continue
+			}
+			depth--
+			if depth == 0 {
+				argument := strings.TrimSpace(rawString[start+len("$("+name) : index])
+				remaining := strings.TrimSpace(rawString[:start] + rawString[index+1:])
+				return remaining, argument, true
+			}
+		}
+	}
+	return strings.TrimSpace(rawString), "", false
+}
+
+var interpolationPattern = regexp.MustCompile(`\$\{\{\s*([A-Za-z0-9_.\-]+)\s*\}\}`)
+
+// Interpolate replaces every "${{ name }}" reference with its value and fails
+// on a reference that has none, rather than running with a half-built value.
+func (stringHandler StringHandler) Interpolate(rawString string, values map[string]string) (string, error) {
+	unknown := []string{}
+	result := interpolationPattern.ReplaceAllStringFunc(rawString, func(reference string) string {
+		name := interpolationPattern.FindStringSubmatch(reference)[1]
+		value, exists := values[name]
+		if !exists {
+			unknown = append(unknown, name)
+			return reference
+		}
+		return value
+	})
+	if len(unknown) > 0 {
+		return rawString, fmt.Errorf("no value for %s", strings.Join(unknown, ", "))
+	}
+	return result, nil
+}
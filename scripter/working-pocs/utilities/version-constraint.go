@@ -0,0 +1,142 @@
+package utilities
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var versionOperators = []string{">=", "<=", "==", "!=", ">", "<", "="}
+
+// VersionSatisfies tells whether a version meets every comma separated
+// constraint, as in ">=7.0,<8". A constraint without an operator, or with "=",
+// is a prefix on a version boundary: "7.0" and "=7.0.*" take 7.0, 7.0.15 and
+// 7.0-1, never 7.01.
+func VersionSatisfies(version string, constraints string) (bool, error) {
+	for _, constraint := range strings.Split(constraints, ",") {
+		constraint = strings.TrimSpace(constraint)
+		if constraint == "" {
+			continue
+		}
+		operator, wanted := splitVersionOperator(constraint)
+		if wanted == "" {
+			return false, fmt.Errorf("version constraint %q has no version", constraint)
+		}
+
+		var satisfied bool
+		switch operator {
+		case "", "=", "==":
+			satisfied = versionMatches(version, strings.TrimSuffix(strings.TrimSuffix(wanted, "*"), "."))
+		case "!=":
+			satisfied = !versionMatches(version, strings.TrimSuffix(strings.TrimSuffix(wanted, "*"), "."))
+		case ">":
+			satisfied = CompareVersions(version, wanted) > 0
+		case ">=":
+			satisfied = CompareVersions(version, wanted) >= 0
+		case "<":
+			satisfied = CompareVersions(version, wanted) < 0
+		case "<=":
+			satisfied = CompareVersions(version, wanted) <= 0
+		}
+		if !satisfied {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// SplitVersionConstraint separates "dosbox>=0.74" into its name and constraint.
+func SplitVersionConstraint(value string) (string, string) {
+	index := strings.IndexAny(value, "<>=!")
+	if index <= 0 {
+		return value, ""
+	}
+	return value[:index], value[index:]
+}
+
+func splitVersionOperator(constraint string) (string, string) {
+	for _, operator := range versionOperators {
+		if wanted, hasOperator := strings.CutPrefix(constraint, operator); hasOperator {
+			return operator, strings.TrimSpace(wanted)
+		}
+	}
+	return "", constraint
+}
+
+// "7.0" matches 7.0, 7.0.15 and 7.0-1 but not 7.01; a Debian epoch ("1:")
+// is ignored.
+func versionMatches(installed string, wanted string) bool {
+	if wanted == "" {
+		return true
+	}
+	if !strings.Contains(wanted, ":") {
+		installed = withoutEpoch(installed)
+	}
+	rest, isPrefix := strings.CutPrefix(installed, wanted)
+	return isPrefix && (rest == "" || strings.ContainsRune(".-+~_", rune(rest[0])))
+}
+
+// CompareVersions orders versions segment by segment, numbers by value and
+// words alphabetically: 7.0.15-1 comes after 7.0.9 and before 7.1.
+func CompareVersions(first string, second string) int {
+	firstSegments := versionSegments(withoutEpoch(first))
+	secondSegments := versionSegments(withoutEpoch(second))
+	for index := 0; index < len(firstSegments) && index < len(secondSegments); index++ {
+		firstNumber, firstErr := strconv.Atoi(firstSegments[index])
+		secondNumber, secondErr := strconv.Atoi(secondSegments[index])
+		switch {
+		case firstErr == nil && secondErr == nil:
+			if firstNumber != secondNumber {
+				return compareInts(firstNumber, secondNumber)
+			}
+		case firstErr == nil:
+			return 1 // A number outranks a word, 1.0.1 > 1.0.beta
+		case secondErr == nil:
+			return -1
+		default:
+			if comparison := strings.Compare(firstSegments[index], secondSegments[index]); comparison != 0 {
+				return comparison
+			}
+		}
+	}
+	return compareInts(len(firstSegments), len(secondSegments))
+}
+
+func versionSegments(version string) []string {
+	segments := []string{}
+	current := ""
+	for _, character := range version {
+		isDigit := character >= '0' && character <= '9'
+		isSeparator := strings.ContainsRune(".-+~_", character)
+		if current != "" && (isSeparator || isDigit != (current[0] >= '0' && current[0] <= '9')) {
+			segments = append(segments, current)
+			current = ""
+		}
+		if !isSeparator {
+			current += string(character)
+		}
+	}
+	if current != "" {
+		segments = append(segments, current)
+	}
+	return segments
+}
+
+func withoutEpoch(version string) string {
+	if epoch, rest, hasEpoch := strings.Cut(version, ":"); hasEpoch {
+		if _, err := strconv.Atoi(epoch); err == nil {
+			return rest
+		}
+	}
+	return version
+}
+
+func compareInts(first int, second int) int {
+	switch {
+	case first < second:
+		return -1
+	case first > second:
+		return 1
+	}
+	return 0
+}
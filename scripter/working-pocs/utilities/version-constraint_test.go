@@ -0,0 +1,117 @@
+package utilities
+
+import (
+	"scripter/entities"
+	"testing"
+)
+
+func TestVersionSatisfies(t *testing.T) {
+	tests := []struct {
+		version     string
+		constraints string
+		want        bool
+	}{
+		{"7.0.15", ">=7.0,<8", true},
+		{"8.0.1", ">=7.0,<8", false},
+		{"7.0.15", "> 7.0", true},
+		{"2.31.0", ">2.31", true},
+		{"2.31", "<=2.31", true},
+		{"7.0.15-1", "7.0", true},
+		{"7.0", "7.0", true},
+		{"7.01", "7.0", false},
+		{"7.0.15", "=7.0.*", true},
+		{"7.1.0", "==7.0.*", false},
+		{"7.2.4", "!=7.0", true},
+		{"7.0.3", "!=7.0", false},
+		{"5:7.0.15-1~deb12u1", ">=7", true},
+		{"5:7.0.15-1~deb12u1", "7.0", true},
+		{"1:2.3", "1:2", true},
+		{"1.0.beta", ">=1.0.1", false},
+		{"1.0.1", "", true},
+	}
+	for _, test := range tests {
+		satisfied, err := VersionSatisfies(test.version, test.constraints)
+		if err != nil {
+			t.Errorf("VersionSatisfies(%q, %q): %v", test.version, test.constraints, err)
+			continue
+		}
+		if satisfied != test.want {
+			t.Errorf("VersionSatisfies(%q, %q) = %v, want %v", test.version, test.constraints, satisfied, test.want)
+		}
+	}
+}
+
+func TestVersionSatisfiesRefusesAConstraintWithoutVersion(t *testing.T) {
+	for _, constraints := range []string{">=", "7.0,<", "!="} {
+		if _, err := VersionSatisfies("7.0", constraints); err == nil {
+			t.Errorf("VersionSatisfies(7.0, %q) accepted a constraint without version", constraints)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		first  string
+		second string
+		want   int
+	}{
+		{"7.0.15-1", "7.0.9", 1},
+		{"7.0.15", "7.1", -1},
+		{"1.0", "1.0", 0},
+		{"1.0", "1.0.0", -1},
+		{"10.0", "9.9", 1},
+		{"1.0.1", "1.0.beta", 1},
+		{"1.0.alpha", "1.0.beta", -1},
+		{"2.0rc1", "2.0rc2", -1},
+		{"1:2.0", "2.0", 0},
+	}
+	for _, test := range tests {
+		if got := CompareVersions(test.first, test.second); got != test.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", test.first, test.second, got, test.want)
+		}
+		if got := CompareVersions(test.second, test.first); got != -test.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", test.second, test.first, got, -test.want)
+		}
+	}
+}
+
+func TestSplitVersionConstraint(t *testing.T) {
+	tests := []struct {
+		value      string
+		name       string
+		constraint string
+	}{
+		{"dosbox>=0.74", "dosbox", ">=0.74"},
+		{"redis-server=7.0.*", "redis-server", "=7.0.*"},
+		{"jq", "jq", ""},
+		{">=1.0", ">=1.0", ""},
+	}
+	for _, test := range tests {
+		name, constraint := SplitVersionConstraint(test.value)
+		if name != test.name || constraint != test.constraint {
+			t.Errorf("SplitVersionConstraint(%q) = %q, %q, want %q, %q", test.value, name, constraint, test.name, test.constraint)
+		}
+	}
+}
+
+func TestResolveDependency(t *testing.T) {
+	tests := []struct {
+		dependency entities.Dependency
+		want       entities.Dependency
+	}{
+		{entities.Dependency{Name: "redis-server"}, entities.Dependency{Installer: "apt", Name: "redis-server"}},
+		{entities.Dependency{Name: "dosbox>=0.74"}, entities.Dependency{Installer: "apt", Name: "dosbox", Version: ">=0.74"}},
+		{entities.Dependency{Name: "redis-server=7.0.*"}, entities.Dependency{Installer: "apt", Name: "redis-server", Version: "=7.0.*"}},
+		{entities.Dependency{Name: "pip:requests>=2.31"}, entities.Dependency{Installer: "pip", Name: "requests", Version: ">=2.31"}},
+		{entities.Dependency{Name: "libc6:i386"}, entities.Dependency{Installer: "apt", Name: "libc6:i386"}},
+		{entities.Dependency{Name: "typescript", Installer: "npm", Binary: "tsc", Version: ">=5,<6"}, entities.Dependency{Installer: "npm", Name: "typescript", Binary: "tsc", Version: ">=5,<6"}},
+		{entities.Dependency{Name: "pip:requests", Installer: "apt"}, entities.Dependency{Installer: "apt", Name: "pip:requests"}},
+		{entities.Dependency{Name: "redis>=7", Version: "7.0.*"}, entities.Dependency{Installer: "apt", Name: "redis", Version: "7.0.*"}},
+		{entities.Dependency{}, entities.Dependency{Installer: "apt"}},
+	}
+	for _, test := range tests {
+		if got := ResolveDependency(test.dependency, "apt"); got != test.want {
+			t.Errorf("ResolveDependency(%+v) = %+v, want %+v", test.dependency, got, test.want)
+		}
+	}
+}
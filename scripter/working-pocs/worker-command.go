@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"scripter/entities"
+	"scripter/utilities"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// scripter worker [-labels a,b] [-concurrency n] [-topic name]
+// Consumes signal requests from the broker and runs the ones this runner is
+// eligible for through the same pipeline as the one-shot CLI.
+func runWorkerCommand(args []string) {
+	flags := flag.NewFlagSet("worker", flag.ExitOnError)
+	hostname, _ := os.Hostname()
+	name := flags.String("name", hostname, "runner name other signals can target through agent-or-label")
+	labels := flags.String("labels", os.Getenv("SCRIPTER_WORKER_LABELS"), "comma separated labels this worker advertises")
+	concurrency := flags.Int("concurrency", 1, "signals executed at the same time")
+	topic := flags.String("topic", utilities.SignalTopic, "broker topic to consume")
+	packageInstaller := flags.String("package-installer", detectPackageInstaller(), "package installer available on this runner")
+	flags.Parse(args)
+
+	// A worker has no run of its own, it logs to stderr the way runs log
+	handler, err := runLogger.Handler(os.Stderr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	logger := slog.New(handler).With("runner", *name)
+
+	// A worker consumes what it queues itself, so the memory broker is
+	// allowed, but only when asked for
+	broker, err := connectBroker(false, max(*concurrency, 1))
+	if err == nil && broker == nil {
+		err = fmt.Errorf("no broker configured: set SCRIPTER_BROKER to memory, rabbitmq or redis")
+	}
+	if err != nil {
+		logger.Error("broker not connected", "error", err)
+		os.Exit(1)
+	}
+	defer broker.Close()
+	queueHandler.Broker = broker
+	acknowledgeHandler.Broker = broker
+	useRunnerRegistryOf(broker)
+
+	runner, err := setLabels(entities.Runner{
+		Name:             *name,
+		Os:               runtime.GOOS,
+		PackageInstaller: *packageInstaller,
+		Capacity:         max(*concurrency, 1),
+	}, splitLabels(*labels))
+	if err != nil {
+		logger.Error("runner not registered", "error", err)
+		os.Exit(1)
+	}
+	defer runnerRegistry.Unregister(runner.Name)
+
+	// Cancelling the subscription stops new deliveries and shuts the signals
+	// being executed down as their shutdown-signal says; the worker exits once
+	// they ended.
+	subscription, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// A worker that stops renewing its registration, crashed or not, drops out
+	// of the registry once its time to live is over
+	go runnerRegistry.Heartbeat(subscription, runner)
+
+	deliveries, err := broker.Subscribe(subscription, *topic)
+	if err != nil {
+		logger.Error("not subscribed", "topic", *topic, "error", err)
+		os.Exit(1)
+	}
+
+	logger.Info("worker consuming", "topic", *topic, "labels", strings.Join(runner.Labels, ","), "concurrency", runner.Capacity)
+
+	var running sync.WaitGroup
+	for range runner.Capacity {
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			for message := range deliveries {
+				handleDelivery(subscription, broker, message, runner, logger)
+			}
+		}()
+	}
+
+	go func() {
+		<-subscription.Done()
+		logger.Info("shutting down, stopping running signals")
+	}()
+	running.Wait()
+}
+
+func handleDelivery(subscription context.Context, broker utilities.Broker, message entities.BrokerMessage, runner entities.Runner, logger *slog.Logger) {
+	ctx := context.Background()
+
+	var request entities.SignalRequest
+	if err := json.Unmarshal(message.Body, &request); err != nil {
+		logger.Warn("dropping malformed signal", "signal-id", message.Id, "error", err)
+		broker.Nack(ctx, message, false)
+		return
+	}
+
+	// Whether this runner may run the signal is decided before it is
+	// resolved, so signals passed on to other runners leave no audit trail here
+	loaded, err := loadSignal(request)
+	if err != nil {
+		logger.Warn("dropping signal", "signal-id", request.Id, "error", err)
+		broker.Nack(ctx, message, false)
+		return
+	}
+	if match := runnerMatcher.MatchRunner(loaded, runner); !match.Eligible {
+		passSignal(broker, message, loaded, runner, logger)
+		return
+	}
+
+	signal, err := resolveSignal(request)
+	if err != nil {
+		logger.Warn("dropping signal", "signal-id", request.Id, "error", err)
+		broker.Nack(ctx, message, false)
+		return
+	}
+
+	// A signal that panics once is retried once, in case the failure came from
+	// this host; one that panics again is dropped.
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			logger.Error("signal panicked", "signal-id", signal.Id, "panic", fmt.Sprint(recovered))
+			if message.Headers[panickedHeader] != "" {
+				broker.Nack(ctx, message, false)
+				return
+			}
+			republishSignal(broker, message, panickedHeader, runner.Name, logger)
+		}
+	}()
+
+	// A delivery still buffered when the worker shuts down is not started
+	if subscription.Err() != nil {
+		broker.Nack(ctx, message, true)
+		return
+	}
+
+	// A signal that ran and failed is not redelivered, its failure is final.
+	// One the shutdown cut short is, unless it was left running.
+	exitCode, err := interpretSignal(subscription, signal)
+	if err != nil && subscription.Err() != nil && !errors.Is(err, utilities.ErrLeftRunning) {
+		logger.Warn("signal interrupted by the shutdown, requeueing it", "signal-id", signal.Id, "error", err)
+		broker.Nack(ctx, message, true)
+		return
+	}
+	if err != nil {
+		logger.Warn("signal failed", "signal-id", signal.Id, "exit-code", exitCode, "error", err)
+	}
+	broker.Ack(ctx, message)
+}
+
+// Headers a worker adds to a signal it publishes again: the runners it was
+// passed by and the runner it panicked on.
+const (
+	passedByHeader = "passed-by"
+	panickedHeader = "panicked-on"
+)
+
+// passSignal leaves the signal to the runners it was meant for. It is
+// published again rather than requeued, so the broker delivers it as new and
+// the hand-off is never taken for a retry. A signal no registered runner may
+// run, or one every registered runner already passed, is dropped.
+func passSignal(broker utilities.Broker, message entities.BrokerMessage, signal entities.Signal, runner entities.Runner, logger *slog.Logger) {
+	passedBy := splitLabels(message.Headers[passedByHeader])
+	if !stringHandler.ContainsString(passedBy, runner.Name) {
+		passedBy = append(passedBy, runner.Name)
+	}
+
+	// Without the registry there is no telling, so the signal is passed on
+	runners, err := runnerRegistry.List()
+	if err != nil {
+		logger.Warn("runners not listed", "signal-id", signal.Id, "error", err)
+	}
+	candidates := []entities.Runner{}
+	for _, eligible := range runnerMatcher.Eligible(signal, runners) {
+		if !stringHandler.ContainsString(passedBy, eligible.Name) {
+			candidates = append(candidates, eligible)
+		}
+	}
+	if err == nil && len(candidates) == 0 {
+		logger.Warn("dropping signal, no registered runner is eligible", "signal-id", signal.Id, "sender", signal.Sender)
+		reportAcknowledge(signal, utilities.AcknowledgeFinished, nil, "no eligible runner")
+		broker.Nack(context.Background(), message, false)
+		return
+	}
+	republishSignal(broker, message, passedByHeader, strings.Join(passedBy, ","), logger)
+}
+
+// republishSignal publishes the message again with the header set and acks
+// the delivery, leaving it to the broker when publishing fails.
+func republishSignal(broker utilities.Broker, message entities.BrokerMessage, header string, value string, logger *slog.Logger) {
+	ctx := context.Background()
+	republished := entities.BrokerMessage{Id: message.Id, Body: message.Body, Priority: message.Priority, Headers: map[string]string{}}
+	for key, existing := range message.Headers {
+		republished.Headers[key] = existing
+	}
+	republished.Headers[header] = value
+	if err := broker.Publish(ctx, message.Topic, republished); err != nil {
+		logger.Warn("signal not published again", "signal-id", message.Id, "error", err)
+		broker.Nack(ctx, message, true)
+		return
+	}
+	broker.Ack(ctx, message)
+}
+
+func detectPackageInstaller() string {
+	candidates := map[string][]string{
+		"linux":   {"apt", "dnf", "yum", "apk", "pacman"},
+		"darwin":  {"brew"},
+		"windows": {"choco"},
+	}
+	for _, candidate := range candidates[runtime.GOOS] {
+		if _, err := exec.LookPath(candidate); err == nil {
+			if candidate == "brew" {
+				return "homebrew"
+			}
+			if candidate == "choco" {
+				return "chocolatey"
+			}
+			return candidate
+		}
+	}
+	return ""
+}
+
+func splitLabels(rawLabels string) []string {
+	labels := []string{}
+	for _, label := range strings.Split(rawLabels, ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}